@@ -0,0 +1,138 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package types
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vine-io/maco/pkg/pemutil"
+)
+
+const (
+	// FileScheme master 文件服务器的地址协议，如: maco://nginx/nginx.conf
+	FileScheme = "maco"
+	// DefaultFileEnv 默认的文件服务器环境
+	DefaultFileEnv = "base"
+	// FileAuthExpiration FileAuth 签名的有效期
+	FileAuthExpiration = 5 * time.Minute
+	// CopyEnvPrefix maco-cp 暂存文件挂载到文件服务器的临时环境前缀，minion 不缓存这些环境中的文件
+	CopyEnvPrefix = "cp-"
+)
+
+// FileAuth 签名中的请求方法，凭证只能用于签名时的方法和文件地址
+const (
+	FileMethodList     = "ListFiles"
+	FileMethodStat     = "StatFile"
+	FileMethodDownload = "DownloadFile"
+)
+
+// FileURL master 文件服务器中的文件地址，格式为 maco://<path>?env=<env>
+type FileURL struct {
+	// Env 文件所在的环境，默认为 base
+	Env string
+	// Path 相对于环境根目录的路径，不以 / 开头，为空时表示根目录
+	Path string
+}
+
+// ParseFileURL 解析文件地址，路径中不能包含 ..
+func ParseFileURL(text string) (*FileURL, error) {
+	if !IsFileURL(text) {
+		return nil, fmt.Errorf("invalid file url %s: scheme must be %s://", text, FileScheme)
+	}
+	name, query, _ := strings.Cut(strings.TrimPrefix(text, FileScheme+"://"), "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid file url %s: %w", text, err)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return nil, fmt.Errorf("invalid file url %s: path must not contain ..", text)
+		}
+	}
+
+	out := &FileURL{
+		Env:  values.Get("env"),
+		Path: strings.Trim(path.Clean("/"+name), "/"),
+	}
+	if out.Env == "" {
+		out.Env = DefaultFileEnv
+	}
+	return out, nil
+}
+
+// IsFileURL 判断地址是否为 master 文件服务器中的文件地址
+func IsFileURL(text string) bool {
+	return strings.HasPrefix(text, FileScheme+"://")
+}
+
+func (u *FileURL) String() string {
+	out := FileScheme + "://" + u.Path
+	if u.Env != "" && u.Env != DefaultFileEnv {
+		out += "?env=" + url.QueryEscape(u.Env)
+	}
+	return out
+}
+
+// fileAuthMessage 返回 FileAuth 签名的内容，各字段使用 | 分割
+func fileAuthMessage(auth *FileAuth, method, rawURL string) []byte {
+	fields := []string{auth.Minion, method, rawURL, strconv.FormatInt(auth.Timestamp, 10), auth.Nonce}
+	return []byte(strings.Join(fields, "|"))
+}
+
+// NewFileAuth 使用 minion 私钥生成访问文件服务器的凭证，凭证只能用于一次 method 方法对 rawURL 的请求
+func NewFileAuth(minion, method, rawURL string, privateKey []byte) (*FileAuth, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	auth := &FileAuth{
+		Minion:    minion,
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	signature, err := pemutil.SignByRSA(fileAuthMessage(auth, method, rawURL), privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("sign file auth: %w", err)
+	}
+	auth.Signature = signature
+	return auth, nil
+}
+
+// VerifyFileAuth 使用 minion 公钥校验凭证是否为 method 方法对 rawURL 的请求签发，
+// 签名时间与 now 相差超过 FileAuthExpiration 时校验失败。nonce 是否重复使用由调用方检查
+func VerifyFileAuth(auth *FileAuth, method, rawURL string, publicKey []byte, now time.Time) error {
+	if auth == nil || auth.Minion == "" || auth.Nonce == "" || len(auth.Signature) == 0 {
+		return fmt.Errorf("missing file auth")
+	}
+	delta := now.Sub(time.Unix(auth.Timestamp, 0))
+	if delta > FileAuthExpiration || delta < -FileAuthExpiration {
+		return fmt.Errorf("file auth of %s is expired", auth.Minion)
+	}
+	return pemutil.VerifyByRSA(fileAuthMessage(auth, method, rawURL), auth.Signature, publicKey)
+}
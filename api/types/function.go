@@ -0,0 +1,49 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package types
+
+// ArgSpec sys.argspec 和 sys.doc 返回的函数参数说明
+type ArgSpec struct {
+	Name string `json:"name"`
+	// 参数类型，如: string, int, float, bool, list, map
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+	Default  any    `json:"default,omitempty"`
+	// 是否只能使用 key=value 的形式传入
+	Keyword bool   `json:"keyword,omitempty"`
+	Doc     string `json:"doc,omitempty"`
+}
+
+// Argspec 函数的参数列表
+type Argspec struct {
+	Args []*ArgSpec `json:"args"`
+	// 可变参数的名称，为空时函数不接受可变参数
+	Varargs string `json:"varargs,omitempty"`
+}
+
+// FunctionDoc sys.doc 返回的函数说明
+type FunctionDoc struct {
+	Name string `json:"name"`
+	Doc  string `json:"doc,omitempty"`
+	Argspec
+	Returns string `json:"returns,omitempty"`
+}
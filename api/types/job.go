@@ -0,0 +1,101 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package types
+
+// UserMetadataKey 请求中携带提交用户的 grpc metadata 键，http 请求使用 Grpc-Metadata-X-Maco-User 头。
+// 该值由客户端自行上报，master 没有认证客户端身份，不能作为权限控制的依据
+const UserMetadataKey = "x-maco-user"
+
+// JobState 任务状态
+type JobState string
+
+const (
+	// JobRunning 任务正在等待 minion 返回结果
+	JobRunning JobState = "running"
+	// JobDone 所有 minion 已返回结果或者任务超时
+	JobDone JobState = "done"
+	// JobKilled 任务被终止
+	JobKilled JobState = "killed"
+)
+
+func (s JobState) String() string {
+	return string(s)
+}
+
+// JobResult 任务的执行结果
+type JobResult string
+
+const (
+	// JobSuccess 所有目标 minion 执行成功
+	JobSuccess JobResult = "success"
+	// JobFailed 存在执行失败的 minion，或者任务结束时有 minion 未返回结果
+	JobFailed JobResult = "failed"
+)
+
+func (r JobResult) String() string {
+	return string(r)
+}
+
+// Missing 返回尚未返回执行结果的目标 minion
+func (m *Job) Missing() []string {
+	returned := make(map[string]struct{}, len(m.Items))
+	for _, item := range m.Items {
+		returned[item.Minion] = struct{}{}
+	}
+	out := make([]string, 0)
+	for _, name := range m.Targets {
+		if _, ok := returned[name]; !ok {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// Result 返回任务的执行结果，minion 不为空时只检查该 minion 的执行结果。
+// 任务未结束且没有失败的 minion 时，返回空值
+func (m *Job) Result(minion string) JobResult {
+	done := m.State != JobRunning.String()
+	failed, success := false, 0
+	for _, item := range m.Items {
+		if minion != "" && item.Minion != minion {
+			continue
+		}
+		if !item.Result {
+			failed = true
+		} else {
+			success += 1
+		}
+	}
+
+	switch {
+	case failed:
+		return JobFailed
+	case minion != "" && success != 0:
+		return JobSuccess
+	case minion == "" && success == len(m.Targets):
+		return JobSuccess
+	case done:
+		return JobFailed
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// NewValue 将数据转换为 Value，非基础类型的数据使用 json 格式保存
+func NewValue(v any) (*Value, error) {
+	value := &Value{}
+	switch tv := v.(type) {
+	case string:
+		value.Type = ValueType_ValueString
+		value.Data = tv
+	case bool:
+		value.Type = ValueType_ValueBoolean
+		value.Data = strconv.FormatBool(tv)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		value.Type = ValueType_ValueInteger
+		value.Data = fmt.Sprintf("%d", tv)
+	case float32, float64:
+		value.Type = ValueType_ValueFloat
+		value.Data = fmt.Sprintf("%v", tv)
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("marshal value: %w", err)
+		}
+		value.Type = ValueType_ValueObject
+		value.Data = string(data)
+	}
+	return value, nil
+}
+
+// Interface 返回 Value 保存的原始数据
+func (m *Value) Interface() (any, error) {
+	if m == nil {
+		return nil, nil
+	}
+	switch m.Type {
+	case ValueType_ValueString:
+		return m.Data, nil
+	case ValueType_ValueBoolean:
+		return strconv.ParseBool(m.Data)
+	case ValueType_ValueInteger:
+		return strconv.ParseInt(m.Data, 10, 64)
+	case ValueType_ValueFloat:
+		return strconv.ParseFloat(m.Data, 64)
+	case ValueType_ValueObject:
+		var out any
+		if err := json.Unmarshal([]byte(m.Data), &out); err != nil {
+			return nil, fmt.Errorf("unmarshal value: %w", err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unknown value type: %v", m.Type)
+	}
+}
+
+// NewValues 将 map 中的数据转换为 Value
+func NewValues(data map[string]any) (map[string]*Value, error) {
+	out := make(map[string]*Value, len(data))
+	for key, v := range data {
+		value, err := NewValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+// ValuesInterface 返回 Value map 中保存的原始数据
+func ValuesInterface(values map[string]*Value) (map[string]any, error) {
+	out := make(map[string]any, len(values))
+	for key, value := range values {
+		v, err := value.Interface()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		out[key] = v
+	}
+	return out, nil
+}
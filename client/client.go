@@ -97,6 +97,10 @@ func NewClient(cfg *Config) (*Client, error) {
 		grpc.WithTransportCredentials(creds),
 		grpc.WithKeepaliveParams(kecp),
 		grpc.WithIdleTimeout(DefaultTimeout),
+		WithMaxMessageSize(),
+	}
+	if cfg.User != "" {
+		DialOpts = append(DialOpts, withUser(cfg.User)...)
 	}
 
 	conn, err := grpc.NewClient(target, DialOpts...)
@@ -176,6 +180,56 @@ func (c *Client) GetMinion(ctx context.Context, name string) (*types.MinionKey,
 	return rsp.Minion, nil
 }
 
+// GetGrains 返回 minion 缓存在 master 中的 grains，keys 为空时返回全部
+func (c *Client) GetGrains(ctx context.Context, name string, keys ...string) (*pb.MinionGrains, error) {
+	opts := c.buildCallOptions()
+
+	in := &pb.GetGrainsRequest{
+		Name: name,
+		Keys: keys,
+	}
+
+	rsp, err := c.macoClient.GetGrains(ctx, in, opts...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp.Grains, nil
+}
+
+// ListGrains 返回符合筛选条件的 minion grains，包括离线的 minion
+func (c *Client) ListGrains(ctx context.Context, selector *types.Selector, keys ...string) ([]*pb.MinionGrains, error) {
+	opts := c.buildCallOptions()
+
+	in := &pb.ListGrainsRequest{
+		Keys: keys,
+	}
+	if selector != nil {
+		in.Minions = selector.Minions
+		in.Expression = selector.Expression
+	}
+
+	rsp, err := c.macoClient.ListGrains(ctx, in, opts...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp.Grains, nil
+}
+
+// RenderPillar 返回 master 为 minion 编译的 pillar 数据，用于调试 pillar
+func (c *Client) RenderPillar(ctx context.Context, name string) (*pb.RenderPillarResponse, error) {
+	opts := c.buildCallOptions()
+
+	in := &pb.RenderPillarRequest{
+		Name: name,
+	}
+
+	rsp, err := c.macoClient.RenderPillar(ctx, in, opts...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp, nil
+}
+
 func (c *Client) AcceptMinion(ctx context.Context, minions []string, acceptAll, includeRejected, includeDenied bool) ([]string, error) {
 	opts := c.buildCallOptions()
 
@@ -244,11 +298,17 @@ func (c *Client) DeleteMinion(ctx context.Context, minions []string, deleteAll b
 }
 
 func (c *Client) Call(ctx context.Context, req *types.CallRequest) (*types.Report, error) {
+	return c.call(ctx, &pb.CallRequest{Request: req})
+}
+
+// CallNoJob 执行请求但不保存到任务缓存，用于查询函数说明等一次性的请求
+func (c *Client) CallNoJob(ctx context.Context, req *types.CallRequest) (*types.Report, error) {
+	return c.call(ctx, &pb.CallRequest{Request: req, NoJob: true})
+}
+
+func (c *Client) call(ctx context.Context, in *pb.CallRequest) (*types.Report, error) {
 	opts := c.buildCallOptions()
 
-	in := &pb.CallRequest{
-		Request: req,
-	}
 	rsp, err := c.macoClient.Call(ctx, in, opts...)
 	if err != nil {
 		return nil, parse(err)
@@ -256,6 +316,73 @@ func (c *Client) Call(ctx context.Context, req *types.CallRequest) (*types.Repor
 	return rsp.Report, nil
 }
 
+// CallAsync 提交任务后立即返回任务 id 和目标 minion，通过 LookupJob 获取执行结果
+func (c *Client) CallAsync(ctx context.Context, req *types.CallRequest) (string, []string, error) {
+	opts := c.buildCallOptions()
+
+	in := &pb.CallAsyncRequest{
+		Request: req,
+	}
+	rsp, err := c.macoClient.CallAsync(ctx, in, opts...)
+	if err != nil {
+		return "", nil, parse(err)
+	}
+	return rsp.Jid, rsp.Targets, nil
+}
+
+// GetJob 返回任务记录
+func (c *Client) GetJob(ctx context.Context, jid string) (*types.Job, error) {
+	opts := c.buildCallOptions()
+
+	in := &pb.GetJobRequest{
+		Jid: jid,
+	}
+	rsp, err := c.macoClient.GetJob(ctx, in, opts...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp.Job, nil
+}
+
+// LookupJob 返回任务的执行结果、状态和尚未返回结果的 minion
+func (c *Client) LookupJob(ctx context.Context, jid string) (*pb.LookupJobResponse, error) {
+	opts := c.buildCallOptions()
+
+	in := &pb.LookupJobRequest{
+		Jid: jid,
+	}
+	rsp, err := c.macoClient.LookupJob(ctx, in, opts...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp, nil
+}
+
+// ListJobs 返回符合条件的任务和任务总数
+func (c *Client) ListJobs(ctx context.Context, req *pb.ListJobsRequest) ([]*types.Job, int64, error) {
+	opts := c.buildCallOptions()
+
+	rsp, err := c.macoClient.ListJobs(ctx, req, opts...)
+	if err != nil {
+		return nil, 0, parse(err)
+	}
+	return rsp.Jobs, rsp.Total, nil
+}
+
+// KillJob 终止正在执行的任务，返回尚未返回结果的 minion
+func (c *Client) KillJob(ctx context.Context, jid string) ([]string, error) {
+	opts := c.buildCallOptions()
+
+	in := &pb.KillJobRequest{
+		Jid: jid,
+	}
+	rsp, err := c.macoClient.KillJob(ctx, in, opts...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp.Minions, nil
+}
+
 func (c *Client) Close() error {
 	select {
 	case <-c.done:
@@ -26,6 +26,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/user"
 	"path/filepath"
 	"sync"
 	"time"
@@ -48,6 +49,10 @@ type Config struct {
 	CertFile string `json:"cert-file" toml:"cert-file"`
 	KeyFile  string `json:"key-file" toml:"key-file"`
 	CaFile   string `json:"ca-file" toml:"ca-file"`
+
+	// User 提交任务的用户，记录在 master 的任务缓存中，默认为当前系统用户。
+	// 该值由客户端自行上报，master 不做校验
+	User string `json:"user" toml:"user"`
 }
 
 func NewConfig(target string) *Config {
@@ -55,6 +60,7 @@ func NewConfig(target string) *Config {
 		Target:         target,
 		DialTimeout:    DefaultTimeout,
 		RequestTimeout: DefaultTimeout,
+		User:           currentUser(),
 	}
 	return opts
 }
@@ -98,6 +104,9 @@ func (cfg *Config) init() error {
 	if cfg.RequestTimeout <= 0 {
 		cfg.RequestTimeout = DefaultTimeout
 	}
+	if cfg.User == "" {
+		cfg.User = currentUser()
+	}
 	return nil
 }
 
@@ -125,3 +134,12 @@ func (cfg *Config) Save(filename string) error {
 	}
 	return os.WriteFile(filename, data, 0755)
 }
+
+// currentUser 返回当前系统用户的名称
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
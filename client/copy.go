@@ -0,0 +1,222 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	pb "github.com/vine-io/maco/api/rpc"
+	"github.com/vine-io/maco/api/types"
+)
+
+// DefaultCopyChunkSize 上传文件的默认分块大小
+const DefaultCopyChunkSize = 64 * 1024
+
+// CopyOptions 复制文件的选项
+type CopyOptions struct {
+	// Dest minion 上的目标路径，复制目录时为目标目录
+	Dest string
+	// Mode 文件权限，如: 0644
+	Mode string
+	// User 和 Group 文件的用户和用户组
+	User  string
+	Group string
+	// Makedirs 是否创建不存在的父目录
+	Makedirs bool
+	// Timeout 超时时长，单位为秒
+	Timeout int64
+	// Test 测试模式，只计算预期的修改
+	Test bool
+	// ChunkSize 上传的分块大小，为 0 时使用 DefaultCopyChunkSize
+	ChunkSize int
+}
+
+// copySource 本地待上传的文件
+type copySource struct {
+	info *types.FileInfo
+	name string
+}
+
+// scanCopySource 扫描本地文件或目录，返回待上传的文件和 sha256 值，目录中的符号链接按其指向的文件处理
+func scanCopySource(source string) ([]*copySource, bool, error) {
+	stat, err := os.Stat(source)
+	if err != nil {
+		return nil, false, err
+	}
+	if !stat.IsDir() {
+		file, err := newCopySource(source, filepath.Base(source), stat)
+		if err != nil {
+			return nil, false, err
+		}
+		return []*copySource{file}, false, nil
+	}
+
+	files := make([]*copySource, 0)
+	err = filepath.WalkDir(source, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == source {
+			return nil
+		}
+		rel, _ := filepath.Rel(source, name)
+		stat, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		if stat.IsDir() && d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		if !stat.IsDir() && !stat.Mode().IsRegular() {
+			return nil
+		}
+		file, err := newCopySource(name, filepath.ToSlash(rel), stat)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return files, true, nil
+}
+
+func newCopySource(name, rel string, stat fs.FileInfo) (*copySource, error) {
+	info := &types.FileInfo{
+		Path:         rel,
+		Mode:         fmt.Sprintf("%04o", stat.Mode().Perm()),
+		ModTimestamp: stat.ModTime().Unix(),
+		IsDir:        stat.IsDir(),
+	}
+	if !stat.IsDir() {
+		fd, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		defer fd.Close()
+		h := sha256.New()
+		n, err := io.Copy(h, fd)
+		if err != nil {
+			return nil, fmt.Errorf("hash %s: %w", name, err)
+		}
+		info.Size = n
+		info.Hash = hex.EncodeToString(h.Sum(nil))
+	}
+	return &copySource{info: info, name: name}, nil
+}
+
+// CopyFile 分块上传本地文件或目录到 master，由 master 复制到筛选的 minion 上，返回每个 minion 的复制结果
+func (c *Client) CopyFile(ctx context.Context, selector *types.Selector, source string, options *CopyOptions) (*types.Report, error) {
+	files, dir, err := scanCopySource(source)
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := options.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultCopyChunkSize
+	}
+
+	header := &pb.CopyFileHeader{
+		Selector: selector,
+		Dest:     options.Dest,
+		Dir:      dir,
+		Files:    make([]*types.FileInfo, 0, len(files)),
+		Mode:     options.Mode,
+		User:     options.User,
+		Group:    options.Group,
+		Makedirs: options.Makedirs,
+		Timeout:  options.Timeout,
+		Test:     options.Test,
+	}
+	for _, file := range files {
+		header.Files = append(header.Files, file.info)
+	}
+
+	opts := c.buildCallOptions()
+	stream, err := c.macoClient.CopyFile(ctx, opts...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	if err = stream.Send(&pb.CopyFileRequest{Header: header}); err != nil {
+		return nil, parse(err)
+	}
+
+	buf := make([]byte, chunkSize)
+	for _, file := range files {
+		if file.info.IsDir {
+			continue
+		}
+		if err = sendCopyFile(stream, file, buf); err != nil {
+			return nil, err
+		}
+	}
+
+	rsp, err := stream.CloseAndRecv()
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp.Report, nil
+}
+
+// sendCopyFile 分块发送文件内容
+func sendCopyFile(stream pb.MacoRPC_CopyFileClient, file *copySource, buf []byte) error {
+	fd, err := os.Open(file.name)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	offset := int64(0)
+	for {
+		n, rErr := io.ReadFull(fd, buf)
+		if n > 0 {
+			chunk := &pb.CopyFileChunk{
+				Path:   file.info.Path,
+				Offset: offset,
+				Data:   buf[:n],
+			}
+			if err = stream.Send(&pb.CopyFileRequest{Chunk: chunk}); err != nil {
+				// 服务端提前返回错误时，错误信息由 CloseAndRecv 返回
+				if err == io.EOF {
+					_, err = stream.CloseAndRecv()
+				}
+				return parse(err)
+			}
+			offset += int64(n)
+		}
+		if rErr == io.EOF || rErr == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if rErr != nil {
+			return fmt.Errorf("read %s: %w", file.name, rErr)
+		}
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -52,8 +53,12 @@ type Dispatcher struct {
 	lg             *zap.Logger
 	internalClient pb.InternalRPCClient
 
+	// smu 保证 stream 的发送不会并发执行，同时保护重连时替换的 stream 和 masterPubKey
+	smu    sync.Mutex
 	stream pb.InternalRPC_DispatchClient
 
+	// cmu 保护 connMsg，grains 更新和重连可能同时发生
+	cmu     sync.Mutex
 	connMsg *types.ConnectRequest
 
 	masterPubKey []byte
@@ -108,11 +113,18 @@ func (d *Dispatcher) connect(ctx context.Context) (*types.ConnectResponse, error
 	if err != nil {
 		return nil, err
 	}
-	d.stream = stream
+
+	d.cmu.Lock()
+	connMsg := &types.ConnectRequest{
+		Minion:          d.connMsg.Minion,
+		MinionPublicKey: d.connMsg.MinionPublicKey,
+		Grain:           d.connMsg.Grain,
+	}
+	d.cmu.Unlock()
 
 	msg := &pb.DispatchRequest{
 		Type:    types.EventType_EventConnect,
-		Connect: d.connMsg,
+		Connect: connMsg,
 	}
 	err = stream.Send(msg)
 	if err != nil {
@@ -124,7 +136,12 @@ func (d *Dispatcher) connect(ctx context.Context) (*types.ConnectResponse, error
 		return nil, parse(err)
 	}
 	rsp := out.Connect
+
+	// 握手完成后再替换 stream，避免其他请求在握手前发送
+	d.smu.Lock()
+	d.stream = stream
 	d.masterPubKey = rsp.MasterPublicKey
+	d.smu.Unlock()
 
 	d.lg.Info("connect to master dispatch succeeded")
 	d.connected.Store(true)
@@ -138,11 +155,15 @@ func (d *Dispatcher) Call(in *types.CallResponse) error {
 		Id: in.Id,
 	}
 
+	d.smu.Lock()
+	pubKey := d.masterPubKey
+	d.smu.Unlock()
+
 	b, err := msgpack.Marshal(in)
 	if err != nil {
 		err = fmt.Errorf("msgpack marshal: %w", err)
 	} else {
-		b, err = pemutil.EncodeByRSA(b, d.masterPubKey)
+		b, err = pemutil.EncodeByRSA(b, pubKey)
 		if err != nil {
 			err = fmt.Errorf("rsa encode: %w", err)
 		}
@@ -158,7 +179,28 @@ func (d *Dispatcher) Call(in *types.CallResponse) error {
 		Call: rsp,
 	}
 
-	err = d.stream.Send(msg)
+	return d.send(msg)
+}
+
+// Grains 向 master 上报最新的 grains
+func (d *Dispatcher) Grains(grain *types.Grain) error {
+	// 重连时携带最新的 grains
+	d.cmu.Lock()
+	d.connMsg.Grain = grain
+	d.cmu.Unlock()
+
+	msg := &pb.DispatchRequest{
+		Type:  types.EventType_EventGrains,
+		Grain: grain,
+	}
+
+	return d.send(msg)
+}
+
+func (d *Dispatcher) send(msg *pb.DispatchRequest) error {
+	d.smu.Lock()
+	defer d.smu.Unlock()
+	err := d.stream.Send(msg)
 	return parse(err)
 }
 
@@ -213,6 +255,10 @@ func (d *Dispatcher) process() {
 			}
 		}
 
+		d.smu.Lock()
+		stream := d.stream
+		d.smu.Unlock()
+
 		d.lg.Info("receives dispatch message")
 	LOOP:
 		for {
@@ -224,7 +270,7 @@ func (d *Dispatcher) process() {
 			default:
 			}
 
-			rsp, err := d.stream.Recv()
+			rsp, err := stream.Recv()
 			if err != nil {
 				if isUnavailable(err) {
 					d.lg.Error("master dispatch is unavailable")
@@ -0,0 +1,140 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+
+	pb "github.com/vine-io/maco/api/rpc"
+	"github.com/vine-io/maco/api/types"
+)
+
+// FileClient 以 minion 的身份访问 master 文件服务器，每个请求使用 minion 私钥签名
+type FileClient struct {
+	internalClient pb.InternalRPCClient
+	callOptions    []grpc.CallOption
+
+	minion     string
+	privateKey []byte
+}
+
+// NewFileClient 创建 FileClient，minion 必须已被 master 接受
+func (c *Client) NewFileClient(minion string, privateKey []byte) *FileClient {
+	return &FileClient{
+		internalClient: c.internalClient,
+		callOptions:    c.buildCallOptions(),
+		minion:         minion,
+		privateKey:     privateKey,
+	}
+}
+
+// List 列出目录中的文件，recursive 为 true 时包括子目录中的文件
+func (fc *FileClient) List(ctx context.Context, url string, recursive bool) ([]*types.FileInfo, error) {
+	auth, err := types.NewFileAuth(fc.minion, types.FileMethodList, url, fc.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	in := &pb.ListFilesRequest{
+		Auth:      auth,
+		Url:       url,
+		Recursive: recursive,
+	}
+	rsp, err := fc.internalClient.ListFiles(ctx, in, fc.callOptions...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp.Files, nil
+}
+
+// Stat 返回文件信息，包括文件内容的 sha256 值
+func (fc *FileClient) Stat(ctx context.Context, url string) (*types.FileInfo, error) {
+	auth, err := types.NewFileAuth(fc.minion, types.FileMethodStat, url, fc.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	in := &pb.StatFileRequest{
+		Auth: auth,
+		Url:  url,
+	}
+	rsp, err := fc.internalClient.StatFile(ctx, in, fc.callOptions...)
+	if err != nil {
+		return nil, parse(err)
+	}
+	return rsp.File, nil
+}
+
+// Download 分块下载文件并写入 w，下载完成后校验文件内容的 sha256 值
+func (fc *FileClient) Download(ctx context.Context, url string, w io.Writer) (*types.FileInfo, error) {
+	auth, err := types.NewFileAuth(fc.minion, types.FileMethodDownload, url, fc.privateKey)
+	if err != nil {
+		return nil, err
+	}
+	in := &pb.DownloadFileRequest{
+		Auth: auth,
+		Url:  url,
+	}
+	stream, err := fc.internalClient.DownloadFile(ctx, in, fc.callOptions...)
+	if err != nil {
+		return nil, parse(err)
+	}
+
+	var info *types.FileInfo
+	h := sha256.New()
+	var size int64
+	for {
+		rsp, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, parse(err)
+		}
+		if rsp.File != nil {
+			info = rsp.File
+		}
+		if rsp.Offset != size {
+			return nil, fmt.Errorf("download %s: unexpected chunk at %d, want %d", url, rsp.Offset, size)
+		}
+		if _, err = w.Write(rsp.Data); err != nil {
+			return nil, fmt.Errorf("download %s: %w", url, err)
+		}
+		h.Write(rsp.Data)
+		size += int64(len(rsp.Data))
+	}
+
+	if info == nil {
+		return nil, fmt.Errorf("download %s: missing file info", url)
+	}
+	if size != info.Size {
+		return nil, fmt.Errorf("download %s: got %d bytes, want %d", url, size, info.Size)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != info.Hash {
+		return nil, fmt.Errorf("download %s: sha256 mismatch", url)
+	}
+	return info, nil
+}
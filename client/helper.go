@@ -27,10 +27,13 @@ import (
 	"io"
 	"time"
 
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	apiErr "github.com/vine-io/maco/api/errors"
+	"github.com/vine-io/maco/api/types"
 )
 
 func parse(err error) error {
@@ -52,3 +55,27 @@ func retryInterval(attempts int) time.Duration {
 	}
 	return time.Duration(attempts*10) * time.Second
 }
+
+// WithMaxMessageSize 返回将 grpc 消息的最大长度提高到 types.MaxMessageSize 的连接参数
+func WithMaxMessageSize() grpc.DialOption {
+	return grpc.WithDefaultCallOptions(
+		grpc.MaxCallRecvMsgSize(types.MaxMessageSize),
+		grpc.MaxCallSendMsgSize(types.MaxMessageSize),
+	)
+}
+
+// withUser 返回在请求 metadata 中携带用户的拦截器
+func withUser(user string) []grpc.DialOption {
+	unary := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, types.UserMetadataKey, user)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = metadata.AppendToOutgoingContext(ctx, types.UserMetadataKey, user)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unary),
+		grpc.WithChainStreamInterceptor(stream),
+	}
+}
@@ -34,6 +34,7 @@ import (
 	"go.uber.org/zap"
 	"sigs.k8s.io/yaml"
 
+	"github.com/vine-io/maco/api/types"
 	"github.com/vine-io/maco/pkg/logutil"
 )
 
@@ -55,14 +56,21 @@ type Config struct {
 
 	AutoAccept bool `json:"auto_accept" toml:"auto_accept"`
 
+	// FileRoots 文件服务器各环境的根目录，如: base, dev, prod，base 默认为 DataRoot/states
+	FileRoots map[string]string `json:"file_roots" toml:"file_roots"`
+
+	// KeepJobs 任务缓存保留的小时数，默认为 24，小于 0 时不清理
+	KeepJobs int64 `json:"keep_jobs" toml:"keep_jobs"`
+
 	Log *logutil.LogConfig `json:"log" toml:"log"`
 }
 
 func NewConfig() *Config {
 	lc := logutil.NewLogConfig()
 	cfg := &Config{
-		Listen: DefaultListenAddress,
-		Log:    &lc,
+		Listen:   DefaultListenAddress,
+		KeepJobs: DefaultKeepJobs,
+		Log:      &lc,
 	}
 
 	return cfg
@@ -107,6 +115,16 @@ func (cfg *Config) init() error {
 			cfg.DataRoot = abs
 		}
 	}
+
+	if cfg.FileRoots == nil {
+		cfg.FileRoots = map[string]string{}
+	}
+	if cfg.FileRoots[types.DefaultFileEnv] == "" {
+		cfg.FileRoots[types.DefaultFileEnv] = filepath.Join(cfg.DataRoot, statesPath)
+	}
+	if cfg.KeepJobs == 0 {
+		cfg.KeepJobs = DefaultKeepJobs
+	}
 	return nil
 }
 
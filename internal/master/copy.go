@@ -0,0 +1,264 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package master
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	pb "github.com/vine-io/maco/api/rpc"
+	"github.com/vine-io/maco/api/types"
+)
+
+const (
+	// transfersPath 暂存 maco-cp 上传文件的目录
+	transfersPath = "transfers"
+	// defaultCopyTimeout 复制文件的默认超时时长，单位为秒
+	defaultCopyTimeout = 60
+)
+
+// newCopyID 生成复制请求的随机 id，作为暂存目录和临时环境的名称
+func newCopyID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validCopyPath 判断上传文件的路径是否为不包含 .. 的相对路径
+func validCopyPath(name string) bool {
+	if name == "" || path.IsAbs(name) || path.Clean(name) != name {
+		return false
+	}
+	return name != "." && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// validateCopyHeader 校验 CopyFile 请求的 header
+func validateCopyHeader(header *pb.CopyFileHeader) error {
+	if header == nil {
+		return apiErr.NewBadRequest("missing header of copy request")
+	}
+	sel := header.Selector
+	if sel == nil || (len(sel.Minions) == 0 && sel.Expression == "") {
+		return apiErr.NewBadRequest("missing selector")
+	}
+	if header.Dest == "" {
+		return apiErr.NewBadRequest("dest is required")
+	}
+	if len(header.Files) == 0 {
+		return apiErr.NewBadRequest("no files to copy")
+	}
+	if !header.Dir && (len(header.Files) != 1 || header.Files[0].IsDir) {
+		return apiErr.NewBadRequest("only one file can be copied without dir")
+	}
+
+	paths := make(map[string]struct{}, len(header.Files))
+	for _, file := range header.Files {
+		if !validCopyPath(file.Path) {
+			return apiErr.NewBadRequestf("invalid path %s", file.Path)
+		}
+		if _, ok := paths[file.Path]; ok {
+			return apiErr.NewBadRequestf("duplicate path %s", file.Path)
+		}
+		paths[file.Path] = struct{}{}
+		if !file.IsDir && file.Size < 0 {
+			return apiErr.NewBadRequestf("invalid size of %s", file.Path)
+		}
+	}
+	return nil
+}
+
+// stagedFile 正在接收的文件
+type stagedFile struct {
+	info    *types.FileInfo
+	fd      *os.File
+	hash    hash.Hash
+	written int64
+}
+
+// stageCopyFiles 接收 maco-cp 上传的文件分块并保存到 dir 中，接收完成后校验文件的大小和 sha256 值
+func stageCopyFiles(dir string, header *pb.CopyFileHeader, recv func() (*pb.CopyFileRequest, error)) error {
+	files := make(map[string]*stagedFile, len(header.Files))
+	defer func() {
+		for _, file := range files {
+			_ = file.fd.Close()
+		}
+	}()
+
+	for _, info := range header.Files {
+		name := filepath.Join(dir, filepath.FromSlash(info.Path))
+		if info.IsDir {
+			if err := os.MkdirAll(name, 0700); err != nil {
+				return apiErr.NewInternalf("create directory %s: %v", info.Path, err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			return apiErr.NewInternalf("create directory of %s: %v", info.Path, err)
+		}
+		fd, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return apiErr.NewInternalf("create file %s: %v", info.Path, err)
+		}
+		files[info.Path] = &stagedFile{info: info, fd: fd, hash: sha256.New()}
+	}
+
+	for {
+		req, err := recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		chunk := req.Chunk
+		if chunk == nil {
+			continue
+		}
+		file, ok := files[chunk.Path]
+		if !ok {
+			return apiErr.NewBadRequestf("unknown file %s", chunk.Path)
+		}
+		if chunk.Offset != file.written {
+			return apiErr.NewBadRequestf("unexpected offset %d of %s, want %d", chunk.Offset, chunk.Path, file.written)
+		}
+		if file.written+int64(len(chunk.Data)) > file.info.Size {
+			return apiErr.NewBadRequestf("file %s exceeds %d bytes", chunk.Path, file.info.Size)
+		}
+		if _, err = file.fd.Write(chunk.Data); err != nil {
+			return apiErr.NewInternalf("write file %s: %v", chunk.Path, err)
+		}
+		file.hash.Write(chunk.Data)
+		file.written += int64(len(chunk.Data))
+	}
+
+	for name, file := range files {
+		if file.written != file.info.Size {
+			return apiErr.NewBadRequestf("file %s is incomplete: %d of %d bytes", name, file.written, file.info.Size)
+		}
+		if sum := hex.EncodeToString(file.hash.Sum(nil)); sum != file.info.Hash {
+			return apiErr.NewBadRequestf("checksum of %s mismatch: %s != %s", name, sum, file.info.Hash)
+		}
+	}
+	return nil
+}
+
+// copyCall 返回 minion 从临时环境获取文件的请求，单个文件使用 cp.get_file，目录使用 cp.get_dir
+func copyCall(header *pb.CopyFileHeader, env string, targets []string) *types.CallRequest {
+	u := &types.FileURL{Env: env}
+	function := "cp.get_dir"
+	if !header.Dir {
+		function = "cp.get_file"
+		u.Path = header.Files[0].Path
+	}
+
+	args := []string{"url=" + u.String(), "dest=" + header.Dest}
+	if header.Mode != "" {
+		args = append(args, "mode="+header.Mode)
+	}
+	if header.User != "" {
+		args = append(args, "user="+header.User)
+	}
+	if header.Group != "" {
+		args = append(args, "group="+header.Group)
+	}
+	if header.Makedirs {
+		args = append(args, "makedirs=true")
+	}
+
+	timeout := header.Timeout
+	if timeout == 0 {
+		timeout = defaultCopyTimeout
+	}
+	call := &types.CallRequest{
+		Selector: &types.Selector{Minions: targets},
+		Function: function,
+		Args:     args,
+		Timeout:  timeout,
+		Test:     header.Test,
+	}
+	return call
+}
+
+// copyFiles 暂存上传的文件并挂载为只有目标 minion 可以访问的临时环境，等待 minion 获取文件后清理
+func (h *macoHandler) copyFiles(stream pb.MacoRPC_CopyFileServer) (*types.Report, error) {
+	req, err := stream.Recv()
+	if err != nil {
+		if err == io.EOF {
+			return nil, apiErr.NewBadRequest("missing header of copy request")
+		}
+		return nil, err
+	}
+	header := req.Header
+	if err = validateCopyHeader(header); err != nil {
+		return nil, err
+	}
+	targets, err := h.sch.selectMinions(header.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(targets) == 0 {
+		return nil, apiErr.NewBadRequest("no targets")
+	}
+
+	id, err := newCopyID()
+	if err != nil {
+		return nil, apiErr.NewInternalf("generate copy id: %v", err)
+	}
+	dir := filepath.Join(h.storage.dir, transfersPath, id)
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, apiErr.NewInternalf("create transfer directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	recv := func() (*pb.CopyFileRequest, error) { return stream.Recv() }
+	if err = stageCopyFiles(dir, header, recv); err != nil {
+		return nil, err
+	}
+
+	env := types.CopyEnvPrefix + id
+	if err = h.files.Mount(env, dir, targets); err != nil {
+		return nil, err
+	}
+	defer h.files.Unmount(env)
+
+	// 临时环境在请求结束后删除，任务无法重新执行，不保存到任务缓存
+	in := &Request{
+		Call:  copyCall(header, env, targets),
+		User:  callUser(stream.Context()),
+		NoJob: true,
+	}
+	out, err := h.sch.Handle(stream.Context(), in)
+	if err != nil {
+		return nil, err
+	}
+	return out.Report, nil
+}
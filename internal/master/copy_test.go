@@ -0,0 +1,141 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package master
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	pb "github.com/vine-io/maco/api/rpc"
+	"github.com/vine-io/maco/api/types"
+)
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// chunkRecv returns the recv function which returns the chunks and io.EOF at last
+func chunkRecv(chunks ...*pb.CopyFileChunk) func() (*pb.CopyFileRequest, error) {
+	return func() (*pb.CopyFileRequest, error) {
+		if len(chunks) == 0 {
+			return nil, io.EOF
+		}
+		chunk := chunks[0]
+		chunks = chunks[1:]
+		return &pb.CopyFileRequest{Chunk: chunk}, nil
+	}
+}
+
+func TestValidateCopyHeader(t *testing.T) {
+	file := &types.FileInfo{Path: "app.conf", Size: 1}
+	valid := &pb.CopyFileHeader{
+		Selector: &types.Selector{Expression: "web*"},
+		Dest:     "/etc/app.conf",
+		Files:    []*types.FileInfo{file},
+	}
+	assert.NoError(t, validateCopyHeader(valid))
+
+	bad := []*pb.CopyFileHeader{
+		nil,
+		{Dest: "/etc/app.conf", Files: []*types.FileInfo{file}},
+		{Selector: valid.Selector, Files: []*types.FileInfo{file}},
+		{Selector: valid.Selector, Dest: "/etc"},
+		{Selector: valid.Selector, Dest: "/etc", Files: []*types.FileInfo{file, {Path: "b"}}},
+		{Selector: valid.Selector, Dest: "/etc", Dir: true, Files: []*types.FileInfo{{Path: "../passwd"}}},
+		{Selector: valid.Selector, Dest: "/etc", Dir: true, Files: []*types.FileInfo{{Path: "/passwd"}}},
+		{Selector: valid.Selector, Dest: "/etc", Dir: true, Files: []*types.FileInfo{{Path: "a//b"}}},
+		{Selector: valid.Selector, Dest: "/etc", Dir: true, Files: []*types.FileInfo{file, file}},
+	}
+	for i, header := range bad {
+		err := validateCopyHeader(header)
+		assert.Equal(t, apiErr.Code_BadRequest, apiErr.Parse(err).Code, i)
+	}
+}
+
+func TestStageCopyFiles(t *testing.T) {
+	header := &pb.CopyFileHeader{
+		Dir: true,
+		Files: []*types.FileInfo{
+			{Path: "conf", IsDir: true},
+			{Path: "conf/app.conf", Size: 11, Hash: sha256Hex("hello world")},
+			{Path: "empty", Size: 0, Hash: sha256Hex("")},
+			{Path: "logs", IsDir: true},
+		},
+	}
+
+	dir := t.TempDir()
+	err := stageCopyFiles(dir, header, chunkRecv(
+		&pb.CopyFileChunk{Path: "conf/app.conf", Offset: 0, Data: []byte("hello ")},
+		&pb.CopyFileChunk{Path: "conf/app.conf", Offset: 6, Data: []byte("world")},
+	))
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "conf", "app.conf"))
+	assert.Equal(t, "hello world", string(data))
+	assert.FileExists(t, filepath.Join(dir, "empty"))
+	assert.DirExists(t, filepath.Join(dir, "logs"))
+
+	cases := map[string][]*pb.CopyFileChunk{
+		"unknown file": {{Path: "other", Data: []byte("x")}},
+		"bad offset":   {{Path: "conf/app.conf", Offset: 6, Data: []byte("world")}},
+		"exceeds size": {{Path: "conf/app.conf", Data: []byte("hello world!")}},
+		"incomplete":   {{Path: "conf/app.conf", Data: []byte("hello")}},
+		"checksum":     {{Path: "conf/app.conf", Data: []byte("hello WORLD")}},
+	}
+	for name, chunks := range cases {
+		err = stageCopyFiles(t.TempDir(), header, chunkRecv(chunks...))
+		assert.Equal(t, apiErr.Code_BadRequest, apiErr.Parse(err).Code, name)
+	}
+}
+
+func TestCopyCall(t *testing.T) {
+	header := &pb.CopyFileHeader{
+		Dest:     "/etc/app/",
+		Files:    []*types.FileInfo{{Path: "app.conf"}},
+		Mode:     "0640",
+		User:     "app",
+		Makedirs: true,
+	}
+	call := copyCall(header, "cp-01", []string{"web1", "web2"})
+	assert.Equal(t, "cp.get_file", call.Function)
+	assert.Equal(t, []string{"url=maco://app.conf?env=cp-01", "dest=/etc/app/", "mode=0640", "user=app", "makedirs=true"}, call.Args)
+	assert.Equal(t, []string{"web1", "web2"}, call.Selector.Minions)
+	assert.Equal(t, int64(defaultCopyTimeout), call.Timeout)
+
+	header.Dir = true
+	header.Timeout = 5
+	header.Test = true
+	call = copyCall(header, "cp-01", []string{"web1"})
+	assert.Equal(t, "cp.get_dir", call.Function)
+	assert.Equal(t, "url=maco://?env=cp-01", call.Args[0])
+	assert.Equal(t, int64(5), call.Timeout)
+	assert.True(t, call.Test)
+}
@@ -0,0 +1,358 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package fileserver serves the files of maco-master to minions.
+//
+// The files are grouped by environments, each environment is rooted at a directory,
+// e.g. base, dev and prod. The base environment is DataRoot/states by default, so the
+// state files and the files they manage live in the same tree. A file is addressed by
+// the url maco://<path>?env=<env>, the env defaults to base:
+//
+//	maco://nginx/nginx.conf
+//	maco://nginx/nginx.conf?env=prod
+//
+// The paths are confined to the root of environment, the symbolic links which point
+// outside of the root are rejected.
+//
+// Besides the configured environments, a transient environment can be mounted for the
+// given minions only, e.g. the files uploaded by maco-cp are staged in a directory and
+// mounted until the targets fetched them.
+package fileserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	"github.com/vine-io/maco/api/types"
+)
+
+const (
+	// DefaultChunkSize is the size of chunk when the download request does not specify it
+	DefaultChunkSize = 64 * 1024
+	// MaxChunkSize is the max size of chunk
+	MaxChunkSize = 4 * 1024 * 1024
+)
+
+// hashEntry caches the hash of file until the file is modified
+type hashEntry struct {
+	size    int64
+	modTime int64
+	hash    string
+}
+
+// Server serves the files of environments
+type Server struct {
+	rmu   sync.RWMutex
+	roots map[string]string
+	// the minions which are allowed to access the transient environments
+	allowed map[string]map[string]struct{}
+
+	mu     sync.Mutex
+	hashes map[string]*hashEntry
+}
+
+// New creates Server with the root directories of environments
+func New(roots map[string]string) *Server {
+	s := &Server{
+		roots:   make(map[string]string, len(roots)),
+		allowed: map[string]map[string]struct{}{},
+		hashes:  map[string]*hashEntry{},
+	}
+	for env, root := range roots {
+		s.roots[env] = filepath.Clean(root)
+	}
+	return s
+}
+
+// Envs returns the sorted names of environments, the transient environments are excluded
+func (s *Server) Envs() []string {
+	s.rmu.RLock()
+	defer s.rmu.RUnlock()
+	envs := make([]string, 0, len(s.roots))
+	for env := range s.roots {
+		if _, ok := s.allowed[env]; !ok {
+			envs = append(envs, env)
+		}
+	}
+	sort.Strings(envs)
+	return envs
+}
+
+// Root returns the root directory of environment, it is empty if the environment does not exist
+func (s *Server) Root(env string) string {
+	s.rmu.RLock()
+	defer s.rmu.RUnlock()
+	return s.roots[env]
+}
+
+// Mount adds the transient environment which can be accessed by the given minions only
+func (s *Server) Mount(env, root string, minions []string) error {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	if _, ok := s.roots[env]; ok {
+		return apiErr.NewConflictf("file environment %s already exists", env)
+	}
+	allowed := make(map[string]struct{}, len(minions))
+	for _, name := range minions {
+		allowed[name] = struct{}{}
+	}
+	s.roots[env] = filepath.Clean(root)
+	s.allowed[env] = allowed
+	return nil
+}
+
+// Unmount removes the transient environment, the configured environments are kept
+func (s *Server) Unmount(env string) {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	if _, ok := s.allowed[env]; !ok {
+		return
+	}
+	delete(s.roots, env)
+	delete(s.allowed, env)
+}
+
+// mounted reports whether the environment is transient
+func (s *Server) mounted(env string) bool {
+	s.rmu.RLock()
+	defer s.rmu.RUnlock()
+	_, ok := s.allowed[env]
+	return ok
+}
+
+// Allowed reports whether the minion can access the environment
+func (s *Server) Allowed(env, minion string) bool {
+	s.rmu.RLock()
+	defer s.rmu.RUnlock()
+	allowed, ok := s.allowed[env]
+	if !ok {
+		return true
+	}
+	_, ok = allowed[minion]
+	return ok
+}
+
+// resolve parses the file url and returns the local path of it
+func (s *Server) resolve(rawURL string) (*types.FileURL, string, error) {
+	u, err := types.ParseFileURL(rawURL)
+	if err != nil {
+		return nil, "", apiErr.NewBadRequest(err.Error())
+	}
+	root := s.Root(u.Env)
+	if root == "" {
+		return nil, "", apiErr.NewNotFoundf("file environment %s not found", u.Env)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, "", apiErr.NewInternalf("resolve root of environment %s: %v", u.Env, err)
+	}
+	name, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(u.Path)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", apiErr.NewNotFoundf("file %s not found", u)
+		}
+		return nil, "", apiErr.NewInternalf("resolve %s: %v", u, err)
+	}
+	if name != realRoot && !strings.HasPrefix(name, realRoot+string(filepath.Separator)) {
+		return nil, "", apiErr.NewForbiddenf("file %s is outside of environment %s", u, u.Env)
+	}
+	return u, name, nil
+}
+
+func fileInfo(env, name string, stat fs.FileInfo) *types.FileInfo {
+	info := &types.FileInfo{
+		Env:          env,
+		Path:         name,
+		Mode:         fmt.Sprintf("%04o", stat.Mode().Perm()),
+		ModTimestamp: stat.ModTime().Unix(),
+		IsDir:        stat.IsDir(),
+	}
+	if !stat.IsDir() {
+		info.Size = stat.Size()
+	}
+	return info
+}
+
+// hash returns the sha256 of file, the hash is cached until the size or the
+// modification time of file changed
+func (s *Server) hash(name string, stat fs.FileInfo) (string, error) {
+	s.mu.Lock()
+	entry, ok := s.hashes[name]
+	s.mu.Unlock()
+	if ok && entry.size == stat.Size() && entry.modTime == stat.ModTime().UnixNano() {
+		return entry.hash, nil
+	}
+
+	fd, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	s.mu.Lock()
+	s.hashes[name] = &hashEntry{size: stat.Size(), modTime: stat.ModTime().UnixNano(), hash: sum}
+	s.mu.Unlock()
+	return sum, nil
+}
+
+// Stat returns the information of file, the hash is the sha256 of file content
+func (s *Server) Stat(rawURL string) (*types.FileInfo, error) {
+	u, name, err := s.resolve(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(name)
+	if err != nil {
+		return nil, apiErr.NewInternalf("stat %s: %v", u, err)
+	}
+	info := fileInfo(u.Env, u.Path, stat)
+	if !stat.IsDir() {
+		if info.Hash, err = s.hash(name, stat); err != nil {
+			return nil, apiErr.NewInternalf("hash %s: %v", u, err)
+		}
+	}
+	return info, nil
+}
+
+// List returns the files in the directory, the subdirectories are walked if recursive is true.
+// The hidden files whose names start with '.' are skipped except in the transient environments.
+// A file url returns the file itself.
+func (s *Server) List(rawURL string, recursive bool) ([]*types.FileInfo, error) {
+	u, dir, err := s.resolve(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return nil, apiErr.NewInternalf("stat %s: %v", u, err)
+	}
+	if !stat.IsDir() {
+		return []*types.FileInfo{fileInfo(u.Env, u.Path, stat)}, nil
+	}
+
+	hidden := s.mounted(u.Env)
+	out := make([]*types.FileInfo, 0)
+	err = filepath.WalkDir(dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == dir {
+			return nil
+		}
+		if !hidden && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, name)
+		out = append(out, fileInfo(u.Env, path.Join(u.Path, filepath.ToSlash(rel)), stat))
+		if d.IsDir() && !recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, apiErr.NewInternalf("list %s: %v", u, err)
+	}
+	return out, nil
+}
+
+// Open opens the file for download, the returned FileInfo contains the hash
+func (s *Server) Open(rawURL string) (*os.File, *types.FileInfo, error) {
+	info, err := s.Stat(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if info.IsDir {
+		return nil, nil, apiErr.NewBadRequestf("%s is a directory", rawURL)
+	}
+	_, name, err := s.resolve(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd, err := os.Open(name)
+	if err != nil {
+		return nil, nil, apiErr.NewInternalf("open %s: %v", rawURL, err)
+	}
+	return fd, info, nil
+}
+
+// Download reads the file from offset and sends the chunks by send, the first chunk
+// carries the FileInfo. An empty file is sent as one empty chunk.
+func (s *Server) Download(rawURL string, offset int64, chunkSize int, send func(info *types.FileInfo, offset int64, data []byte) error) error {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	if chunkSize > MaxChunkSize {
+		chunkSize = MaxChunkSize
+	}
+	fd, info, err := s.Open(rawURL)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	if offset < 0 || offset > info.Size {
+		return apiErr.NewBadRequestf("invalid offset %d of %s", offset, rawURL)
+	}
+	if _, err = fd.Seek(offset, io.SeekStart); err != nil {
+		return apiErr.NewInternalf("seek %s: %v", rawURL, err)
+	}
+
+	buf := make([]byte, chunkSize)
+	first := info
+	for {
+		n, rErr := io.ReadFull(fd, buf)
+		if n > 0 || first != nil {
+			if err = send(first, offset, buf[:n]); err != nil {
+				return err
+			}
+			first = nil
+			offset += int64(n)
+		}
+		if rErr == io.EOF || rErr == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if rErr != nil {
+			return apiErr.NewInternalf("read %s: %v", rawURL, rErr)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package fileserver
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/pkg/pemutil"
+)
+
+func newTestServer(t *testing.T) (*Server, string) {
+	base := t.TempDir()
+	prod := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(base, "nginx", "conf.d"), 0755)
+	_ = os.MkdirAll(filepath.Join(base, ".git"), 0755)
+	_ = os.WriteFile(filepath.Join(base, "nginx", "nginx.conf"), []byte("worker_processes 1;\n"), 0644)
+	_ = os.WriteFile(filepath.Join(base, "nginx", "conf.d", "default.conf"), []byte("server {}\n"), 0600)
+	_ = os.WriteFile(filepath.Join(base, "nginx", ".swp"), []byte("x"), 0644)
+	_ = os.WriteFile(filepath.Join(base, ".git", "HEAD"), []byte("ref"), 0644)
+	_ = os.WriteFile(filepath.Join(base, "empty"), nil, 0644)
+	_ = os.WriteFile(filepath.Join(prod, "nginx.conf"), []byte("worker_processes 8;\n"), 0644)
+
+	outside := filepath.Join(t.TempDir(), "secret")
+	_ = os.WriteFile(outside, []byte("secret"), 0600)
+	_ = os.Symlink(outside, filepath.Join(base, "escape"))
+
+	return New(map[string]string{"base": base, "prod": prod}), base
+}
+
+func TestFileURL(t *testing.T) {
+	u, err := types.ParseFileURL("maco://nginx/nginx.conf?env=prod")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "prod", u.Env)
+		assert.Equal(t, "nginx/nginx.conf", u.Path)
+		assert.Equal(t, "maco://nginx/nginx.conf?env=prod", u.String())
+	}
+	u, err = types.ParseFileURL("maco:///nginx//sites enabled/")
+	if assert.NoError(t, err) {
+		assert.Equal(t, types.DefaultFileEnv, u.Env)
+		assert.Equal(t, "nginx/sites enabled", u.Path)
+		assert.Equal(t, "maco://nginx/sites enabled", u.String())
+	}
+
+	for _, bad := range []string{"/etc/hosts", "file:///etc/hosts", "maco://../etc/passwd", "maco://a/../../b"} {
+		_, err = types.ParseFileURL(bad)
+		assert.Error(t, err, bad)
+	}
+	assert.True(t, types.IsFileURL("maco://top.sls"))
+	assert.False(t, types.IsFileURL("/srv/top.sls"))
+}
+
+func TestFileAuth(t *testing.T) {
+	pair, err := pemutil.GenerateRSA(2048, "test")
+	if !assert.NoError(t, err) {
+		return
+	}
+	url := "maco://app.conf?env=cp-01"
+	auth, err := types.NewFileAuth("web1", types.FileMethodDownload, url, pair.Private)
+	if !assert.NoError(t, err) {
+		return
+	}
+	now := time.Unix(auth.Timestamp, 0)
+	assert.NoError(t, types.VerifyFileAuth(auth, types.FileMethodDownload, url, pair.Public, now))
+	assert.Error(t, types.VerifyFileAuth(auth, types.FileMethodDownload, url, pair.Public, now.Add(types.FileAuthExpiration+time.Second)))
+
+	// 凭证只能用于签名时的方法和文件地址
+	assert.Error(t, types.VerifyFileAuth(auth, types.FileMethodList, url, pair.Public, now))
+	assert.Error(t, types.VerifyFileAuth(auth, types.FileMethodDownload, "maco://other.conf?env=cp-01", pair.Public, now))
+
+	forged := &types.FileAuth{Minion: "web2", Timestamp: auth.Timestamp, Nonce: auth.Nonce, Signature: auth.Signature}
+	assert.Error(t, types.VerifyFileAuth(forged, types.FileMethodDownload, url, pair.Public, now))
+	forged = &types.FileAuth{Minion: auth.Minion, Timestamp: auth.Timestamp, Nonce: "other", Signature: auth.Signature}
+	assert.Error(t, types.VerifyFileAuth(forged, types.FileMethodDownload, url, pair.Public, now))
+
+	other, _ := types.NewFileAuth("web1", types.FileMethodDownload, url, pair.Private)
+	assert.NotEqual(t, auth.Nonce, other.Nonce)
+}
+
+func TestServerStat(t *testing.T) {
+	s, _ := newTestServer(t)
+	assert.Equal(t, []string{"base", "prod"}, s.Envs())
+
+	info, err := s.Stat("maco://nginx/nginx.conf")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "base", info.Env)
+		assert.Equal(t, "nginx/nginx.conf", info.Path)
+		assert.Equal(t, int64(20), info.Size)
+		assert.Equal(t, "0644", info.Mode)
+		assert.Len(t, info.Hash, 64)
+	}
+	prod, err := s.Stat("maco://nginx.conf?env=prod")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "prod", prod.Env)
+		assert.NotEqual(t, info.Hash, prod.Hash)
+	}
+
+	_, err = s.Stat("maco://missing")
+	assert.True(t, apiErr.IsNotFound(err))
+	_, err = s.Stat("maco://nginx.conf?env=dev")
+	assert.True(t, apiErr.IsNotFound(err))
+	_, err = s.Stat("maco://escape")
+	assert.True(t, apiErr.IsForbidden(err))
+	_, err = s.Stat("maco://../etc/passwd")
+	assert.Equal(t, apiErr.Code_BadRequest, apiErr.Parse(err).Code)
+}
+
+func TestServerList(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	paths := func(files []*types.FileInfo) []string {
+		out := make([]string, 0, len(files))
+		for _, file := range files {
+			out = append(out, file.Path)
+		}
+		return out
+	}
+
+	files, err := s.List("maco://nginx", false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"nginx/conf.d", "nginx/nginx.conf"}, paths(files))
+		assert.True(t, files[0].IsDir)
+	}
+	files, err = s.List("maco://", true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"empty", "escape", "nginx", "nginx/conf.d", "nginx/conf.d/default.conf", "nginx/nginx.conf"}, paths(files))
+	}
+	files, err = s.List("maco://nginx/nginx.conf", true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"nginx/nginx.conf"}, paths(files))
+	}
+}
+
+func TestServerDownload(t *testing.T) {
+	s, base := newTestServer(t)
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	_ = os.WriteFile(filepath.Join(base, "data"), content, 0644)
+
+	download := func(url string, offset int64, chunkSize int) ([]int64, []byte, *types.FileInfo, error) {
+		offsets := make([]int64, 0)
+		buf := bytes.NewBuffer(nil)
+		var info *types.FileInfo
+		err := s.Download(url, offset, chunkSize, func(file *types.FileInfo, offset int64, data []byte) error {
+			if file != nil {
+				info = file
+			}
+			offsets = append(offsets, offset)
+			buf.Write(data)
+			return nil
+		})
+		return offsets, buf.Bytes(), info, err
+	}
+
+	offsets, data, info, err := download("maco://data", 0, 32)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{0, 32, 64, 96}, offsets)
+		assert.Equal(t, content, data)
+		assert.Equal(t, int64(100), info.Size)
+	}
+
+	offsets, data, _, err = download("maco://data", 90, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{90}, offsets)
+		assert.Equal(t, content[90:], data)
+	}
+
+	offsets, data, info, err = download("maco://empty", 0, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int64{0}, offsets)
+		assert.Empty(t, data)
+		assert.NotNil(t, info)
+	}
+
+	_, _, _, err = download("maco://data", 101, 0)
+	assert.Equal(t, apiErr.Code_BadRequest, apiErr.Parse(err).Code)
+	_, _, _, err = download("maco://nginx", 0, 0)
+	assert.Equal(t, apiErr.Code_BadRequest, apiErr.Parse(err).Code)
+	_, _, _, err = download("maco://escape", 0, 0)
+	assert.True(t, apiErr.IsForbidden(err))
+}
+
+func TestServerMount(t *testing.T) {
+	s, _ := newTestServer(t)
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, ".env"), []byte("KEY=1"), 0600)
+
+	if !assert.NoError(t, s.Mount("cp-01", dir, []string{"web1"})) {
+		return
+	}
+	assert.Equal(t, []string{"base", "prod"}, s.Envs())
+	assert.True(t, s.Allowed("cp-01", "web1"))
+	assert.False(t, s.Allowed("cp-01", "web2"))
+	assert.True(t, s.Allowed("base", "web2"))
+
+	// the hidden files are listed in the transient environments
+	files, err := s.List("maco://?env=cp-01", true)
+	if assert.NoError(t, err) && assert.Len(t, files, 1) {
+		assert.Equal(t, ".env", files[0].Path)
+	}
+
+	err = s.Mount("base", dir, nil)
+	assert.True(t, apiErr.IsConflict(err))
+
+	s.Unmount("cp-01")
+	_, err = s.Stat("maco://.env?env=cp-01")
+	assert.True(t, apiErr.IsNotFound(err))
+	s.Unmount("base")
+	assert.NotEmpty(t, s.Root("base"))
+}
@@ -27,6 +27,8 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"path"
+	"sort"
 	"strings"
 	"time"
 
@@ -40,11 +42,13 @@ import (
 	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 
 	apiErr "github.com/vine-io/maco/api/errors"
 	pb "github.com/vine-io/maco/api/rpc"
 	"github.com/vine-io/maco/api/types"
 	"github.com/vine-io/maco/docs"
+	"github.com/vine-io/maco/internal/master/fileserver"
 )
 
 type options struct {
@@ -52,20 +56,11 @@ type options struct {
 	cfg       *Config
 	storage   *Storage
 	scheduler *Scheduler
+	files     *fileserver.Server
 }
 
-func registerRPCHandler(ctx context.Context, opt *options) (http.Handler, error) {
-	cfg := opt.cfg
-
-	macoHl, err := newMacoHandler(ctx, opt.storage, opt.scheduler)
-	if err != nil {
-		return nil, fmt.Errorf("setup maco handler: %w", err)
-	}
-	internalHl, err := newInternalHandler(ctx, cfg, opt.storage, opt.scheduler)
-	if err != nil {
-		return nil, fmt.Errorf("setup internal handler: %w", err)
-	}
-
+// serverOptions 返回 grpc 服务的参数
+func serverOptions() []grpc.ServerOption {
 	kaep := keepalive.EnforcementPolicy{
 		MinTime:             5 * time.Second,
 		PermitWithoutStream: true,
@@ -78,12 +73,29 @@ func registerRPCHandler(ctx context.Context, opt *options) (http.Handler, error)
 		Timeout:               3 * time.Second,
 	}
 
-	sopts := []grpc.ServerOption{
+	return []grpc.ServerOption{
 		//grpc.UnaryInterceptor(interceptor),
 		grpc.KeepaliveEnforcementPolicy(kaep),
 		grpc.KeepaliveParams(kasp),
+		// minion 返回的执行结果可能超过默认的 4 MiB
+		grpc.MaxRecvMsgSize(types.MaxMessageSize),
+		grpc.MaxSendMsgSize(types.MaxMessageSize),
+	}
+}
+
+func registerRPCHandler(ctx context.Context, opt *options) (http.Handler, error) {
+	cfg := opt.cfg
+
+	macoHl, err := newMacoHandler(ctx, opt.storage, opt.scheduler, opt.files)
+	if err != nil {
+		return nil, fmt.Errorf("setup maco handler: %w", err)
+	}
+	internalHl, err := newInternalHandler(ctx, cfg, opt.storage, opt.scheduler, opt.files)
+	if err != nil {
+		return nil, fmt.Errorf("setup internal handler: %w", err)
 	}
-	gs := grpc.NewServer(sopts...)
+
+	gs := grpc.NewServer(serverOptions()...)
 
 	muxOpts := []gwrt.ServeMuxOption{}
 	gwmux := gwrt.NewServeMux(muxOpts...)
@@ -139,13 +151,15 @@ type macoHandler struct {
 
 	storage *Storage
 	sch     *Scheduler
+	files   *fileserver.Server
 }
 
-func newMacoHandler(ctx context.Context, storage *Storage, sch *Scheduler) (pb.MacoRPCServer, error) {
+func newMacoHandler(ctx context.Context, storage *Storage, sch *Scheduler, files *fileserver.Server) (pb.MacoRPCServer, error) {
 	handler := &macoHandler{
 		ctx:     ctx,
 		storage: storage,
 		sch:     sch,
+		files:   files,
 	}
 	return handler, nil
 }
@@ -197,6 +211,88 @@ func (h *macoHandler) GetMinion(ctx context.Context, req *pb.GetMinionRequest) (
 	return rsp, nil
 }
 
+func (h *macoHandler) GetGrains(ctx context.Context, req *pb.GetGrainsRequest) (*pb.GetGrainsResponse, error) {
+	if _, err := h.storage.getMinion(req.Name); err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+	grains, err := h.minionGrains(req.Name, req.Keys)
+	if err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+	rsp := &pb.GetGrainsResponse{
+		Grains: grains,
+	}
+	return rsp, nil
+}
+
+func (h *macoHandler) ListGrains(ctx context.Context, req *pb.ListGrainsRequest) (*pb.ListGrainsResponse, error) {
+	var minions []string
+	if len(req.Minions) == 0 && len(req.Expression) == 0 {
+		accepts, _ := h.storage.GetMinions(types.Accepted)
+		autos, _ := h.storage.GetMinions(types.AutoSign)
+		minions = append(accepts, autos...)
+		sort.Strings(minions)
+	} else {
+		var err error
+		minions, err = h.sch.selectMinions(&types.Selector{Minions: req.Minions, Expression: req.Expression})
+		if err != nil {
+			return nil, apiErr.Parse(err).ToStatus().Err()
+		}
+	}
+
+	rsp := &pb.ListGrainsResponse{
+		Grains: make([]*pb.MinionGrains, 0, len(minions)),
+	}
+	for _, name := range minions {
+		grains, err := h.minionGrains(name, req.Keys)
+		if err != nil {
+			return nil, apiErr.Parse(err).ToStatus().Err()
+		}
+		rsp.Grains = append(rsp.Grains, grains)
+	}
+	return rsp, nil
+}
+
+// minionGrains 读取 minion 缓存的 grains，minion 没有上报 grains 时返回空文档
+func (h *macoHandler) minionGrains(name string, keys []string) (*pb.MinionGrains, error) {
+	out := &pb.MinionGrains{
+		Name:   name,
+		Online: h.sch.isOnline(name),
+	}
+
+	doc, err := h.storage.GetGrains(name, keys)
+	if err != nil {
+		if !apiErr.IsNotFound(err) {
+			return nil, err
+		}
+		doc = map[string]any{}
+	}
+	out.Grains, err = structpb.NewStruct(doc)
+	if err != nil {
+		return nil, apiErr.NewInternalf("convert grains of %s: %v", name, err)
+	}
+	return out, nil
+}
+
+func (h *macoHandler) RenderPillar(ctx context.Context, req *pb.RenderPillarRequest) (*pb.RenderPillarResponse, error) {
+	if _, err := h.storage.getMinion(req.Name); err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+	data, sources, err := h.sch.compilePillar(req.Name)
+	if err != nil {
+		return nil, apiErr.NewInternalf("compile pillar of %s: %v", req.Name, err).ToStatus().Err()
+	}
+	out, err := structpb.NewStruct(data)
+	if err != nil {
+		return nil, apiErr.NewInternalf("convert pillar of %s: %v", req.Name, err).ToStatus().Err()
+	}
+	rsp := &pb.RenderPillarResponse{
+		Pillar:  out,
+		Sources: sources,
+	}
+	return rsp, nil
+}
+
 func (h *macoHandler) AcceptMinion(ctx context.Context, req *pb.AcceptMinionRequest) (*pb.AcceptMinionResponse, error) {
 	targets := make([]string, 0)
 	if req.All {
@@ -342,7 +438,9 @@ func (h *macoHandler) Call(ctx context.Context, req *pb.CallRequest) (*pb.CallRe
 		req.Request.Timeout = 10
 	}
 	in := &Request{
-		Call: req.Request,
+		Call:  req.Request,
+		User:  callUser(ctx),
+		NoJob: req.NoJob,
 	}
 	out, err := h.sch.Handle(ctx, in)
 	if err != nil {
@@ -355,6 +453,129 @@ func (h *macoHandler) Call(ctx context.Context, req *pb.CallRequest) (*pb.CallRe
 	return rsp, nil
 }
 
+func (h *macoHandler) CallAsync(ctx context.Context, req *pb.CallAsyncRequest) (*pb.CallAsyncResponse, error) {
+	if req.Request == nil {
+		return nil, apiErr.NewBadRequest("missing request").ToStatus().Err()
+	}
+	if req.Request.Timeout == 0 {
+		req.Request.Timeout = 10
+	}
+	in := &Request{
+		Call: req.Request,
+		User: callUser(ctx),
+	}
+	job, err := h.sch.HandleAsync(in)
+	if err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+
+	rsp := &pb.CallAsyncResponse{
+		Jid:     job.Jid,
+		Targets: job.Targets,
+	}
+	return rsp, nil
+}
+
+func (h *macoHandler) GetJob(ctx context.Context, req *pb.GetJobRequest) (*pb.GetJobResponse, error) {
+	job, err := h.sch.jobs.Get(req.Jid)
+	if err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+
+	rsp := &pb.GetJobResponse{
+		Job: job,
+	}
+	return rsp, nil
+}
+
+func (h *macoHandler) LookupJob(ctx context.Context, req *pb.LookupJobRequest) (*pb.LookupJobResponse, error) {
+	job, err := h.sch.jobs.Get(req.Jid)
+	if err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+
+	report := &types.Report{
+		Items: job.Items,
+		Jid:   job.Jid,
+	}
+	summarize(report)
+	rsp := &pb.LookupJobResponse{
+		Report:  report,
+		State:   job.State,
+		Missing: job.Missing(),
+	}
+	return rsp, nil
+}
+
+func (h *macoHandler) ListJobs(ctx context.Context, req *pb.ListJobsRequest) (*pb.ListJobsResponse, error) {
+	filter := &jobFilter{
+		function: req.Function,
+		minion:   req.Minion,
+		user:     req.User,
+		result:   types.JobResult(req.Result),
+		offset:   req.Offset,
+		limit:    req.Limit,
+	}
+	if req.Start > 0 {
+		filter.start = time.Unix(req.Start, 0)
+	}
+	if req.End > 0 {
+		filter.end = time.Unix(req.End, 0)
+	}
+	if _, err := path.Match(filter.function, ""); err != nil {
+		return nil, apiErr.NewBadRequestf("invalid function pattern %s", filter.function).ToStatus().Err()
+	}
+	switch filter.result {
+	case "", types.JobSuccess, types.JobFailed:
+	default:
+		return nil, apiErr.NewBadRequestf("invalid result %s, expected %s or %s", filter.result, types.JobSuccess, types.JobFailed).ToStatus().Err()
+	}
+	if filter.offset < 0 || filter.limit < 0 {
+		return nil, apiErr.NewBadRequest("offset and limit must not be negative").ToStatus().Err()
+	}
+	if filter.limit == 0 {
+		filter.limit = defaultListJobs
+	}
+	if filter.limit > maxListJobs {
+		filter.limit = maxListJobs
+	}
+
+	jobs, total, err := h.sch.jobs.List(filter)
+	if err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+
+	rsp := &pb.ListJobsResponse{
+		Jobs:  jobs,
+		Total: total,
+	}
+	return rsp, nil
+}
+
+func (h *macoHandler) KillJob(ctx context.Context, req *pb.KillJobRequest) (*pb.KillJobResponse, error) {
+	minions, err := h.sch.Kill(req.Jid)
+	if err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+
+	rsp := &pb.KillJobResponse{
+		Minions: minions,
+	}
+	return rsp, nil
+}
+
+func (h *macoHandler) CopyFile(stream pb.MacoRPC_CopyFileServer) error {
+	report, err := h.copyFiles(stream)
+	if err != nil {
+		return apiErr.Parse(err).ToStatus().Err()
+	}
+
+	rsp := &pb.CopyFileResponse{
+		Report: report,
+	}
+	return stream.SendAndClose(rsp)
+}
+
 type internalHandler struct {
 	pb.UnimplementedInternalRPCServer
 
@@ -363,15 +584,20 @@ type internalHandler struct {
 
 	storage *Storage
 	sch     *Scheduler
+	files   *fileserver.Server
+	// 已使用的文件服务器凭证 nonce，防止凭证被重放
+	nonces *nonceCache
 }
 
-func newInternalHandler(ctx context.Context, cfg *Config, storage *Storage, sch *Scheduler) (pb.InternalRPCServer, error) {
+func newInternalHandler(ctx context.Context, cfg *Config, storage *Storage, sch *Scheduler, files *fileserver.Server) (pb.InternalRPCServer, error) {
 
 	handler := &internalHandler{
 		ctx:     ctx,
 		cfg:     cfg,
 		storage: storage,
 		sch:     sch,
+		files:   files,
+		nonces:  newNonceCache(),
 	}
 
 	return handler, nil
@@ -440,3 +666,80 @@ func (h *internalHandler) Dispatch(stream pb.InternalRPC_DispatchServer) error {
 
 	return nil
 }
+
+// authFile 校验 minion 访问文件服务器的凭证，凭证只能用于签名时的方法和文件地址，并且只能使用一次。
+// 只有已接受的 minion 可以访问，临时环境只允许指定的 minion 访问
+func (h *internalHandler) authFile(auth *types.FileAuth, method, rawURL string) error {
+	if auth == nil || auth.Minion == "" {
+		return apiErr.NewUnauthorized("missing file auth")
+	}
+	key, err := h.storage.GetMinion(auth.Minion)
+	if err != nil {
+		return apiErr.NewUnauthorizedf("minion %s not found", auth.Minion)
+	}
+	state := types.MinionState(key.State)
+	if state != types.Accepted && state != types.AutoSign {
+		return apiErr.NewForbiddenf("minion %s is not accepted", auth.Minion)
+	}
+	now := time.Now()
+	if err = types.VerifyFileAuth(auth, method, rawURL, key.PubKey, now); err != nil {
+		return apiErr.NewUnauthorized(err.Error())
+	}
+	if !h.nonces.use(auth.Minion, auth.Nonce, now) {
+		return apiErr.NewUnauthorizedf("file auth of %s is already used", auth.Minion)
+	}
+	u, err := types.ParseFileURL(rawURL)
+	if err != nil {
+		return apiErr.NewBadRequest(err.Error())
+	}
+	if !h.files.Allowed(u.Env, auth.Minion) {
+		return apiErr.NewForbiddenf("minion %s is not allowed to access file environment %s", auth.Minion, u.Env)
+	}
+	return nil
+}
+
+func (h *internalHandler) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	if err := h.authFile(req.Auth, types.FileMethodList, req.Url); err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+	files, err := h.files.List(req.Url, req.Recursive)
+	if err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+	rsp := &pb.ListFilesResponse{
+		Files: files,
+	}
+	return rsp, nil
+}
+
+func (h *internalHandler) StatFile(ctx context.Context, req *pb.StatFileRequest) (*pb.StatFileResponse, error) {
+	if err := h.authFile(req.Auth, types.FileMethodStat, req.Url); err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+	file, err := h.files.Stat(req.Url)
+	if err != nil {
+		return nil, apiErr.Parse(err).ToStatus().Err()
+	}
+	rsp := &pb.StatFileResponse{
+		File: file,
+	}
+	return rsp, nil
+}
+
+func (h *internalHandler) DownloadFile(req *pb.DownloadFileRequest, stream pb.InternalRPC_DownloadFileServer) error {
+	if err := h.authFile(req.Auth, types.FileMethodDownload, req.Url); err != nil {
+		return apiErr.Parse(err).ToStatus().Err()
+	}
+	err := h.files.Download(req.Url, req.Offset, int(req.ChunkSize), func(info *types.FileInfo, offset int64, data []byte) error {
+		rsp := &pb.DownloadFileResponse{
+			File:   info,
+			Offset: offset,
+			Data:   data,
+		}
+		return stream.Send(rsp)
+	})
+	if err != nil {
+		return apiErr.Parse(err).ToStatus().Err()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package master
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/client"
+)
+
+// echoService echoes the bytes back, it checks the message size limits of both ends
+var echoService = grpc.ServiceDesc{
+	ServiceName: "maco.test.Echo",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Echo",
+			Handler: func(_ any, _ context.Context, dec func(any) error, _ grpc.UnaryServerInterceptor) (any, error) {
+				in := &wrapperspb.BytesValue{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+				return in, nil
+			},
+		},
+	},
+}
+
+func echo(t *testing.T, opts []grpc.ServerOption, payload []byte) ([]byte, error) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return nil, err
+	}
+	gs := grpc.NewServer(opts...)
+	gs.RegisterService(&echoService, struct{}{})
+	go func() { _ = gs.Serve(lis) }()
+	defer gs.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(),
+		grpc.WithTransportCredentials(insecure.NewCredentials()), client.WithMaxMessageSize())
+	if !assert.NoError(t, err) {
+		return nil, err
+	}
+	defer conn.Close()
+
+	out := &wrapperspb.BytesValue{}
+	err = conn.Invoke(context.TODO(), "/maco.test.Echo/Echo", wrapperspb.Bytes(payload), out)
+	return out.GetValue(), err
+}
+
+func TestMessageSize(t *testing.T) {
+	// larger than the default 4 MiB limit of grpc
+	payload := bytes.Repeat([]byte("a"), 5*1024*1024)
+
+	out, err := echo(t, serverOptions(), payload)
+	if assert.NoError(t, err) {
+		assert.Equal(t, payload, out)
+	}
+
+	_, err = echo(t, nil, payload)
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+}
+
+func TestNonceCache(t *testing.T) {
+	c := newNonceCache()
+	now := time.Now()
+	assert.True(t, c.use("web1", "n1", now))
+	assert.False(t, c.use("web1", "n1", now.Add(time.Minute)))
+	assert.True(t, c.use("web2", "n1", now))
+
+	// 过期的 nonce 被清理，此时签名时间也已过期
+	later := now.Add(2*types.FileAuthExpiration + time.Second)
+	assert.True(t, c.use("web1", "n1", later))
+	assert.Len(t, c.seen, 1)
+}
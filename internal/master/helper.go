@@ -22,12 +22,18 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package master
 
 import (
+	"context"
 	"net/http"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/vine-io/maco/api/types"
 )
 
 func grpcWithHttp(gh *grpc.Server, hh http.Handler) http.Handler {
@@ -40,3 +46,46 @@ func grpcWithHttp(gh *grpc.Server, hh http.Handler) http.Handler {
 		}
 	}), h2s)
 }
+
+// callUser 返回请求 metadata 中提交任务的用户，未指定时返回空。
+// master 没有认证客户端身份，该值由客户端自行上报，只记录在任务缓存中用于审计参考
+func callUser(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get(types.UserMetadataKey)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// nonceCache 记录有效期内已使用的文件服务器凭证 nonce
+type nonceCache struct {
+	mu sync.Mutex
+	// minion/nonce 到过期时间的映射
+	seen map[string]time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// use 记录 minion 使用的 nonce，nonce 已被使用时返回 false。
+// 签名时间允许前后偏差 types.FileAuthExpiration，nonce 需要保留两倍的有效期
+func (c *nonceCache) use(minion, nonce string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, expired := range c.seen {
+		if now.After(expired) {
+			delete(c.seen, key)
+		}
+	}
+	key := minion + "/" + nonce
+	if _, ok := c.seen[key]; ok {
+		return false
+	}
+	c.seen[key] = now.Add(2 * types.FileAuthExpiration)
+	return true
+}
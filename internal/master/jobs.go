@@ -0,0 +1,488 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package master
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/master/pillar"
+	"github.com/vine-io/maco/pkg/fsutil"
+)
+
+const (
+	jobsPath = "jobs"
+	// jobFile 任务信息和请求
+	jobFile = "job.json"
+	// jobMinionsPath 每个 minion 的执行结果
+	jobMinionsPath = "minions"
+	// jidLayout 任务 id 中 UTC 时间的格式，之后是 6 位微秒
+	jidLayout = "20060102150405"
+
+	// DefaultKeepJobs 任务缓存默认保留的小时数
+	DefaultKeepJobs = 24
+	// jobCompactInterval 清理过期任务的间隔
+	jobCompactInterval = 10 * time.Minute
+	// defaultListJobs 任务列表默认返回的数量
+	defaultListJobs = 50
+	// maxListJobs 任务列表最多返回的数量
+	maxListJobs = 1000
+)
+
+// JobStore 任务缓存，每个任务保存在 DataRoot/jobs/<jid> 目录中，
+// job.json 保存任务信息，minions/<minion>.json 保存每个 minion 的执行结果
+type JobStore struct {
+	dir string
+	// 任务保留的时长，为 0 时不清理
+	retention time.Duration
+
+	mu sync.Mutex
+	// 上一个任务 id 的时间，单位为微秒
+	lastMicro int64
+}
+
+func newJobStore(dir string, retention time.Duration) (*JobStore, error) {
+	if err := fsutil.LoadDir(dir); err != nil {
+		return nil, err
+	}
+	store := &JobStore{
+		dir:       dir,
+		retention: retention,
+	}
+	if err := store.recover(time.Now()); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// recover 将 master 重启前未结束的任务标记为结束
+func (s *JobStore) recover(now time.Time) error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err = jidTime(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		data, err := fsutil.Cat(filepath.Join(s.dir, entry.Name(), jobFile))
+		if err != nil {
+			continue
+		}
+		job := &types.Job{}
+		if err = json.Unmarshal(data, job); err != nil || job.State != types.JobRunning.String() {
+			continue
+		}
+		job.State = types.JobDone.String()
+		job.EndTimestamp = now.Unix()
+		if err = s.Save(job); err != nil {
+			return fmt.Errorf("recover job %s: %w", job.Jid, err)
+		}
+	}
+	return nil
+}
+
+// NewJID 根据当前的 UTC 时间生成任务 id，如: 20250101120000123456，生成的 id 保证递增，不受夏令时影响
+func (s *JobStore) NewJID() string {
+	micro := time.Now().UnixMicro()
+
+	s.mu.Lock()
+	if micro <= s.lastMicro {
+		micro = s.lastMicro + 1
+	}
+	s.lastMicro = micro
+	s.mu.Unlock()
+
+	t := time.UnixMicro(micro).UTC()
+	return t.Format(jidLayout) + fmt.Sprintf("%06d", t.Nanosecond()/1000)
+}
+
+// jidTime 解析任务 id 中的 UTC 时间
+func jidTime(jid string) (time.Time, error) {
+	if len(jid) != len(jidLayout)+6 || strings.Trim(jid, "0123456789") != "" {
+		return time.Time{}, fmt.Errorf("invalid jid %s", jid)
+	}
+	t, err := time.ParseInLocation(jidLayout, jid[:len(jidLayout)], time.UTC)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid jid %s", jid)
+	}
+	micro, _ := strconv.Atoi(jid[len(jidLayout):])
+	return t.Add(time.Duration(micro) * time.Microsecond), nil
+}
+
+func (s *JobStore) jobDir(jid string) (string, error) {
+	if _, err := jidTime(jid); err != nil {
+		return "", apiErr.NewBadRequest(err.Error())
+	}
+	return filepath.Join(s.dir, jid), nil
+}
+
+// Save 保存任务信息，任务的执行结果通过 AddItem 单独保存
+func (s *JobStore) Save(job *types.Job) error {
+	dir, err := s.jobDir(job.Jid)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Join(dir, jobMinionsPath), 0700); err != nil {
+		return err
+	}
+
+	// 执行结果单独保存
+	record := &types.Job{
+		Jid:            job.Jid,
+		Request:        job.Request,
+		Targets:        job.Targets,
+		User:           job.User,
+		StartTimestamp: job.StartTimestamp,
+		EndTimestamp:   job.EndTimestamp,
+		State:          job.State,
+	}
+	data, err := json.MarshalIndent(record, "", " ")
+	if err != nil {
+		return fmt.Errorf("marshal job %s: %w", job.Jid, err)
+	}
+	return fsutil.Echo(filepath.Join(dir, jobFile), data, 0600)
+}
+
+// AddItem 保存 minion 的执行结果
+func (s *JobStore) AddItem(jid string, item *types.ReportItem) error {
+	dir, err := s.jobDir(jid)
+	if err != nil {
+		return err
+	}
+	if strings.ContainsAny(item.Minion, `/\`) || item.Minion == "" || item.Minion == "." || item.Minion == ".." {
+		return fmt.Errorf("invalid minion name %q", item.Minion)
+	}
+	data, err := json.MarshalIndent(item, "", " ")
+	if err != nil {
+		return fmt.Errorf("marshal result of %s: %w", item.Minion, err)
+	}
+	return fsutil.Echo(filepath.Join(dir, jobMinionsPath, item.Minion+".json"), data, 0600)
+}
+
+// Get 返回任务信息和已返回的 minion 执行结果，执行结果按 minion 名称排序
+func (s *JobStore) Get(jid string) (*types.Job, error) {
+	job, err := s.load(jid)
+	if err != nil {
+		return nil, err
+	}
+	if job.Items, err = s.loadItems(jid, ""); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// load 只读取 job.json 中的任务信息，不包含执行结果
+func (s *JobStore) load(jid string) (*types.Job, error) {
+	dir, err := s.jobDir(jid)
+	if err != nil {
+		return nil, err
+	}
+	data, err := fsutil.Cat(filepath.Join(dir, jobFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, apiErr.NewNotFoundf("job %s not found", jid)
+		}
+		return nil, err
+	}
+	job := &types.Job{}
+	if err = json.Unmarshal(data, job); err != nil {
+		return nil, fmt.Errorf("parse job %s: %w", jid, err)
+	}
+	return job, nil
+}
+
+// loadItems 读取任务的执行结果并按 minion 名称排序，minion 不为空时只读取该 minion 的执行结果
+func (s *JobStore) loadItems(jid, minion string) ([]*types.ReportItem, error) {
+	dir, err := s.jobDir(jid)
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, jobMinionsPath)
+
+	names := make([]string, 0)
+	if minion != "" {
+		names = append(names, minion+".json")
+	} else {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+				continue
+			}
+			names = append(names, entry.Name())
+		}
+	}
+
+	items := make([]*types.ReportItem, 0, len(names))
+	for _, name := range names {
+		data, err := fsutil.Cat(filepath.Join(dir, name))
+		if err != nil {
+			if minion != "" && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		item := &types.ReportItem{}
+		if err = json.Unmarshal(data, item); err != nil {
+			return nil, fmt.Errorf("parse result of %s: %w", name, err)
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].Minion < items[j].Minion
+	})
+	return items, nil
+}
+
+// jobFilter 任务列表的过滤条件，字段为空时不过滤
+type jobFilter struct {
+	start time.Time
+	end   time.Time
+	// 执行的方法，支持 glob
+	function string
+	minion   string
+	user     string
+	result   types.JobResult
+	offset   int64
+	limit    int64
+}
+
+func (f *jobFilter) matchTime(start time.Time) bool {
+	if !f.start.IsZero() && start.Before(f.start) {
+		return false
+	}
+	if !f.end.IsZero() && !start.Before(f.end) {
+		return false
+	}
+	return true
+}
+
+// match 使用 job.json 中的任务信息过滤，执行结果由 List 单独过滤
+func (f *jobFilter) match(job *types.Job) bool {
+	if f.function != "" {
+		function := ""
+		if job.Request != nil {
+			function = job.Request.Function
+		}
+		if ok, _ := path.Match(f.function, function); !ok {
+			return false
+		}
+	}
+	if f.minion != "" {
+		found := false
+		for _, name := range job.Targets {
+			if name == f.minion {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.user != "" && job.User != f.user {
+		return false
+	}
+	return true
+}
+
+// List 返回符合条件的任务和任务总数，任务按开始时间倒序排列。
+// 返回的任务只包含执行结果的统计，过滤 minion 时包含该 minion 的执行结果
+func (s *JobStore) List(filter *jobFilter) ([]*types.Job, int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, 0, err
+	}
+	jids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		start, err := jidTime(entry.Name())
+		if err != nil || !entry.IsDir() || !filter.matchTime(start) {
+			continue
+		}
+		jids = append(jids, entry.Name())
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(jids)))
+
+	out := make([]*types.Job, 0)
+	var total int64
+	for _, jid := range jids {
+		// 先使用 job.json 过滤，执行结果只在需要时读取
+		job, err := s.load(jid)
+		if err != nil {
+			// 任务可能已被清理
+			if apiErr.IsNotFound(err) {
+				continue
+			}
+			return nil, 0, err
+		}
+		if !filter.match(job) {
+			continue
+		}
+		if filter.result != "" {
+			if job.Items, err = s.loadItems(jid, filter.minion); err != nil {
+				return nil, 0, err
+			}
+			if job.Result(filter.minion) != filter.result {
+				continue
+			}
+		}
+		total += 1
+		if total <= filter.offset || int64(len(out)) >= filter.limit {
+			continue
+		}
+
+		items, err := s.loadItems(jid, "")
+		if err != nil {
+			return nil, 0, err
+		}
+		report := &types.Report{Items: items}
+		summarize(report)
+		job.Summary = report.Summary
+		job.Items = nil
+		if filter.minion != "" {
+			for _, item := range items {
+				if item.Minion == filter.minion {
+					job.Items = append(job.Items, item)
+				}
+			}
+		}
+		out = append(out, job)
+	}
+	return out, total, nil
+}
+
+// Compact 删除结束时间早于 now 减去保留时长的任务，正在执行的任务不会被删除，返回删除的任务数量
+func (s *JobStore) Compact(now time.Time) (int, error) {
+	if s.retention <= 0 {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	deadline := now.Add(-s.retention)
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// 结束时间不早于开始时间，开始时间未过期的任务不需要读取任务信息
+		start, err := jidTime(entry.Name())
+		if err != nil || !start.Before(deadline) {
+			continue
+		}
+		if job, err := s.load(entry.Name()); err == nil {
+			// 任务未结束时结束时间为 0
+			if job.EndTimestamp == 0 || !time.Unix(job.EndTimestamp, 0).Before(deadline) {
+				continue
+			}
+		}
+		if err = os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+			return removed, err
+		}
+		removed += 1
+	}
+	return removed, nil
+}
+
+// runCompact 定期清理过期任务，直到 stopping 关闭
+func (s *JobStore) runCompact(stopping <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := s.Compact(time.Now())
+		if err != nil {
+			zap.S().Errorf("compact job cache: %v", err)
+		} else if removed > 0 {
+			zap.S().Infof("remove %d expired jobs", removed)
+		}
+
+		select {
+		case <-stopping:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// redactCall 返回用于保存的请求副本，请求中指定的 pillar 可能包含命令行传入的明文密码，
+// 所有的值都替换为 pillar.Redacted，只保留 key
+func redactCall(in *types.CallRequest) *types.CallRequest {
+	out := &types.CallRequest{
+		Id:       in.Id,
+		Selector: in.Selector,
+		Function: in.Function,
+		Args:     in.Args,
+		Timeout:  in.Timeout,
+		Test:     in.Test,
+	}
+	if len(in.Pillars) == 0 {
+		return out
+	}
+
+	out.Pillars = make(map[string]*types.Value, len(in.Pillars))
+	for key := range in.Pillars {
+		out.Pillars[key] = &types.Value{Type: types.ValueType_ValueString, Data: pillar.Redacted}
+	}
+	return out
+}
+
+// redactItem 返回用于保存的执行结果副本，pillar 模块的方法返回解密后的 pillar 数据，
+// 保存时结果替换为 pillar.Redacted
+func redactItem(function string, in *types.ReportItem) *types.ReportItem {
+	if module, _, _ := strings.Cut(function, "."); module != "pillar" {
+		return in
+	}
+	data, _ := json.Marshal(pillar.Redacted)
+	return &types.ReportItem{
+		Minion:         in.Minion,
+		StartTimestamp: in.StartTimestamp,
+		EndTimestamp:   in.EndTimestamp,
+		Result:         in.Result,
+		Error:          in.Error,
+		Data:           data,
+		RetCode:        in.RetCode,
+		Stdout:         in.Stdout,
+		Stderr:         in.Stderr,
+		Pid:            in.Pid,
+		Changes:        in.Changes,
+		Killed:         in.Killed,
+	}
+}
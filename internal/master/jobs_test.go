@@ -0,0 +1,409 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package master
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	pb "github.com/vine-io/maco/api/rpc"
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/master/pillar"
+	"github.com/vine-io/maco/internal/testutil"
+	"github.com/vine-io/maco/pkg/pemutil"
+	"github.com/vine-io/maco/pkg/selector"
+)
+
+func TestJobStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), jobsPath)
+	s, err := newJobStore(dir, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	jid := s.NewJID()
+	assert.Len(t, jid, 20)
+	assert.Greater(t, s.NewJID(), jid)
+	start, err := jidTime(jid)
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now(), start, time.Second)
+	}
+	// jid 使用 UTC 时间，不受本地时区和夏令时影响
+	assert.Equal(t, time.Now().UTC().Format("20060102"), jid[:8])
+	start, _ = jidTime("20250101120000000001")
+	assert.True(t, time.Date(2025, 1, 1, 12, 0, 0, 1000, time.UTC).Equal(start))
+
+	job := &types.Job{
+		Jid:            jid,
+		Request:        &types.CallRequest{Function: "test.ping"},
+		Targets:        []string{"web1", "web2"},
+		User:           "root",
+		StartTimestamp: start.Unix(),
+	}
+	if !assert.NoError(t, s.Save(job)) {
+		return
+	}
+	assert.NoError(t, s.AddItem(jid, &types.ReportItem{Minion: "web2", Result: true, Data: []byte("true")}))
+	assert.NoError(t, s.AddItem(jid, &types.ReportItem{Minion: "web1", Error: "minion web1 is not online"}))
+	assert.Error(t, s.AddItem(jid, &types.ReportItem{Minion: "../web3"}))
+
+	job.EndTimestamp = start.Unix() + 1
+	assert.NoError(t, s.Save(job))
+
+	out, err := s.Get(jid)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "root", out.User)
+	assert.Equal(t, []string{"web1", "web2"}, out.Targets)
+	assert.Equal(t, "test.ping", out.Request.Function)
+	assert.Equal(t, job.EndTimestamp, out.EndTimestamp)
+	if assert.Len(t, out.Items, 2) {
+		assert.Equal(t, "web1", out.Items[0].Minion)
+		assert.Equal(t, []byte("true"), out.Items[1].Data)
+	}
+
+	_, err = s.Get("20000101000000000000")
+	assert.True(t, apiErr.IsNotFound(err))
+	_, err = s.Get("../minions")
+	assert.Equal(t, apiErr.Code_BadRequest, apiErr.Parse(err).Code)
+}
+
+func TestJobStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := newJobStore(dir, 24*time.Hour)
+
+	now := time.Now()
+	old := now.Add(-25*time.Hour).UTC().Format(jidLayout) + "000001"
+	recent := now.Add(-time.Hour).UTC().Format(jidLayout) + "000001"
+	for _, jid := range []string{old, recent} {
+		start, _ := jidTime(jid)
+		_ = s.Save(&types.Job{Jid: jid, EndTimestamp: start.Unix()})
+	}
+	// 正在执行的任务和结束时间未过期的任务不会被删除
+	running := now.Add(-26*time.Hour).UTC().Format(jidLayout) + "000001"
+	_ = s.Save(&types.Job{Jid: running})
+	ended := now.Add(-27*time.Hour).UTC().Format(jidLayout) + "000001"
+	_ = s.Save(&types.Job{Jid: ended, EndTimestamp: now.Add(-time.Hour).Unix()})
+	_ = os.MkdirAll(filepath.Join(dir, "other"), 0700)
+
+	removed, err := s.Compact(now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, removed)
+	}
+	assert.NoDirExists(t, filepath.Join(dir, old))
+	assert.DirExists(t, filepath.Join(dir, recent))
+	assert.DirExists(t, filepath.Join(dir, running))
+	assert.DirExists(t, filepath.Join(dir, ended))
+	assert.DirExists(t, filepath.Join(dir, "other"))
+
+	// 保留时长小于等于 0 时不清理
+	keep, _ := newJobStore(dir, -time.Hour)
+	removed, _ = keep.Compact(now.Add(100 * time.Hour))
+	assert.Equal(t, 0, removed)
+}
+
+func TestRedactCall(t *testing.T) {
+	pillars, _ := types.NewValues(map[string]any{
+		"user": "admin",
+		"db":   map[string]any{"password": "p@ssw0rd", "port": 5432},
+		"key":  "ENC[def]",
+	})
+
+	in := &types.CallRequest{Function: "state.sls", Args: []string{"db"}, Pillars: pillars}
+	out := redactCall(in)
+	data, err := types.ValuesInterface(out.Pillars)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]any{
+		"user": pillar.Redacted,
+		"db":   pillar.Redacted,
+		"key":  pillar.Redacted,
+	}, data)
+	assert.Equal(t, []string{"db"}, out.Args)
+	// 原始请求不变
+	assert.Equal(t, "ENC[def]", in.Pillars["key"].Data)
+}
+
+func TestRecordPillarItem(t *testing.T) {
+	pair, err := pemutil.GenerateRSA(2048, "MACO")
+	if !assert.NoError(t, err) {
+		return
+	}
+	value, _ := pillar.Encrypt([]byte("p@ssw0rd"), pair.Public)
+	root := t.TempDir()
+	testutil.WriteFile(t, filepath.Join(root, "top.yaml"), "base:\n  '*':\n    - db\n")
+	testutil.WriteFile(t, filepath.Join(root, "db.yaml"), "db:\n  password: "+value+"\n")
+	data, _, err := pillar.NewCompiler(root).Compile(&selector.Target{Name: "web1"})
+	if !assert.NoError(t, err) || !assert.NoError(t, pillar.Decrypt(data, pair.Private)) {
+		return
+	}
+
+	// the result of pillar.get db:password on minion
+	password, _ := selector.Lookup(data, "db:password", selector.DefaultDelimiter)
+	result, _ := json.Marshal(password)
+	assert.Equal(t, `"p@ssw0rd"`, string(result))
+
+	store, err := newJobStore(filepath.Join(t.TempDir(), jobsPath), time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	s := &Scheduler{jobs: store}
+	job := &types.Job{
+		Jid:            store.NewJID(),
+		Request:        &types.CallRequest{Function: "pillar.get", Args: []string{"db:password"}},
+		Targets:        []string{"web1"},
+		StartTimestamp: time.Now().Unix(),
+	}
+	if !assert.NoError(t, store.Save(job)) {
+		return
+	}
+	item := &types.ReportItem{Minion: "web1", Result: true, Data: result}
+	s.recordItem(job, item)
+	// 返回给调用者的结果不变
+	assert.Equal(t, result, item.Data)
+
+	stored, err := os.ReadFile(filepath.Join(store.dir, job.Jid, jobMinionsPath, "web1.json"))
+	if assert.NoError(t, err) {
+		assert.NotContains(t, string(stored), "p@ssw0rd")
+		assert.NotContains(t, string(stored), base64.StdEncoding.EncodeToString(result))
+	}
+	got, err := store.Get(job.Jid)
+	if assert.NoError(t, err) && assert.Len(t, got.Items, 1) {
+		assert.Equal(t, `"`+pillar.Redacted+`"`, string(got.Items[0].Data))
+		assert.True(t, got.Items[0].Result)
+	}
+}
+
+func TestJobStoreRecover(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := newJobStore(dir, time.Hour)
+
+	running := s.NewJID()
+	_ = s.Save(&types.Job{Jid: running, Targets: []string{"web1", "web2"}, State: types.JobRunning.String()})
+	_ = s.AddItem(running, &types.ReportItem{Minion: "web1", Result: true})
+	done := s.NewJID()
+	_ = s.Save(&types.Job{Jid: done, State: types.JobDone.String(), EndTimestamp: 1})
+
+	// master 重启后，未结束的任务标记为结束
+	s, err := newJobStore(dir, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, _ := s.Get(running)
+	assert.Equal(t, types.JobDone.String(), out.State)
+	assert.NotZero(t, out.EndTimestamp)
+	assert.Equal(t, []string{"web2"}, out.Missing())
+	out, _ = s.Get(done)
+	assert.Equal(t, int64(1), out.EndTimestamp)
+}
+
+func TestJobStoreList(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := newJobStore(dir, time.Hour)
+
+	now := time.Now()
+	newJob := func(ago time.Duration, function, user string, targets ...string) *types.Job {
+		jid := now.Add(-ago).UTC().Format(jidLayout) + "000001"
+		job := &types.Job{
+			Jid:     jid,
+			Request: &types.CallRequest{Function: function},
+			Targets: targets,
+			User:    user,
+			State:   types.JobDone.String(),
+		}
+		_ = s.Save(job)
+		return job
+	}
+	old := newJob(48*time.Hour, "cmd.run", "root", "db-07")
+	_ = s.AddItem(old.Jid, &types.ReportItem{Minion: "db-07", Result: true})
+	failed := newJob(2*time.Hour, "cmd.run", "admin", "db-07", "web1")
+	_ = s.AddItem(failed.Jid, &types.ReportItem{Minion: "db-07", Result: true, Data: []byte("ok")})
+	_ = s.AddItem(failed.Jid, &types.ReportItem{Minion: "web1", Error: "exit status 1"})
+	ping := newJob(time.Hour, "test.ping", "root", "web1")
+	_ = s.AddItem(ping.Jid, &types.ReportItem{Minion: "web1", Result: true})
+
+	jids := func(filter *jobFilter) []string {
+		if filter.limit == 0 {
+			filter.limit = defaultListJobs
+		}
+		jobs, _, err := s.List(filter)
+		assert.NoError(t, err)
+		out := make([]string, 0)
+		for _, job := range jobs {
+			out = append(out, job.Jid)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{ping.Jid, failed.Jid, old.Jid}, jids(&jobFilter{}))
+	assert.Equal(t, []string{ping.Jid, failed.Jid}, jids(&jobFilter{start: now.Add(-24 * time.Hour)}))
+	assert.Equal(t, []string{old.Jid}, jids(&jobFilter{end: now.Add(-24 * time.Hour)}))
+	assert.Equal(t, []string{failed.Jid, old.Jid}, jids(&jobFilter{function: "cmd.*"}))
+	assert.Equal(t, []string{failed.Jid}, jids(&jobFilter{user: "admin"}))
+	assert.Equal(t, []string{failed.Jid}, jids(&jobFilter{result: types.JobFailed}))
+	assert.Equal(t, []string{failed.Jid, old.Jid}, jids(&jobFilter{minion: "db-07", result: types.JobSuccess}))
+
+	// 分页
+	jobs, total, _ := s.List(&jobFilter{offset: 1, limit: 1})
+	assert.Equal(t, int64(3), total)
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, failed.Jid, jobs[0].Jid)
+		assert.Nil(t, jobs[0].Items)
+		assert.Equal(t, int64(1), jobs[0].Summary.Failed)
+	}
+
+	// 过滤 minion 时只返回该 minion 的执行结果
+	jobs, _, _ = s.List(&jobFilter{minion: "db-07", limit: 1})
+	if assert.Len(t, jobs, 1) && assert.Len(t, jobs[0].Items, 1) {
+		assert.Equal(t, []byte("ok"), jobs[0].Items[0].Data)
+	}
+}
+
+func TestTaskKill(t *testing.T) {
+	tk := newTask(1, 2, &types.Report{})
+	tk.pending["web1"] = struct{}{}
+	tk.pending["web2"] = struct{}{}
+
+	assert.Equal(t, []string{"web1", "web2"}, tk.kill())
+	go func() {
+		// web2 返回结果时尚未收到终止请求
+		tk.notify("web2", &types.CallResponse{Type: types.ResultType_ResultOk})
+		tk.notify("web1", &types.CallResponse{Type: types.ResultType_ResultError, Error: "killed"})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if !assert.NoError(t, tk.execute(ctx)) || !assert.Len(t, tk.report.Items, 2) {
+		return
+	}
+	assert.False(t, tk.report.Items[0].Killed)
+	assert.True(t, tk.report.Items[1].Killed)
+	assert.Empty(t, tk.kill())
+}
+
+func TestTaskTimeout(t *testing.T) {
+	tk := newTask(1, 2, &types.Report{Jid: "20250101120000000001"})
+	tk.pending["web1"] = struct{}{}
+	tk.pending["web2"] = struct{}{}
+
+	go tk.notify("web1", &types.CallResponse{Type: types.ResultType_ResultOk})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if !assert.NoError(t, tk.execute(ctx)) || !assert.Len(t, tk.report.Items, 2) {
+		return
+	}
+	assert.Equal(t, "20250101120000000001", tk.report.Jid)
+	assert.True(t, tk.report.Items[0].Result)
+	assert.Equal(t, "web2", tk.report.Items[1].Minion)
+	assert.False(t, tk.report.Items[1].Result)
+	assert.Contains(t, tk.report.Items[1].Error, "timeout")
+	assert.Empty(t, tk.pending)
+
+	// 请求被取消时返回错误
+	tk = newTask(2, 1, &types.Report{})
+	tk.pending["web1"] = struct{}{}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, tk.execute(ctx), context.Canceled)
+}
+
+// brokenStream 发送消息总是失败的 minion 连接
+type brokenStream struct {
+	DispatchStream
+}
+
+func (s *brokenStream) Context() context.Context { return context.Background() }
+
+func (s *brokenStream) Send(*pb.DispatchResponse) error { return errors.New("broken pipe") }
+
+func TestHandleSendError(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := newStorage(NewOptions(dir, zap.NewNop()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	jobs, _ := newJobStore(filepath.Join(dir, jobsPath), time.Hour)
+	s, _ := NewScheduler(storage, jobs)
+	s.minions.Add("web1")
+	s.pipes.Set("web1", newPipe("web1", storage.ServerRsa(), storage.ServerRsa().Public, &brokenStream{}, s.mch))
+
+	req := &Request{Call: &types.CallRequest{
+		Selector: &types.Selector{Minions: []string{"web1"}},
+		Function: "test.ping",
+		Timeout:  5,
+	}}
+	start := time.Now()
+	rsp, err := s.Handle(context.Background(), req)
+	if !assert.NoError(t, err) || !assert.Len(t, rsp.Report.Items, 1) {
+		return
+	}
+	// 发送失败时直接返回错误结果，不等待超时
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Contains(t, rsp.Report.Items[0].Error, "broken pipe")
+
+	job, err := jobs.Get(rsp.Report.Jid)
+	if assert.NoError(t, err) {
+		assert.Empty(t, job.Missing())
+		assert.Equal(t, types.JobFailed, job.Result(""))
+	}
+}
+
+func TestHandleNoJob(t *testing.T) {
+	dir := t.TempDir()
+	storage, err := newStorage(NewOptions(dir, zap.NewNop()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	jobs, _ := newJobStore(filepath.Join(dir, jobsPath), time.Hour)
+	s, _ := NewScheduler(storage, jobs)
+	s.minions.Add("web1")
+	s.pipes.Set("web1", newPipe("web1", storage.ServerRsa(), storage.ServerRsa().Public, &brokenStream{}, s.mch))
+
+	req := &Request{Call: &types.CallRequest{
+		Selector: &types.Selector{Minions: []string{"web1"}},
+		Function: "sys.doc",
+		Timeout:  5,
+	}, NoJob: true}
+	rsp, err := s.Handle(context.Background(), req)
+	if !assert.NoError(t, err) || !assert.Len(t, rsp.Report.Items, 1) {
+		return
+	}
+	assert.Empty(t, rsp.Report.Jid)
+
+	entries, err := os.ReadDir(jobs.dir)
+	if assert.NoError(t, err) {
+		assert.Empty(t, entries)
+	}
+}
@@ -0,0 +1,247 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package pillar compiles the pillar tree of maco-master for minions.
+//
+// The pillar tree lives under a root directory (DataRoot/pillar by default),
+// the top file maps target expressions to pillar files:
+//
+//	base:
+//	  '*':
+//	    - common
+//	  'G@os:linux and web-*':
+//	    - web
+//	    - apps.nginx
+//
+// A pillar name is resolved as a path relative to the root, the dots are
+// replaced with path separators, e.g. `apps.nginx` is one of apps/nginx.yaml,
+// apps/nginx.yml, apps/nginx/init.yaml or apps/nginx/init.yml.
+// All matched files are deep merged by the order of the top file, the later one
+// takes precedence.
+// Only the base environment is supported in the top file.
+package pillar
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vine-io/maco/pkg/dsutil"
+	"github.com/vine-io/maco/pkg/selector"
+)
+
+const (
+	// DefaultTopFile the name of pillar top file
+	DefaultTopFile = "top.yaml"
+	// DefaultEnv the only environment supported in top file
+	DefaultEnv = "base"
+)
+
+var extensions = []string{".yaml", ".yml"}
+
+// Entry is the target expression and the pillar files in top file
+type Entry struct {
+	Env    string
+	Target string
+	Names  []string
+}
+
+// Compiler compiles pillar data for minions
+type Compiler struct {
+	root string
+}
+
+// NewCompiler creates Compiler with the root directory of pillar tree
+func NewCompiler(root string) *Compiler {
+	return &Compiler{root: root}
+}
+
+// Root returns the root directory of pillar tree
+func (c *Compiler) Root() string {
+	return c.root
+}
+
+// Top parses the top file, returns empty entries when the top file does not exist.
+func (c *Compiler) Top() ([]*Entry, error) {
+	filename := filepath.Join(c.root, DefaultTopFile)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Entry{}, nil
+		}
+		return nil, err
+	}
+	entries, err := ParseTop(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return entries, nil
+}
+
+// Compile returns the pillar data of the given target and the pillar files which are merged.
+func (c *Compiler) Compile(target *selector.Target) (map[string]any, []string, error) {
+	entries, err := c.Top()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := map[string]any{}
+	sources := make([]string, 0)
+	loaded := map[string]struct{}{}
+	for _, entry := range entries {
+		expr, err := selector.Parse(entry.Target)
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse target '%s': %w", entry.Target, err)
+		}
+		if !expr.Match(target) {
+			continue
+		}
+
+		for _, name := range entry.Names {
+			if _, ok := loaded[name]; ok {
+				continue
+			}
+			loaded[name] = struct{}{}
+
+			filename, err := c.resolve(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			doc, err := LoadFile(filename)
+			if err != nil {
+				return nil, nil, err
+			}
+			Merge(out, doc)
+			sources = append(sources, name)
+		}
+	}
+
+	return out, sources, nil
+}
+
+// resolve returns the path of pillar file by its name
+func (c *Compiler) resolve(name string) (string, error) {
+	filename, err := Resolve(c.root, name)
+	if err != nil {
+		return "", fmt.Errorf("invalid pillar name '%s'", name)
+	}
+	if filename == "" {
+		return "", fmt.Errorf("pillar '%s' not found", name)
+	}
+	return filename, nil
+}
+
+// Resolve returns the path of yaml file under root by its dotted name, e.g. `apps.nginx` is one of
+// apps/nginx.yaml, apps/nginx.yml, apps/nginx/init.yaml or apps/nginx/init.yml.
+// It returns empty if none of them exists.
+func Resolve(root, name string) (string, error) {
+	if name == "" || strings.Contains(name, "..") || filepath.IsAbs(name) {
+		return "", fmt.Errorf("invalid name '%s'", name)
+	}
+
+	base := filepath.Join(root, filepath.FromSlash(strings.ReplaceAll(name, ".", "/")))
+	candidates := make([]string, 0, len(extensions)*2)
+	for _, ext := range extensions {
+		candidates = append(candidates, base+ext)
+	}
+	for _, ext := range extensions {
+		candidates = append(candidates, filepath.Join(base, "init"+ext))
+	}
+
+	for _, filename := range candidates {
+		stat, err := os.Stat(filename)
+		if err == nil && !stat.IsDir() {
+			return filename, nil
+		}
+	}
+	return "", nil
+}
+
+// ParseTop parses the content of top file, keeps the order of environments and targets.
+func ParseTop(data []byte) ([]*Entry, error) {
+	entries := make([]*Entry, 0)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return entries, nil
+	}
+
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return entries, nil
+	}
+	doc := root.Content[0]
+	if doc.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("line %d: top file must be a mapping of environments", doc.Line)
+	}
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		env, targets := doc.Content[i], doc.Content[i+1]
+		if env.Value != DefaultEnv {
+			return nil, fmt.Errorf("line %d: environment '%s' is not supported, only %s is allowed", env.Line, env.Value, DefaultEnv)
+		}
+		if targets.Kind != yamlv3.MappingNode {
+			return nil, fmt.Errorf("line %d: environment '%s' must be a mapping of targets", targets.Line, env.Value)
+		}
+
+		for j := 0; j+1 < len(targets.Content); j += 2 {
+			target, items := targets.Content[j], targets.Content[j+1]
+			entry := &Entry{
+				Env:    env.Value,
+				Target: target.Value,
+				Names:  []string{},
+			}
+			if err := items.Decode(&entry.Names); err != nil {
+				return nil, fmt.Errorf("line %d: target '%s' must be a list of names", items.Line, target.Value)
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, nil
+}
+
+// LoadFile reads pillar data from yaml file
+func LoadFile(filename string) (map[string]any, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return out, nil
+	}
+	if err = yaml.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return out, nil
+}
+
+// Merge deep merges src into dst, the values in src take precedence.
+func Merge(dst, src map[string]any) map[string]any {
+	return dsutil.MergeMap(dst, src)
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package pillar
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/internal/testutil"
+	"github.com/vine-io/maco/pkg/selector"
+)
+
+func TestCompile(t *testing.T) {
+	root := t.TempDir()
+	testutil.WriteFile(t, filepath.Join(root, "top.yaml"), `
+base:
+  '*':
+    - common
+  'G@os:linux and web-*':
+    - apps.nginx
+  'db-*':
+    - db
+`)
+	testutil.WriteFile(t, filepath.Join(root, "common.yaml"), `
+ntp: pool.ntp.org
+nginx:
+  port: 80
+  user: www
+`)
+	testutil.WriteFile(t, filepath.Join(root, "apps", "nginx", "init.yml"), `
+nginx:
+  port: 8080
+`)
+	testutil.WriteFile(t, filepath.Join(root, "db.yaml"), `password: secret`)
+
+	c := NewCompiler(root)
+
+	web := &selector.Target{Name: "web-1", Grains: map[string]any{"os": "linux"}}
+	data, sources, err := c.Compile(web)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"common", "apps.nginx"}, sources)
+	assert.Equal(t, "pool.ntp.org", data["ntp"])
+	assert.Equal(t, map[string]any{"port": float64(8080), "user": "www"}, data["nginx"])
+	assert.NotContains(t, data, "password")
+
+	db := &selector.Target{Name: "db-1", Grains: map[string]any{"os": "linux"}}
+	data, sources, err = c.Compile(db)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"common", "db"}, sources)
+	assert.Equal(t, "secret", data["password"])
+}
+
+func TestCompileError(t *testing.T) {
+	root := t.TempDir()
+
+	data, _, err := NewCompiler(root).Compile(&selector.Target{Name: "m1"})
+	assert.NoError(t, err)
+	assert.Empty(t, data)
+
+	testutil.WriteFile(t, filepath.Join(root, "top.yaml"), "base:\n  '*':\n    - missing\n")
+	_, _, err = NewCompiler(root).Compile(&selector.Target{Name: "m1"})
+	assert.Error(t, err)
+
+	_, err = ParseTop([]byte("- a\n- b\n"))
+	assert.Error(t, err)
+
+	_, err = ParseTop([]byte("prod:\n  '*':\n    - common\n"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package pillar
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/vine-io/maco/pkg/pemutil"
+)
+
+const (
+	envelopePrefix = "ENC["
+	envelopeSuffix = "]"
+
+	// Redacted replaces the secret values which are recorded, e.g. in the job cache
+	Redacted = "******"
+)
+
+// IsEncrypted checks whether the text is an encrypted envelope, e.g. ENC[...]
+func IsEncrypted(text string) bool {
+	text = strings.TrimSpace(text)
+	return strings.HasPrefix(text, envelopePrefix) && strings.HasSuffix(text, envelopeSuffix)
+}
+
+// Encrypt encrypts plaintext by the public key of maco-master and returns the envelope
+func Encrypt(plaintext, publicKey []byte) (string, error) {
+	data, err := pemutil.EncodeByRSA(plaintext, publicKey)
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + base64.StdEncoding.EncodeToString(data) + envelopeSuffix, nil
+}
+
+// DecryptText decrypts the envelope by the private key of maco-master
+func DecryptText(text string, privateKey []byte) (string, error) {
+	text = strings.TrimSpace(text)
+	if !IsEncrypted(text) {
+		return "", fmt.Errorf("invalid encrypted value")
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, envelopePrefix), envelopeSuffix)
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return "", fmt.Errorf("decode encrypted value: %w", err)
+	}
+	plaintext, err := pemutil.DecodeByRSA(data, privateKey)
+	if err != nil {
+		return "", fmt.Errorf("decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Decrypt replaces all encrypted envelopes in pillar data with the plaintext.
+func Decrypt(data map[string]any, privateKey []byte) error {
+	for key, value := range data {
+		out, err := decryptValue(key, value, privateKey)
+		if err != nil {
+			return err
+		}
+		data[key] = out
+	}
+	return nil
+}
+
+func decryptValue(path string, value any, privateKey []byte) (any, error) {
+	switch tv := value.(type) {
+	case string:
+		if !IsEncrypted(tv) {
+			return tv, nil
+		}
+		text, err := DecryptText(tv, privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return text, nil
+	case map[string]any:
+		for key, item := range tv {
+			out, err := decryptValue(path+":"+key, item, privateKey)
+			if err != nil {
+				return nil, err
+			}
+			tv[key] = out
+		}
+		return tv, nil
+	case []any:
+		for i, item := range tv {
+			out, err := decryptValue(fmt.Sprintf("%s:%d", path, i), item, privateKey)
+			if err != nil {
+				return nil, err
+			}
+			tv[i] = out
+		}
+		return tv, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package pillar
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/pkg/pemutil"
+)
+
+func TestSecret(t *testing.T) {
+	pair, err := pemutil.GenerateRSA(2048, "MACO")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	value, err := Encrypt([]byte("p@ssw0rd"), pair.Public)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, IsEncrypted(value))
+	assert.False(t, IsEncrypted("p@ssw0rd"))
+
+	data := map[string]any{
+		"user": "admin",
+		"db": map[string]any{
+			"password": value,
+			"replicas": []any{"plain", value},
+		},
+	}
+	if !assert.NoError(t, Decrypt(data, pair.Private)) {
+		return
+	}
+	assert.Equal(t, "admin", data["user"])
+	db := data["db"].(map[string]any)
+	assert.Equal(t, "p@ssw0rd", db["password"])
+	assert.Equal(t, []any{"plain", "p@ssw0rd"}, db["replicas"])
+
+	err = Decrypt(map[string]any{"bad": "ENC[invalid]"}, pair.Private)
+	assert.Error(t, err)
+}
@@ -28,6 +28,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -38,8 +41,11 @@ import (
 	apiErr "github.com/vine-io/maco/api/errors"
 	pb "github.com/vine-io/maco/api/rpc"
 	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/master/pillar"
+	"github.com/vine-io/maco/internal/master/state"
 	"github.com/vine-io/maco/pkg/dsutil"
 	"github.com/vine-io/maco/pkg/pemutil"
+	"github.com/vine-io/maco/pkg/selector"
 )
 
 type DispatchStream interface {
@@ -60,10 +66,16 @@ type message struct {
 	err error
 	// Call 请求返回的结果
 	call *types.CallResponse
+	// minion 上报的 grains
+	grain *types.Grain
 }
 
 type Request struct {
 	Call *types.CallRequest
+	// 提交任务的用户，记录在任务缓存中
+	User string
+	// 不保存到任务缓存，如 maco-cp 和查询函数说明的请求
+	NoJob bool
 }
 
 type Response struct {
@@ -131,6 +143,8 @@ type pipe struct {
 	// minion public rsa key
 	pubKey []byte
 
+	// smu 保证 stream 的发送不会并发执行
+	smu    sync.Mutex
 	stream DispatchStream
 	mch    chan<- *message
 
@@ -166,6 +180,20 @@ func (p *pipe) send(in *Request) error {
 		rsp.Call = &pb.DispatchCallMsg{Id: call.Id, Data: msg}
 	}
 
+	p.smu.Lock()
+	defer p.smu.Unlock()
+	return p.stream.Send(rsp)
+}
+
+// cancel 通知 minion 终止正在执行的请求
+func (p *pipe) cancel(id uint64) error {
+	rsp := &pb.DispatchResponse{
+		Type: types.EventType_EventCancel,
+		Call: &pb.DispatchCallMsg{Id: id},
+	}
+
+	p.smu.Lock()
+	defer p.smu.Unlock()
 	return p.stream.Send(rsp)
 }
 
@@ -213,6 +241,11 @@ func (p *pipe) start() error {
 			} else {
 				p.mch <- &message{id: msg.Id, name: p.name, call: callRsp}
 			}
+		case types.EventType_EventGrains:
+			if req.Grain == nil {
+				continue
+			}
+			p.mch <- &message{name: p.name, grain: req.Grain}
 		}
 	}
 }
@@ -231,6 +264,9 @@ type jobPack struct {
 	call *types.CallResponse
 }
 
+// killTimeout 任务被终止后等待 minion 返回结果的时长，超时后未返回结果的 minion 直接标记为 killed
+const killTimeout = 5 * time.Second
+
 type task struct {
 	id uint64
 
@@ -239,16 +275,32 @@ type task struct {
 
 	ch chan *jobPack
 
+	mu sync.Mutex
+	// 已发送请求但尚未返回结果的 minion
+	pending map[string]struct{}
+	// 任务被终止时关闭 killCh
+	killed bool
+	killCh chan struct{}
+	// 任务结束时关闭 done，之后返回的结果直接丢弃
+	done chan struct{}
+
 	report *types.Report
+	// 任务记录
+	job *types.Job
+	// 收到 minion 执行结果时调用，用于保存到任务缓存
+	record func(item *types.ReportItem)
 }
 
 func newTask(id uint64, total uint32, report *types.Report) *task {
 
 	j := &task{
-		id:     id,
-		total:  total,
-		ch:     make(chan *jobPack, 1),
-		report: report,
+		id:      id,
+		total:   total,
+		ch:      make(chan *jobPack, 1),
+		pending: make(map[string]struct{}),
+		killCh:  make(chan struct{}),
+		done:    make(chan struct{}),
+		report:  report,
 	}
 	return j
 }
@@ -258,25 +310,127 @@ func (t *task) notify(name string, payload *types.CallResponse) {
 		name: name,
 		call: payload,
 	}
-	t.ch <- pack
+	select {
+	case t.ch <- pack:
+	case <-t.done:
+	}
+}
+
+// fail 记录无法执行任务的 minion
+func (t *task) fail(name, reason string) {
+	item := &types.ReportItem{
+		Minion: name,
+		Result: false,
+		Error:  reason,
+	}
+	t.add(item)
+}
+
+// add 记录 minion 的执行结果
+func (t *task) add(item *types.ReportItem) {
+	if t.record != nil {
+		t.record(item)
+	}
+	t.report.Items = append(t.report.Items, item)
+}
+
+// kill 标记任务被终止，返回尚未返回结果的 minion
+func (t *task) kill() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.killed {
+		t.killed = true
+		close(t.killCh)
+	}
+	names := make([]string, 0, len(t.pending))
+	for name := range t.pending {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
+// expire 将尚未返回结果的 minion 记录为超时
+func (t *task) expire() {
+	t.mu.Lock()
+	killed := t.killed
+	names := make([]string, 0, len(t.pending))
+	for name := range t.pending {
+		names = append(names, name)
+	}
+	clear(t.pending)
+	t.mu.Unlock()
+
+	sort.Strings(names)
+	for _, name := range names {
+		item := &types.ReportItem{
+			Minion: name,
+			Error:  fmt.Sprintf("minion %s did not respond before the timeout", name),
+			Killed: killed,
+		}
+		t.add(item)
+	}
+}
+
+// returned 记录 minion 已返回结果，返回任务是否被终止
+func (t *task) returned(name string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.pending, name)
+	return t.killed
+}
+
+// execute 等待 minion 返回结果，超时后未返回结果的 minion 记录为超时，请求被取消时返回错误
 func (t *task) execute(ctx context.Context) error {
+	// 所有 minion 都未能发送请求
+	if t.gets >= t.total {
+		return nil
+	}
+
+	killCh := t.killCh
+	var expired <-chan time.Time
 	for {
 		select {
 		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				t.expire()
+				return nil
+			}
 			return ctx.Err()
+		case <-killCh:
+			// 等待 minion 终止请求后返回结果
+			killCh = nil
+			timer := time.NewTimer(killTimeout)
+			defer timer.Stop()
+			expired = timer.C
+		case <-expired:
+			for _, name := range t.kill() {
+				item := &types.ReportItem{
+					Minion: name,
+					Error:  fmt.Sprintf("minion %s did not respond after the job was killed", name),
+					Killed: true,
+				}
+				t.returned(name)
+				t.add(item)
+			}
+			return nil
 		case p := <-t.ch:
 			t.gets += 1
+			killed := t.returned(p.name)
 			call := p.call
 			if call == nil {
 				continue
 			}
 
 			item := &types.ReportItem{
-				Minion: p.name,
-				Error:  call.Error,
-				Data:   call.Result,
+				Minion:  p.name,
+				Error:   call.Error,
+				Data:    call.Result,
+				RetCode: call.RetCode,
+				Stdout:  call.Stdout,
+				Stderr:  call.Stderr,
+				Pid:     call.Pid,
+				Changes: call.Changes,
 			}
 			switch call.Type {
 			case types.ResultType_ResultSkip:
@@ -284,9 +438,10 @@ func (t *task) execute(ctx context.Context) error {
 				item.Result = true
 			case types.ResultType_ResultError:
 			}
+			// 终止时尚未执行完成的 minion
+			item.Killed = killed && !item.Result
 
-			//report := t.report
-			t.report.Items = append(t.report.Items, item)
+			t.add(item)
 
 			if t.gets >= t.total {
 				return nil
@@ -295,6 +450,23 @@ func (t *task) execute(ctx context.Context) error {
 	}
 }
 
+// summarize 统计 Report 中的执行结果
+func summarize(report *types.Report) {
+	summary := &types.ReportSummary{}
+	for _, item := range report.Items {
+		summary.Total += 1
+		if item.Result {
+			summary.Success += 1
+		} else {
+			summary.Failed += 1
+		}
+		if item.Changes != nil && item.Changes.Changed {
+			summary.Changes += 1
+		}
+	}
+	report.Summary = summary
+}
+
 type Scheduler struct {
 	pmu sync.RWMutex
 	// 建立连接的 minion
@@ -305,6 +477,9 @@ type Scheduler struct {
 	downMinions *dsutil.SafeHashSet[string]
 
 	storage *Storage
+	pillar  *pillar.Compiler
+	states  *state.Compiler
+	jobs    *JobStore
 
 	idAlloc *idAllocator
 
@@ -316,7 +491,7 @@ type Scheduler struct {
 	eventCancel func()
 }
 
-func NewScheduler(storage *Storage) (*Scheduler, error) {
+func NewScheduler(storage *Storage, jobs *JobStore) (*Scheduler, error) {
 
 	minions := dsutil.NewSafeHashSet[string]()
 	downMinions := dsutil.NewSafeHashSet[string]()
@@ -343,6 +518,9 @@ func NewScheduler(storage *Storage) (*Scheduler, error) {
 		minions:     minions,
 		downMinions: downMinions,
 		storage:     storage,
+		pillar:      pillar.NewCompiler(filepath.Join(storage.dir, pillarPath)),
+		states:      state.NewCompiler(filepath.Join(storage.dir, statesPath)),
+		jobs:        jobs,
 		idAlloc:     idAlloc,
 		taskStore:   taskStore,
 		mch:         make(chan *message, 100),
@@ -372,6 +550,10 @@ func (s *Scheduler) AddStream(in *types.ConnectRequest, stream DispatchStream) (
 	}
 	state := types.MinionState(info.State)
 
+	if err = s.storage.updateGrains(name, in.Grain); err != nil {
+		zap.L().Error("save minion grains", zap.String("id", name), zap.Error(err))
+	}
+
 	pair := s.storage.ServerRsa()
 	p := newPipe(name, pair, in.MinionPublicKey, stream, s.mch)
 	s.pmu.Lock()
@@ -408,90 +590,373 @@ func (s *Scheduler) sendTo(name string, req *Request) error {
 	return p.send(in)
 }
 
+// Handle 执行任务并等待所有 minion 返回结果，超时后返回已收到的结果，未返回结果的 minion 记录为超时
 func (s *Scheduler) Handle(ctx context.Context, req *Request) (*Response, error) {
-
-	//req.Call
-	in := req.Call
-	ctx, cancel := context.WithTimeout(ctx, time.Duration(in.Timeout)*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(req.Call.Timeout)*time.Second)
 	defer cancel()
 
-	report := &types.Report{
-		Items:   make([]*types.ReportItem, 0),
-		Summary: &types.ReportSummary{},
+	t, err := s.submit(req)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.wait(ctx, t); err != nil {
+		return nil, err
 	}
 
-	nextId := s.idAlloc.Get()
-	defer s.idAlloc.Free(nextId)
+	rsp := &Response{
+		Report: t.report,
+	}
+	return rsp, nil
+}
 
-	in.Id = nextId
+// HandleAsync 提交任务后立即返回任务记录，在后台等待 minion 返回结果，结果保存在任务缓存中
+func (s *Scheduler) HandleAsync(req *Request) (*types.Job, error) {
+	t, err := s.submit(req)
+	if err != nil {
+		return nil, err
+	}
 
-	targets := make([]string, 0)
-	if in.Selector != nil {
-		targets = in.Selector.Minions
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Call.Timeout)*time.Second)
+		defer cancel()
+		if err := s.wait(ctx, t); err != nil {
+			zap.S().Warnf("job %s: %v", t.job.Jid, err)
+		}
+	}()
+	return t.job, nil
+}
+
+// submit 记录任务并向在线的目标 minion 发送请求，不可用的 minion 直接记录错误结果
+func (s *Scheduler) submit(req *Request) (*task, error) {
+	in := req.Call
+	targets, err := s.selectMinions(in.Selector)
+	if err != nil {
+		return nil, err
 	}
 	if len(targets) == 0 {
 		return nil, apiErr.NewBadRequest("no targets")
 	}
 
-	total := uint32(0)
+	nextId := s.idAlloc.Get()
+	in.Id = nextId
+
+	job := &types.Job{
+		Jid:            s.jobs.NewJID(),
+		Request:        redactCall(in),
+		Targets:        targets,
+		User:           req.User,
+		StartTimestamp: time.Now().Unix(),
+		State:          types.JobRunning.String(),
+	}
+	report := &types.Report{
+		Items:   make([]*types.ReportItem, 0),
+		Summary: &types.ReportSummary{},
+	}
+	t := newTask(nextId, 0, report)
+	t.job = job
+	if !req.NoJob {
+		if err = s.jobs.Save(job); err != nil {
+			zap.S().Errorf("save job %s: %v", job.Jid, err)
+		}
+		report.Jid = job.Jid
+		t.record = func(item *types.ReportItem) {
+			s.recordItem(job, item)
+		}
+	}
+
 	pipes := make([]*pipe, 0)
+	calls := make(map[string]*types.CallRequest)
 	for _, name := range targets {
 		if !s.minions.Contains(name) {
-			item := &types.ReportItem{
-				Minion: name,
-				Result: false,
-				Error:  fmt.Sprintf("minion %s is not accepted", name),
-			}
-			report.Items = append(report.Items, item)
+			t.fail(name, fmt.Sprintf("minion %s is not accepted", name))
 			continue
 		}
 
 		s.pmu.RLock()
 		p, ok := s.pipes.Get(name)
 		s.pmu.RUnlock()
-		if ok {
-			total += 1
-			pipes = append(pipes, p)
-		} else {
-			item := &types.ReportItem{
-				Minion: name,
-				Result: false,
-				Error:  fmt.Sprintf("minion %s is not online", name),
-			}
-			report.Items = append(report.Items, item)
+		if !ok {
+			t.fail(name, fmt.Sprintf("minion %s is not online", name))
+			continue
+		}
+		call, cErr := s.minionCall(name, in)
+		if cErr != nil {
+			t.fail(name, cErr.Error())
+			continue
 		}
+		pipes = append(pipes, p)
+		calls[name] = call
 	}
 
 	if len(pipes) == 0 {
+		s.finish(t)
 		return nil, apiErr.NewBadRequest("no available minions")
 	}
 
-	t := newTask(nextId, total, report)
+	t.total = uint32(len(pipes))
+	for _, p := range pipes {
+		t.pending[p.name] = struct{}{}
+	}
 	s.tmu.Lock()
 	s.taskStore[nextId] = t
 	s.tmu.Unlock()
 
 	for _, p := range pipes {
-		err := p.send(&Request{Call: in})
+		err := p.send(&Request{Call: calls[p.name]})
 		if err != nil {
+			// 发送失败的 minion 不会返回结果，直接记录错误，任务尚未开始等待结果
 			zap.S().Errorf("send msg to %s: %v", p.name, err)
+			t.returned(p.name)
+			t.total -= 1
+			t.fail(p.name, fmt.Sprintf("send request to minion %s: %v", p.name, err))
 		}
 	}
+	return t, nil
+}
 
-	err := t.execute(ctx)
-	if err != nil {
-		return nil, err
+// wait 等待任务中所有 minion 返回结果，任务结束或者超时后清理任务
+func (s *Scheduler) wait(ctx context.Context, t *task) error {
+	defer s.finish(t)
+
+	if err := t.execute(ctx); err != nil {
+		return err
 	}
+	summarize(t.report)
+	return nil
+}
 
+// finish 释放任务 id，并在任务缓存中记录任务结束，不保存到任务缓存的任务没有 record
+func (s *Scheduler) finish(t *task) {
+	close(t.done)
 	s.tmu.Lock()
-	delete(s.taskStore, nextId)
+	delete(s.taskStore, t.id)
 	s.tmu.Unlock()
+	s.idAlloc.Free(t.id)
+
+	job := t.job
+	job.EndTimestamp = time.Now().Unix()
+	job.State = types.JobDone.String()
+	t.mu.Lock()
+	if t.killed {
+		job.State = types.JobKilled.String()
+	}
+	t.mu.Unlock()
+	if t.record == nil {
+		return
+	}
+	if err := s.jobs.Save(job); err != nil {
+		zap.S().Errorf("save job %s: %v", job.Jid, err)
+	}
+}
 
-	rsp := &Response{
-		Report: report,
+// Kill 终止正在执行的任务，通知尚未返回结果的 minion 终止请求，返回这些 minion
+func (s *Scheduler) Kill(jid string) ([]string, error) {
+	var t *task
+	s.tmu.RLock()
+	for _, item := range s.taskStore {
+		if item.job != nil && item.job.Jid == jid {
+			t = item
+			break
+		}
+	}
+	s.tmu.RUnlock()
+	if t == nil {
+		job, err := s.jobs.Get(jid)
+		if err != nil {
+			return nil, err
+		}
+		return nil, apiErr.NewConflictf("job %s is not running, state: %s", jid, job.State)
 	}
 
-	return rsp, nil
+	names := t.kill()
+	for _, name := range names {
+		s.pmu.RLock()
+		p, ok := s.pipes.Get(name)
+		s.pmu.RUnlock()
+		if !ok {
+			continue
+		}
+		if err := p.cancel(t.id); err != nil {
+			zap.S().Errorf("send cancel of job %s to %s: %v", jid, name, err)
+		}
+	}
+	return names, nil
+}
+
+// recordItem 设置 minion 执行结果的时间并保存到任务缓存，pillar 模块的执行结果脱敏后保存
+func (s *Scheduler) recordItem(job *types.Job, item *types.ReportItem) {
+	if item.StartTimestamp == 0 {
+		item.StartTimestamp = job.StartTimestamp
+	}
+	if item.EndTimestamp == 0 {
+		item.EndTimestamp = time.Now().Unix()
+	}
+	if err := s.jobs.AddItem(job.Jid, redactItem(job.Request.GetFunction(), item)); err != nil {
+		zap.S().Errorf("save result of %s in job %s: %v", item.Minion, job.Jid, err)
+	}
+}
+
+// minionCall 返回发送给指定 minion 的请求，依赖 pillar 的方法携带该 minion 的 pillar 数据。
+// pillar 中的加密数据只在此时使用 master 私钥解密，整个请求由 pipe.send 使用 minion 公钥加密后下发
+func (s *Scheduler) minionCall(name string, in *types.CallRequest) (*types.CallRequest, error) {
+	var pillars map[string]*types.Value
+	if pillarRequired(in.Function) {
+		var err error
+		if pillars, err = s.minionPillars(name, in.Pillars); err != nil {
+			return nil, err
+		}
+	}
+
+	states, err := s.compileStates(name, in)
+	if err != nil {
+		return nil, err
+	}
+
+	call := &types.CallRequest{
+		Id:       in.Id,
+		Selector: in.Selector,
+		Function: in.Function,
+		Args:     in.Args,
+		Pillars:  pillars,
+		Timeout:  in.Timeout,
+		States:   states,
+		Test:     in.Test,
+	}
+	return call, nil
+}
+
+// setStatesRoot 设置 state 文件的根目录，与文件服务器 base 环境的根目录相同
+func (s *Scheduler) setStatesRoot(root string) {
+	if root != "" {
+		s.states = state.NewCompiler(root)
+	}
+}
+
+// compileStates 为 state 模块的方法编译 state 文件，其他方法返回空。
+// state.sls 使用参数中的 state 名称，state.highstate 使用 top 文件中匹配 minion 的 state 名称，
+// state.apply 没有 state 名称时等同于 state.highstate
+func (s *Scheduler) compileStates(name string, in *types.CallRequest) ([]*types.StateSource, error) {
+	// state 名称为位置参数，多个名称使用 ',' 分割
+	names := make([]string, 0)
+	for _, arg := range in.Args {
+		if strings.Contains(arg, "=") {
+			continue
+		}
+		for _, item := range strings.Split(arg, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				names = append(names, item)
+			}
+		}
+	}
+
+	highstate := false
+	switch in.Function {
+	case "state.sls", "state.show_sls":
+		if len(names) == 0 {
+			return nil, apiErr.NewBadRequestf("%s requires state names", in.Function)
+		}
+	case "state.apply":
+		highstate = len(names) == 0
+	case "state.highstate", "state.show_highstate":
+		highstate = true
+	default:
+		return nil, nil
+	}
+
+	if highstate {
+		var err error
+		names, err = s.states.Highstate(s.storage.minionTarget(name))
+		if err != nil {
+			return nil, fmt.Errorf("compile top file of %s: %w", name, err)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no states in top file match minion %s", name)
+		}
+	}
+
+	states, err := s.states.Compile(names)
+	if err != nil {
+		return nil, fmt.Errorf("compile states of %s: %w", name, err)
+	}
+	return states, nil
+}
+
+// compilePillar 编译 minion 的 pillar 数据，返回 pillar 数据和对应的 pillar 文件
+func (s *Scheduler) compilePillar(name string) (map[string]any, []string, error) {
+	return s.pillar.Compile(s.storage.minionTarget(name))
+}
+
+// minionPillar 编译并解密 minion 的 pillar 数据
+func (s *Scheduler) minionPillar(name string) (map[string]any, error) {
+	data, _, err := s.compilePillar(name)
+	if err != nil {
+		return nil, fmt.Errorf("compile pillar of %s: %w", name, err)
+	}
+	if err = pillar.Decrypt(data, s.storage.ServerRsa().Private); err != nil {
+		return nil, fmt.Errorf("decrypt pillar of %s: %w", name, err)
+	}
+	return data, nil
+}
+
+// minionPillars 返回下发给 minion 的 pillar 数据，请求中指定的 pillar 优先级最高
+func (s *Scheduler) minionPillars(name string, extra map[string]*types.Value) (map[string]*types.Value, error) {
+	data, err := s.minionPillar(name)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range extra {
+		v, err := value.Interface()
+		if err != nil {
+			return nil, apiErr.NewBadRequestf("invalid pillar %s: %v", key, err)
+		}
+		data[key] = v
+	}
+	pillars, err := types.NewValues(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode pillar of %s: %w", name, err)
+	}
+	return pillars, nil
+}
+
+// pillarRequired 返回方法是否依赖 pillar 数据，只有 pillar 和 state 模块的方法 (包括 state 文件的模板渲染)
+// 会编译和下发 pillar，避免其他方法为每个 minion 编译和解密 pillar
+func pillarRequired(function string) bool {
+	module, _, _ := strings.Cut(function, ".")
+	return module == "pillar" || module == "state"
+}
+
+// selectMinions 返回符合筛选条件的 minion 列表
+// 若存在筛选表达式，使用表达式匹配所有已接受的 minion，否则直接使用 minion 列表
+func (s *Scheduler) selectMinions(sel *types.Selector) ([]string, error) {
+	if sel == nil {
+		return []string{}, nil
+	}
+	if len(sel.Expression) == 0 {
+		return sel.Minions, nil
+	}
+
+	expr, err := selector.Parse(sel.Expression)
+	if err != nil {
+		return nil, apiErr.NewBadRequestf("invalid target expression: %v", err)
+	}
+
+	targets := make([]string, 0)
+	names := s.minions.Values()
+	sort.Strings(names)
+	for _, name := range names {
+		if expr.Match(s.storage.minionTarget(name)) {
+			targets = append(targets, name)
+		}
+	}
+	return targets, nil
+}
+
+// isOnline 判断 minion 是否已经建立连接
+func (s *Scheduler) isOnline(name string) bool {
+	s.pmu.RLock()
+	defer s.pmu.RUnlock()
+	_, ok := s.pipes.Get(name)
+	return ok
 }
 
 func (s *Scheduler) Run(ctx context.Context) {
@@ -506,6 +971,12 @@ func (s *Scheduler) Run(ctx context.Context) {
 				s.removePipe(m.name)
 				continue
 			}
+			if m.grain != nil {
+				if err := s.storage.updateGrains(m.name, m.grain); err != nil {
+					zap.L().Error("save minion grains", zap.String("id", m.name), zap.Error(err))
+				}
+				continue
+			}
 
 			msg := m.call
 			if msg == nil {
@@ -29,9 +29,13 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/master/fileserver"
 	genericserver "github.com/vine-io/maco/pkg/server"
 )
 
@@ -107,10 +111,19 @@ func (ms *Master) start(ctx context.Context) error {
 		return fmt.Errorf("create storage: %w", err)
 	}
 
-	sche, err := NewScheduler(storage)
+	jobs, err := newJobStore(filepath.Join(cfg.DataRoot, jobsPath), time.Duration(cfg.KeepJobs)*time.Hour)
+	if err != nil {
+		return fmt.Errorf("create job cache: %w", err)
+	}
+	ms.GoAttach(func() {
+		jobs.runCompact(ms.StoppingNotify(), jobCompactInterval)
+	})
+
+	sche, err := NewScheduler(storage, jobs)
 	if err != nil {
 		return fmt.Errorf("create scheduler: %w", err)
 	}
+	sche.setStatesRoot(cfg.FileRoots[types.DefaultFileEnv])
 	go sche.Run(ctx)
 
 	opts := &options{
@@ -118,6 +131,7 @@ func (ms *Master) start(ctx context.Context) error {
 		cfg:       cfg,
 		storage:   storage,
 		scheduler: sche,
+		files:     fileserver.New(cfg.FileRoots),
 	}
 	hdlr, err := registerRPCHandler(ctx, opts)
 	ms.serve = &http.Server{
@@ -0,0 +1,180 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package state compiles the state tree of maco-master for the state functions of minions.
+//
+// The state tree lives under a root directory (DataRoot/states by default), the state names
+// are resolved as the pillar names, e.g. `apps.nginx` is one of apps/nginx.yaml,
+// apps/nginx.yml, apps/nginx/init.yaml or apps/nginx/init.yml.
+// A state file includes other state files by the `include` list:
+//
+//	include:
+//	  - common
+//	  - apps.nginx
+//
+// The included files are sent to minion before the file which includes them,
+// every file is sent once.
+//
+// The top file (top.yaml in the root) maps target expressions to state files for
+// the highstate, it has the same format as the pillar top file:
+//
+//	base:
+//	  '*':
+//	    - common
+//	  'G@os:linux and web-*':
+//	    - apps.nginx
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	yamlv3 "gopkg.in/yaml.v3"
+
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/master/pillar"
+	"github.com/vine-io/maco/pkg/selector"
+)
+
+// Compiler compiles the state files for minions
+type Compiler struct {
+	root string
+}
+
+// NewCompiler creates Compiler with the root directory of state tree
+func NewCompiler(root string) *Compiler {
+	return &Compiler{root: root}
+}
+
+// Root returns the root directory of state tree
+func (c *Compiler) Root() string {
+	return c.root
+}
+
+// Top parses the top file, returns empty entries when the top file does not exist.
+func (c *Compiler) Top() ([]*pillar.Entry, error) {
+	filename := filepath.Join(c.root, pillar.DefaultTopFile)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*pillar.Entry{}, nil
+		}
+		return nil, err
+	}
+	entries, err := pillar.ParseTop(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filename, err)
+	}
+	return entries, nil
+}
+
+// Highstate returns the state names matched by the top file for the target, by the order of top file.
+func (c *Compiler) Highstate(target *selector.Target) ([]string, error) {
+	entries, err := c.Top()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	matched := map[string]struct{}{}
+	for _, entry := range entries {
+		expr, err := selector.Parse(entry.Target)
+		if err != nil {
+			return nil, fmt.Errorf("parse target '%s': %w", entry.Target, err)
+		}
+		if !expr.Match(target) {
+			continue
+		}
+		for _, name := range entry.Names {
+			if _, ok := matched[name]; ok {
+				continue
+			}
+			matched[name] = struct{}{}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Compile returns the state files of the given names and their included files by the order of execution.
+func (c *Compiler) Compile(names []string) ([]*types.StateSource, error) {
+	out := make([]*types.StateSource, 0)
+	visited := map[string]struct{}{}
+	var load func(name, from string) error
+	load = func(name, from string) error {
+		if _, ok := visited[name]; ok {
+			return nil
+		}
+		visited[name] = struct{}{}
+
+		filename, err := pillar.Resolve(c.root, name)
+		if err != nil {
+			return fmt.Errorf("invalid state name '%s'", name)
+		}
+		if filename == "" {
+			if from != "" {
+				return fmt.Errorf("state '%s' included by '%s' not found", name, from)
+			}
+			return fmt.Errorf("state '%s' not found", name)
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		includes, err := ParseIncludes(data)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", filename, err)
+		}
+		for _, include := range includes {
+			if err = load(include, name); err != nil {
+				return err
+			}
+		}
+
+		out = append(out, &types.StateSource{Name: name, Data: data})
+		return nil
+	}
+
+	for _, name := range names {
+		if err := load(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// ParseIncludes returns the included state names of state file
+func ParseIncludes(data []byte) ([]string, error) {
+	includes := make([]string, 0)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return includes, nil
+	}
+
+	var doc struct {
+		Include []string `yaml:"include"`
+	}
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return append(includes, doc.Include...), nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package state
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/internal/testutil"
+	"github.com/vine-io/maco/pkg/selector"
+)
+
+func TestCompile(t *testing.T) {
+	root := t.TempDir()
+	testutil.WriteFile(t, filepath.Join(root, "common.yaml"), "ntp:\n  pkg.installed: []\n")
+	testutil.WriteFile(t, filepath.Join(root, "users", "init.yaml"), "include:\n  - common\n")
+	testutil.WriteFile(t, filepath.Join(root, "apps", "nginx.yml"), `
+include:
+  - users
+  - common
+
+nginx:
+  pkg.installed: []
+`)
+
+	c := NewCompiler(root)
+	sources, err := c.Compile([]string{"apps.nginx", "common"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	names := make([]string, 0)
+	for _, source := range sources {
+		names = append(names, source.Name)
+	}
+	assert.Equal(t, []string{"common", "users", "apps.nginx"}, names)
+	assert.Equal(t, "ntp:\n  pkg.installed: []\n", string(sources[0].Data))
+
+	_, err = c.Compile([]string{"missing"})
+	assert.EqualError(t, err, "state 'missing' not found")
+
+	testutil.WriteFile(t, filepath.Join(root, "broken.yaml"), "include:\n  - missing\n")
+	_, err = c.Compile([]string{"broken"})
+	assert.EqualError(t, err, "state 'missing' included by 'broken' not found")
+
+	_, err = c.Compile([]string{"../etc"})
+	assert.EqualError(t, err, "invalid state name '../etc'")
+}
+
+func TestHighstate(t *testing.T) {
+	root := t.TempDir()
+	c := NewCompiler(root)
+
+	names, err := c.Highstate(&selector.Target{Name: "web-1"})
+	if assert.NoError(t, err) {
+		assert.Empty(t, names)
+	}
+
+	testutil.WriteFile(t, filepath.Join(root, "top.yaml"), `
+base:
+  '*':
+    - common
+  'G@os:linux and web-*':
+    - apps.nginx
+    - common
+  'db-*':
+    - db
+`)
+	names, err = c.Highstate(&selector.Target{Name: "web-1", Grains: map[string]any{"os": "linux"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"common", "apps.nginx"}, names)
+	}
+	names, err = c.Highstate(&selector.Target{Name: "db-1", Grains: map[string]any{"os": "linux"}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"common", "db"}, names)
+	}
+}
@@ -38,6 +38,7 @@ import (
 	"github.com/vine-io/maco/pkg/dsutil"
 	"github.com/vine-io/maco/pkg/fsutil"
 	"github.com/vine-io/maco/pkg/pemutil"
+	"github.com/vine-io/maco/pkg/selector"
 )
 
 const (
@@ -47,6 +48,8 @@ const (
 	minionPrePath    = "minions_pre"
 	minionDeniedPath = "minions_denied"
 	minionRejectPath = "minions_rejected"
+	pillarPath       = "pillar"
+	statesPath       = "states"
 )
 
 type minionEvent struct {
@@ -80,6 +83,10 @@ type Storage struct {
 	cmu         sync.RWMutex
 	minionCache map[types.MinionState]*dsutil.HashSet[string]
 
+	// minion grains 缓存，minion 离线后依然可以查询
+	gmu         sync.RWMutex
+	grainsCache map[string]map[string]any
+
 	chNextId    *atomic.Int64
 	smu         sync.RWMutex
 	subscribers map[int64]chan *storageEvent
@@ -158,6 +165,12 @@ func newStorage(opt *Options) (*Storage, error) {
 	if err = fsutil.LoadDir(filepath.Join(root, minionRejectPath)); err != nil {
 		return nil, err
 	}
+	if err = fsutil.LoadDir(filepath.Join(root, pillarPath)); err != nil {
+		return nil, err
+	}
+	if err = fsutil.LoadDir(filepath.Join(root, statesPath)); err != nil {
+		return nil, err
+	}
 
 	ms := map[types.MinionState]*dsutil.HashSet[string]{}
 	walks := func(ms map[types.MinionState]*dsutil.HashSet[string], dir string, state types.MinionState) error {
@@ -192,6 +205,7 @@ func newStorage(opt *Options) (*Storage, error) {
 		Options:     opt,
 		pair:        pair,
 		minionCache: ms,
+		grainsCache: map[string]map[string]any{},
 
 		chNextId:    &atomic.Int64{},
 		subscribers: make(map[int64]chan *storageEvent),
@@ -325,6 +339,81 @@ func (s *Storage) updateMinion(minion *types.Minion) error {
 	return nil
 }
 
+// updateGrains 保存 minion 上报的 grains 文档，同时更新缓存
+func (s *Storage) updateGrains(name string, grain *types.Grain) error {
+	if grain == nil || len(grain.Data) == 0 {
+		return nil
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(grain.Data, &doc); err != nil {
+		return fmt.Errorf("parse grains of %s: %w", name, err)
+	}
+	data, err := json.MarshalIndent(doc, "", " ")
+	if err != nil {
+		return err
+	}
+
+	minionRoot := filepath.Join(s.dir, minionPath, name)
+	_ = os.MkdirAll(minionRoot, 0700)
+	if err = fsutil.Echo(filepath.Join(minionRoot, "grains"), data, 0600); err != nil {
+		return err
+	}
+
+	s.gmu.Lock()
+	s.grainsCache[name] = doc
+	s.gmu.Unlock()
+
+	return nil
+}
+
+// getGrains 读取 minion 的 grains 文档，优先读取缓存
+func (s *Storage) getGrains(name string) (map[string]any, error) {
+	s.gmu.RLock()
+	cached, ok := s.grainsCache[name]
+	s.gmu.RUnlock()
+	if ok {
+		return copyGrains(cached), nil
+	}
+
+	data, err := fsutil.Cat(filepath.Join(s.dir, minionPath, name, "grains"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, apiErr.NewNotFound("grains not found")
+		}
+		return nil, err
+	}
+	doc := map[string]any{}
+	if err = json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	s.gmu.Lock()
+	s.grainsCache[name] = doc
+	s.gmu.Unlock()
+
+	return copyGrains(doc), nil
+}
+
+// GetGrains 返回 minion 的 grains，keys 不为空时只返回指定的键，嵌套键使用 ':' 分割
+func (s *Storage) GetGrains(name string, keys []string) (map[string]any, error) {
+	doc, err := s.getGrains(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return doc, nil
+	}
+
+	out := make(map[string]any, len(keys))
+	for _, key := range keys {
+		if value, ok := selector.Lookup(doc, key, selector.DefaultDelimiter); ok {
+			out[key] = value
+		}
+	}
+	return out, nil
+}
+
 func (s *Storage) setUpdate(name string, state types.MinionState) error {
 	filename := filepath.Join(s.dir, minionPath, name, "state")
 	data := []byte(state)
@@ -358,6 +447,46 @@ func (s *Storage) getMinion(name string) (*types.Minion, error) {
 	return &minion, nil
 }
 
+// minionTarget 返回 minion 用于目标匹配的信息
+func (s *Storage) minionTarget(name string) *selector.Target {
+	target := &selector.Target{
+		Name:   name,
+		IPs:    []string{},
+		Tags:   map[string]string{},
+		Grains: map[string]any{},
+	}
+
+	if doc, err := s.getGrains(name); err == nil {
+		target.Grains = doc
+		for _, key := range []string{"ipv4", "ipv6"} {
+			ips, _ := doc[key].([]any)
+			for _, ip := range ips {
+				if value, ok := ip.(string); ok {
+					target.IPs = append(target.IPs, value)
+				}
+			}
+		}
+	}
+
+	minion, err := s.getMinion(name)
+	if err != nil {
+		return target
+	}
+	if minion.Ip != "" {
+		target.IPs = append(target.IPs, minion.Ip)
+	}
+	for key, value := range minion.Tags {
+		target.Tags[key] = value
+	}
+	target.Grains["id"] = minion.Name
+	target.Grains["os"] = minion.Os
+	target.Grains["arch"] = minion.Arch
+	target.Grains["hostname"] = minion.Hostname
+	target.Grains["version"] = minion.Version
+
+	return target
+}
+
 func (s *Storage) GetMinion(name string) (*types.MinionKey, error) {
 	info := &types.MinionKey{}
 
@@ -503,6 +632,10 @@ func (s *Storage) DeleteMinion(name string) error {
 	event := &minionEvent{minion: name, state: state, deleted: true}
 	go s.publish(&storageEvent{minion: event})
 
+	s.gmu.Lock()
+	delete(s.grainsCache, name)
+	s.gmu.Unlock()
+
 	minionRoot := filepath.Join(s.dir, minionPath, name)
 	if err = os.RemoveAll(minionRoot); err != nil {
 		s.lg.Sugar().Errorf("remove minion %s failed: %v", name, err)
@@ -600,6 +733,15 @@ func (s *Storage) deleteMinion(id string) error {
 	return nil
 }
 
+// copyGrains 浅拷贝 grains 文档的顶层键，避免调用方修改缓存
+func copyGrains(doc map[string]any) map[string]any {
+	out := make(map[string]any, len(doc))
+	for key, value := range doc {
+		out[key] = value
+	}
+	return out
+}
+
 func walkMinions(root string, state types.MinionState) ([]string, error) {
 	kind, err := parseState(state)
 	if err != nil {
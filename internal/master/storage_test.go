@@ -0,0 +1,67 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package master
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	"github.com/vine-io/maco/api/types"
+)
+
+func TestStorageGrains(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newStorage(NewOptions(dir, zap.NewNop()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = s.GetGrains("m1", nil)
+	assert.True(t, apiErr.IsNotFound(err))
+
+	data := []byte(`{"os":"linux","ipv4":["10.0.0.1"],"ipv6":["fd00::1"],"disk_info":{"sda":{"size":100}}}`)
+	err = s.updateGrains("m1", &types.Grain{Data: data})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out, err := s.GetGrains("m1", []string{"os", "disk_info:sda:size", "missing"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]any{"os": "linux", "disk_info:sda:size": float64(100)}, out)
+	assert.Equal(t, []string{"10.0.0.1", "fd00::1"}, s.minionTarget("m1").IPs)
+
+	// 重新加载后从磁盘读取 grains
+	s2, err := newStorage(NewOptions(dir, zap.NewNop()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err = s2.GetGrains("m1", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "linux", out["os"])
+}
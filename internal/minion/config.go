@@ -54,6 +54,11 @@ type Config struct {
 
 	DataRoot string `json:"data_root" toml:"data_root"`
 
+	// 静态 grains 文件，支持 yaml、toml、json 格式，默认为 DataRoot/grains.yaml
+	GrainsFile string `json:"grains_file" toml:"grains_file"`
+	// 可执行程序目录，程序输出的 json 文档合并到 grains 中，默认为 DataRoot/grains.d
+	GrainsDir string `json:"grains_dir" toml:"grains_dir"`
+
 	Log *logutil.LogConfig `json:"log" toml:"log"`
 }
 
@@ -112,6 +117,13 @@ func (cfg *Config) init() error {
 			cfg.DataRoot = abs
 		}
 	}
+
+	if cfg.GrainsFile == "" {
+		cfg.GrainsFile = filepath.Join(cfg.DataRoot, "grains.yaml")
+	}
+	if cfg.GrainsDir == "" {
+		cfg.GrainsDir = filepath.Join(cfg.DataRoot, "grains.d")
+	}
 	return nil
 }
 
@@ -0,0 +1,418 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package minion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/client"
+	"github.com/vine-io/maco/internal/minion/module"
+)
+
+// filesPath the directory under DataRoot which caches the files of maco-master
+const filesPath = "files"
+
+// fileClient returns the client of file server of maco-master
+func (m *Minion) fileClient() (*client.FileClient, error) {
+	if m.files == nil {
+		return nil, errors.New("not connected to maco-master")
+	}
+	return m.files, nil
+}
+
+// cacheFile downloads the file of maco-master to DataRoot/files/<env>/<path>, the file
+// is not downloaded again if the cached one has the same sha256. The files of transient
+// environments are removed by uncacheFile after they are used.
+func (m *Minion) cacheFile(ctx context.Context, rawURL string) (string, *types.FileInfo, error) {
+	fc, err := m.fileClient()
+	if err != nil {
+		return "", nil, err
+	}
+	u, err := types.ParseFileURL(rawURL)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := fc.Stat(ctx, u.String())
+	if err != nil {
+		return "", nil, fmt.Errorf("stat %s: %w", u, err)
+	}
+	if info.IsDir {
+		return "", nil, fmt.Errorf("%s is a directory", u)
+	}
+
+	name := filepath.Join(m.cfg.DataRoot, filesPath, u.Env, filepath.FromSlash(u.Path))
+	if sum, hErr := module.HashFile(name, "sha256"); hErr == nil && sum == info.Hash {
+		return name, info, nil
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		return "", nil, err
+	}
+	err = module.WriteFileAtomicFunc(name, 0600, func(w io.Writer) error {
+		info, err = fc.Download(ctx, u.String(), w)
+		return err
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return name, info, nil
+}
+
+// uncacheFile removes the cached files of transient environment, the files uploaded by
+// maco-cp are used once and not kept in DataRoot/files.
+func (m *Minion) uncacheFile(rawURL string) {
+	u, err := types.ParseFileURL(rawURL)
+	if err != nil || !strings.HasPrefix(u.Env, types.CopyEnvPrefix) {
+		return
+	}
+	_ = os.RemoveAll(filepath.Join(m.cfg.DataRoot, filesPath, u.Env))
+}
+
+// cpFunctions returns the functions of cp module which fetch the files of maco-master.
+// The files are addressed by maco://<path>?env=<env>.
+func (m *Minion) cpFunctions() []*module.Function {
+	urlArg := &module.Arg{Name: "url", Type: module.String, Required: true, Doc: "the file url, e.g. maco://nginx/nginx.conf?env=prod"}
+	destArg := &module.Arg{Name: "dest", Type: module.String, Required: true, Doc: "the absolute path of destination"}
+	copyArgs := []*module.Arg{
+		{Name: "mode", Type: module.String, Doc: "the permission of files, e.g. 0644. New files are 0644 and existing files keep the mode by default"},
+		{Name: "user", Type: module.String, Doc: "the name or uid of owner"},
+		{Name: "group", Type: module.String, Doc: "the name or gid of group"},
+		{Name: "makedirs", Type: module.Boolean, Doc: "create the parent directories if they are missing"},
+	}
+	return []*module.Function{
+		{
+			Name: "cp.list_master",
+			Doc:  "List the files in the directory of maco-master file server.",
+			Args: []*module.Arg{
+				{Name: "url", Type: module.String, Default: types.FileScheme + "://", Doc: "the directory url"},
+				{Name: "recursive", Type: module.Boolean, Doc: "list the files in subdirectories"},
+			},
+			Returns: "the list of files with env, path, size, mode and isDir",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				fc, err := m.fileClient()
+				if err != nil {
+					return nil, err
+				}
+				files, err := fc.List(ctx, req.Args.String("url"), req.Args.Bool("recursive"))
+				if err != nil {
+					return nil, err
+				}
+				return module.Return(files), nil
+			},
+		},
+		{
+			Name:    "cp.hash_file",
+			Doc:     "Return the sha256 of file on maco-master.",
+			Args:    []*module.Arg{urlArg},
+			Returns: "a mapping with hash_type and hsum",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				fc, err := m.fileClient()
+				if err != nil {
+					return nil, err
+				}
+				info, err := fc.Stat(ctx, req.Args.String("url"))
+				if err != nil {
+					return nil, err
+				}
+				if info.IsDir {
+					return nil, fmt.Errorf("%s is a directory", req.Args.String("url"))
+				}
+				return module.Return(map[string]any{"hash_type": "sha256", "hsum": info.Hash}), nil
+			},
+		},
+		{
+			Name:    "cp.cache_file",
+			Doc:     "Download the file of maco-master to the cache directory of minion.",
+			Args:    []*module.Arg{urlArg},
+			Returns: "the path of cached file",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				name, _, err := m.cacheFile(ctx, req.Args.String("url"))
+				if err != nil {
+					return nil, err
+				}
+				return module.Return(name), nil
+			},
+		},
+		{
+			Name:    "cp.get_file_str",
+			Doc:     "Return the content of file on maco-master.",
+			Args:    []*module.Arg{urlArg},
+			Returns: "the content of file",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				name, _, err := m.cacheFile(ctx, req.Args.String("url"))
+				if err != nil {
+					return nil, err
+				}
+				defer m.uncacheFile(req.Args.String("url"))
+				data, err := os.ReadFile(name)
+				if err != nil {
+					return nil, err
+				}
+				return module.Return(string(data)), nil
+			},
+		},
+		{
+			Name:    "cp.get_file",
+			Doc:     "Copy the file of maco-master to the destination, the content is verified by sha256 and renamed into place atomically.",
+			Args:    append([]*module.Arg{urlArg, destArg}, copyArgs...),
+			Returns: "a mapping with path, hash, bytes and changed",
+			Handler: m.cpGetFile,
+		},
+		{
+			Name:    "cp.get_dir",
+			Doc:     "Copy the directory of maco-master to the destination recursively.",
+			Args:    append([]*module.Arg{urlArg, destArg}, copyArgs...),
+			Returns: "a mapping with path, files, bytes and changed",
+			Handler: m.cpGetDir,
+		},
+	}
+}
+
+// copyFile copies the file of maco-master to dest, the content is written to a temporary file
+// and renamed into place after its sha256 is verified. The mode and owner are applied by
+// file.chmod and file.chown, so the test mode predicts them as well.
+func (m *Minion) copyFile(ctx context.Context, req *module.Request, rawURL, dest string) (map[string]any, map[string]any, error) {
+	var mode os.FileMode
+	if text := req.Args.String("mode"); text != "" {
+		var err error
+		if mode, err = module.ParseMode(text); err != nil {
+			return nil, nil, err
+		}
+	}
+	name, info, err := m.cacheFile(ctx, rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer m.uncacheFile(rawURL)
+
+	out := map[string]any{"path": dest, "hash": info.Hash, "bytes": int64(0), "changed": false}
+	changes := map[string]any{}
+	exists := false
+	if stat, sErr := os.Stat(dest); sErr == nil {
+		if stat.IsDir() {
+			return nil, nil, fmt.Errorf("%s is a directory", dest)
+		}
+		exists = true
+		sum, hErr := module.HashFile(dest, "sha256")
+		if hErr != nil {
+			return nil, nil, hErr
+		}
+		if sum != info.Hash {
+			changes["hash"] = map[string]string{"old": sum, "new": info.Hash}
+		}
+	} else {
+		changes["hash"] = map[string]string{"old": "", "new": info.Hash}
+	}
+
+	if len(changes) > 0 {
+		out["bytes"] = info.Size
+		if !req.Test {
+			if req.Args.Bool("makedirs") {
+				if err = os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+					return nil, nil, err
+				}
+			}
+			if err = installFile(name, dest, info.Hash, mode); err != nil {
+				return nil, nil, err
+			}
+			exists = true
+		}
+	}
+
+	if exists {
+		if mode != 0 {
+			result, cErr := m.modules.Exec(ctx, req, "file.chmod", map[string]any{"path": dest, "mode": req.Args.String("mode")})
+			if cErr != nil {
+				return nil, nil, cErr
+			}
+			mergeChanges(changes, result)
+		}
+		if req.Args.String("user") != "" || req.Args.String("group") != "" {
+			result, cErr := m.modules.Exec(ctx, req, "file.chown", map[string]any{
+				"path":  dest,
+				"user":  req.Args.String("user"),
+				"group": req.Args.String("group"),
+			})
+			if cErr != nil {
+				return nil, nil, cErr
+			}
+			mergeChanges(changes, result)
+		}
+	}
+
+	out["changed"] = len(changes) > 0
+	return out, changes, nil
+}
+
+// installFile copies the cached file to dest atomically, dest is untouched if the sha256
+// of copied content does not match
+func installFile(name, dest, sum string, mode os.FileMode) error {
+	fd, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	return module.WriteFileAtomicFunc(dest, mode, func(w io.Writer) error {
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(w, h), fd); err != nil {
+			return err
+		}
+		if actual := hex.EncodeToString(h.Sum(nil)); actual != sum {
+			return fmt.Errorf("checksum of %s mismatch: %s != %s", dest, actual, sum)
+		}
+		return nil
+	})
+}
+
+// mergeChanges merges the changes of function result
+func mergeChanges(changes map[string]any, result *module.Result) {
+	if result == nil || !result.Changed {
+		return
+	}
+	if values, ok := result.Changes.(map[string]any); ok {
+		for key, value := range values {
+			changes[key] = value
+		}
+	}
+}
+
+func (m *Minion) cpGetFile(ctx context.Context, req *module.Request) (*module.Result, error) {
+	rawURL, dest := req.Args.String("url"), req.Args.String("dest")
+	if !filepath.IsAbs(dest) {
+		return nil, fmt.Errorf("dest must be an absolute path: %s", dest)
+	}
+	// the file is copied into the directory if dest is an existing directory
+	if stat, err := os.Stat(dest); err == nil && stat.IsDir() {
+		u, err := types.ParseFileURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		dest = filepath.Join(dest, path.Base(u.Path))
+	}
+
+	out, changes, err := m.copyFile(ctx, req, rawURL, dest)
+	if err != nil {
+		return nil, err
+	}
+	result := module.Return(out)
+	if len(changes) > 0 {
+		result.Changed = true
+		result.Changes = changes
+	}
+	return result, nil
+}
+
+func (m *Minion) cpGetDir(ctx context.Context, req *module.Request) (*module.Result, error) {
+	dest := req.Args.String("dest")
+	if !filepath.IsAbs(dest) {
+		return nil, fmt.Errorf("dest must be an absolute path: %s", dest)
+	}
+	fc, err := m.fileClient()
+	if err != nil {
+		return nil, err
+	}
+	u, err := types.ParseFileURL(req.Args.String("url"))
+	if err != nil {
+		return nil, err
+	}
+	files, err := fc.List(ctx, u.String(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = os.Stat(dest); os.IsNotExist(err) && !req.Args.Bool("makedirs") {
+		if _, err = os.Stat(filepath.Dir(dest)); err != nil {
+			return nil, err
+		}
+	}
+
+	copied := make([]map[string]any, 0, len(files))
+	changes := map[string]any{}
+	total := int64(0)
+	// the directories are created before files, the destination itself is the first one
+	dirs := []string{dest}
+	for _, file := range files {
+		if file.IsDir {
+			rel := strings.TrimPrefix(strings.TrimPrefix(file.Path, u.Path), "/")
+			dirs = append(dirs, filepath.Join(dest, filepath.FromSlash(rel)))
+		}
+	}
+	for _, dir := range dirs {
+		if _, sErr := os.Stat(dir); !os.IsNotExist(sErr) {
+			continue
+		}
+		changes[dir] = map[string]string{"old": "", "new": "directory"}
+		if req.Test {
+			continue
+		}
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		if req.Args.String("user") != "" || req.Args.String("group") != "" {
+			args := map[string]any{"path": dir, "user": req.Args.String("user"), "group": req.Args.String("group")}
+			if _, err = m.modules.Exec(ctx, req, "file.chown", args); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, file := range files {
+		if file.IsDir {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(file.Path, u.Path), "/")
+		target := filepath.Join(dest, filepath.FromSlash(rel))
+		fileURL := &types.FileURL{Env: u.Env, Path: file.Path}
+		out, fileChanges, cErr := m.copyFile(ctx, req, fileURL.String(), target)
+		if cErr != nil {
+			return nil, fmt.Errorf("copy %s: %w", file.Path, cErr)
+		}
+		if len(fileChanges) > 0 {
+			changes[target] = fileChanges
+		}
+		total += out["bytes"].(int64)
+		copied = append(copied, out)
+	}
+
+	out := map[string]any{
+		"path":    dest,
+		"files":   copied,
+		"bytes":   total,
+		"changed": len(changes) > 0,
+	}
+	result := module.Return(out)
+	if len(changes) > 0 {
+		result.Changed = true
+		result.Changes = changes
+	}
+	return result, nil
+}
@@ -22,19 +22,72 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package minion
 
 import (
-	"bytes"
 	"context"
-	"fmt"
-	"os/exec"
-	"time"
+	"errors"
+	"sync"
 
 	"github.com/vmihailenco/msgpack/v5"
+	"go.uber.org/zap"
 
 	"github.com/vine-io/maco/api/types"
 	"github.com/vine-io/maco/client"
 	"github.com/vine-io/maco/pkg/pemutil"
 )
 
+// errKilled is the cause of the call context when the master kills the job
+var errKilled = errors.New("killed")
+
+// runningCalls tracks the calls in progress, so that the master can cancel them by id
+type runningCalls struct {
+	mu      sync.Mutex
+	cancels map[uint64]context.CancelCauseFunc
+}
+
+func newRunningCalls() *runningCalls {
+	return &runningCalls{cancels: make(map[uint64]context.CancelCauseFunc)}
+}
+
+// start returns the context of call and the function to call when it is done
+func (rc *runningCalls) start(ctx context.Context, id uint64) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	rc.mu.Lock()
+	rc.cancels[id] = cancel
+	rc.mu.Unlock()
+
+	return ctx, func() {
+		rc.mu.Lock()
+		delete(rc.cancels, id)
+		rc.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// kill cancels the call with errKilled, reports whether the call is running
+func (rc *runningCalls) kill(id uint64) bool {
+	rc.mu.Lock()
+	cancel, ok := rc.cancels[id]
+	rc.mu.Unlock()
+	if ok {
+		cancel(errKilled)
+	}
+	return ok
+}
+
+// call runs the request with the context returned by runningCalls.start and
+// replies the result to master
+func (m *Minion) call(ctx context.Context, done func(), dispatcher *client.Dispatcher, in *types.CallRequest) {
+	defer done()
+
+	rsp := m.modules.Call(ctx, in)
+	if errors.Is(context.Cause(ctx), errKilled) && rsp.Type != types.ResultType_ResultOk {
+		rsp.Type = types.ResultType_ResultError
+		rsp.Error = errKilled.Error()
+	}
+	if err := dispatcher.Call(rsp); err != nil {
+		zap.L().Error("reply call result", zap.Uint64("id", in.Id), zap.Error(err))
+	}
+}
+
 func (m *Minion) dispatch(dispatcher *client.Dispatcher) {
 	for {
 		event, err := dispatcher.Recv()
@@ -74,46 +127,19 @@ func (m *Minion) dispatch(dispatcher *client.Dispatcher) {
 			if in.Timeout == 0 {
 				in.Timeout = 10
 			}
-			rsp, e1 := runCmd(m.ctx, in)
-			if e1 != nil {
-
+			// requests run concurrently, so that they can be killed while running.
+			// The call is registered before the goroutine starts, otherwise a cancel
+			// following the call closely may find nothing to kill
+			ctx, done := m.calls.start(m.ctx, in.Id)
+			go m.call(ctx, done, dispatcher, in)
+		case types.EventType_EventCancel:
+			msg := event.Call
+			if msg == nil {
+				continue
+			}
+			if m.calls.kill(msg.Id) {
+				zap.L().Info("kill call", zap.Uint64("id", msg.Id))
 			}
-			_ = dispatcher.Call(rsp)
 		}
 	}
 }
-
-func runCmd(ctx context.Context, in *types.CallRequest) (*types.CallResponse, error) {
-	timeout := time.Duration(in.Timeout) * time.Second
-	callCtx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-
-	shell := fmt.Sprintf("%s", in.Function)
-	for _, arg := range in.Args {
-		shell += " " + arg
-	}
-
-	buf := bytes.NewBufferString("")
-	cmd := exec.CommandContext(callCtx, "/bin/bash", "-c", shell)
-	cmd.Stdout = buf
-	cmd.Stderr = buf
-	var e1 error
-	if e1 = cmd.Start(); e1 == nil {
-		e1 = cmd.Wait()
-	}
-
-	callRsp := &types.CallResponse{
-		Id:   in.Id,
-		Type: types.ResultType_ResultOk,
-	}
-
-	callRsp.RetCode = int32(cmd.ProcessState.ExitCode())
-	if e1 != nil {
-		callRsp.Type = types.ResultType_ResultError
-		callRsp.Error = buf.String()
-	} else {
-		callRsp.Result = bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
-	}
-
-	return callRsp, e1
-}
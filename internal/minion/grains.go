@@ -0,0 +1,137 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package minion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/minion/grains"
+	"github.com/vine-io/maco/internal/minion/module"
+	"github.com/vine-io/maco/pkg/selector"
+)
+
+// refreshGrains collects the grains of current host and caches them.
+// The grains are merged by the following order, the later one takes precedence:
+//
+//  1. core grains collected from /proc, /sys and /etc
+//  2. json output of the executables in Config.GrainsDir, by the lexical order of names
+//  3. static grains in Config.GrainsFile
+//
+// The `id` grain is always the name of minion.
+func (m *Minion) refreshGrains() grains.Grains {
+	cfg := m.cfg
+	lg := cfg.Logger()
+
+	g := grains.NewCollector().Collect()
+
+	custom, errs := grains.LoadExecutables(m.ctx, cfg.GrainsDir)
+	for _, err := range errs {
+		lg.Warn("load custom grains", zap.Error(err))
+	}
+	grains.Merge(g, custom)
+
+	static, err := grains.LoadStatic(cfg.GrainsFile)
+	if err != nil {
+		lg.Warn("load static grains", zap.Error(err))
+	} else {
+		grains.Merge(g, static)
+	}
+
+	g["id"] = cfg.Name
+
+	m.gmu.Lock()
+	m.grains = g
+	m.gmu.Unlock()
+
+	return g
+}
+
+// Grains returns the cached grains document
+func (m *Minion) Grains() grains.Grains {
+	m.gmu.RLock()
+	defer m.gmu.RUnlock()
+
+	out := make(grains.Grains, len(m.grains))
+	for key, value := range m.grains {
+		out[key] = value
+	}
+	return out
+}
+
+// grainMessage converts cached grains to types.Grain
+func (m *Minion) grainMessage() *types.Grain {
+	data, err := json.Marshal(m.Grains())
+	if err != nil {
+		zap.L().Error("marshal grains", zap.Error(err))
+		data = []byte("{}")
+	}
+	return &types.Grain{
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	}
+}
+
+// grainsFunctions returns the functions of grains module
+func (m *Minion) grainsFunctions() []*module.Function {
+	return []*module.Function{
+		{
+			Name:    "grains.items",
+			Doc:     "Return all of the grains of minion.",
+			Returns: "the grains document",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				return module.Return(m.Grains()), nil
+			},
+		},
+		{
+			Name:    "grains.item",
+			Doc:     "Return one or more grains, nested keys are separated by ':'.",
+			Varargs: "keys",
+			Returns: "the mapping of key and grain value, the missing key is null",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				g := m.Grains()
+				items := map[string]any{}
+				for _, key := range req.Varargs {
+					items[key], _ = selector.Lookup(g, key, selector.DefaultDelimiter)
+				}
+				return module.Return(items), nil
+			},
+		},
+		{
+			Name:    "grains.refresh",
+			Doc:     "Collect the grains again and send them to maco-master.",
+			Returns: "the refreshed grains document",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				g := m.refreshGrains()
+				if err := m.dispatcher.Grains(m.grainMessage()); err != nil {
+					return nil, fmt.Errorf("send grains to master: %w", err)
+				}
+				return module.Return(g), nil
+			},
+		},
+	}
+}
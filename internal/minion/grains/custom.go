@@ -0,0 +1,145 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package grains
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vine-io/maco/pkg/dsutil"
+)
+
+var (
+	// DefaultExecTimeout is the timeout of every executable in grains.d
+	DefaultExecTimeout = time.Second * 30
+)
+
+// LoadStatic reads the static grains file, yaml, toml and json formats are supported.
+// The missing file is treated as empty grains.
+func LoadStatic(filename string) (Grains, error) {
+	g := Grains{}
+	if filename == "" {
+		return g, nil
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return g, nil
+		}
+		return nil, err
+	}
+
+	switch ext := filepath.Ext(filename); ext {
+	case ".toml":
+		err = toml.Unmarshal(data, &g)
+	case ".json":
+		err = json.Unmarshal(data, &g)
+	case ".yaml", ".yml", "":
+		err = yaml.Unmarshal(data, &g)
+	default:
+		return nil, fmt.Errorf("invalid grains format: %s", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse grains file %s: %w", filename, err)
+	}
+	return g, nil
+}
+
+// LoadExecutables runs the executables in dir by the lexical order of names,
+// and merges the json objects they print to stdout. The output of later
+// executables overrides the earlier ones. The failed executables are reported
+// by errs and skipped.
+func LoadExecutables(ctx context.Context, dir string) (Grains, []error) {
+	g := Grains{}
+	errs := make([]error, 0)
+	if dir == "" {
+		return g, errs
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		return g, errs
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Mode()&0111 == 0 {
+			continue
+		}
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		out, err := runExecutable(ctx, filepath.Join(dir, name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("grains executable %s: %w", name, err))
+			continue
+		}
+		Merge(g, out)
+	}
+
+	return g, errs
+}
+
+func runExecutable(ctx context.Context, path string) (Grains, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultExecTimeout)
+	defer cancel()
+
+	stdout := bytes.NewBufferString("")
+	stderr := bytes.NewBufferString("")
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	g := Grains{}
+	if err := json.Unmarshal(stdout.Bytes(), &g); err != nil {
+		return nil, fmt.Errorf("parse output: %w", err)
+	}
+	return g, nil
+}
+
+// Merge merges src into dst recursively, the values of src take precedence
+func Merge(dst, src Grains) Grains {
+	return dsutil.MergeMap(dst, src)
+}
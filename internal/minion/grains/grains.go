@@ -0,0 +1,407 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package grains collects the static facts (grains) of the host which runs
+// maco-minion. Most of the facts are read from /proc, /sys and /etc, the
+// missing sources are skipped silently so that the collection never fails on
+// a partially populated system.
+package grains
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	version "github.com/vine-io/maco/pkg/version"
+)
+
+// Grains is the grains document of a minion
+type Grains = map[string]any
+
+// Collector gathers grains from the filesystem rooted at root
+type Collector struct {
+	root string
+}
+
+// NewCollector creates Collector reading from the host filesystem
+func NewCollector() *Collector {
+	return NewCollectorWithRoot("/")
+}
+
+// NewCollectorWithRoot creates Collector reading from the specified root directory
+func NewCollectorWithRoot(root string) *Collector {
+	return &Collector{root: root}
+}
+
+// Collect returns the grains document of current host
+func (c *Collector) Collect() Grains {
+	g := Grains{}
+
+	hostname, _ := os.Hostname()
+	g["host"] = hostname
+	g["fqdn"] = fqdn(hostname)
+	g["os"] = runtime.GOOS
+	g["arch"] = runtime.GOARCH
+	g["num_cpus"] = runtime.NumCPU()
+	g["maco_version"] = version.GitTag
+	g["collected_at"] = time.Now().Unix()
+
+	c.collectKernel(g)
+	c.collectDistro(g)
+	c.collectCPU(g)
+	c.collectMemory(g)
+	c.collectDisks(g)
+	c.collectNetwork(g)
+	c.collectVirtual(g)
+	c.collectBootTime(g)
+	c.collectMachineID(g)
+
+	return g
+}
+
+func (c *Collector) path(elem ...string) string {
+	return filepath.Join(append([]string{c.root}, elem...)...)
+}
+
+func (c *Collector) read(elem ...string) string {
+	data, err := os.ReadFile(c.path(elem...))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func (c *Collector) collectKernel(g Grains) {
+	if value := c.read("proc/sys/kernel/ostype"); value != "" {
+		g["kernel"] = value
+	} else {
+		g["kernel"] = strings.ToUpper(runtime.GOOS[:1]) + runtime.GOOS[1:]
+	}
+	if value := c.read("proc/sys/kernel/osrelease"); value != "" {
+		g["kernelrelease"] = value
+	}
+	if value := c.read("proc/sys/kernel/version"); value != "" {
+		g["kernelversion"] = value
+	}
+}
+
+func (c *Collector) collectDistro(g Grains) {
+	var data string
+	for _, name := range []string{"etc/os-release", "usr/lib/os-release"} {
+		if data = c.read(name); data != "" {
+			break
+		}
+	}
+	if data == "" {
+		return
+	}
+
+	release := ParseKeyValue(data, "=")
+	if value := release["ID"]; value != "" {
+		g["distro"] = value
+		g["os_family"] = value
+	}
+	if value := release["ID_LIKE"]; value != "" {
+		g["os_family"] = strings.Fields(value)[0]
+	}
+	if value := release["VERSION_ID"]; value != "" {
+		g["distro_version"] = value
+	}
+	if value := release["VERSION_CODENAME"]; value != "" {
+		g["distro_codename"] = value
+	}
+	if value := release["PRETTY_NAME"]; value != "" {
+		g["distro_name"] = value
+	}
+}
+
+func (c *Collector) collectCPU(g Grains) {
+	data := c.read("proc/cpuinfo")
+	if data == "" {
+		return
+	}
+
+	processors := 0
+	physical := map[string]struct{}{}
+	for _, block := range strings.Split(data, "\n\n") {
+		info := ParseKeyValue(block, ":")
+		if _, ok := info["processor"]; !ok {
+			continue
+		}
+		processors += 1
+		if value, ok := info["physical id"]; ok {
+			physical[value] = struct{}{}
+		}
+		if _, ok := g["cpu_model"]; !ok {
+			for _, key := range []string{"model name", "Model", "cpu model", "Processor"} {
+				if value := info[key]; value != "" {
+					g["cpu_model"] = value
+					break
+				}
+			}
+		}
+		if _, ok := g["cpu_flags"]; !ok {
+			// arm 使用 Features
+			for _, key := range []string{"flags", "Features"} {
+				if value := info[key]; value != "" {
+					g["cpu_flags"] = strings.Fields(value)
+					break
+				}
+			}
+		}
+	}
+	if processors > 0 {
+		g["num_cpus"] = processors
+	}
+	if len(physical) > 0 {
+		g["num_sockets"] = len(physical)
+	}
+}
+
+func (c *Collector) collectMemory(g Grains) {
+	data := c.read("proc/meminfo")
+	if data == "" {
+		return
+	}
+
+	info := ParseKeyValue(data, ":")
+	// 单位为 MiB
+	if value, ok := parseKB(info["MemTotal"]); ok {
+		g["mem_total"] = value / 1024
+	}
+	if value, ok := parseKB(info["SwapTotal"]); ok {
+		g["swap_total"] = value / 1024
+	}
+}
+
+func (c *Collector) collectDisks(g Grains) {
+	entries, err := os.ReadDir(c.path("sys/block"))
+	if err != nil {
+		return
+	}
+
+	disks := map[string]any{}
+	names := make([]string, 0)
+	ssds := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		disk := map[string]any{}
+		if value, err := strconv.ParseUint(c.read("sys/block", name, "size"), 10, 64); err == nil {
+			// size 单位为 512 字节的扇区
+			disk["size"] = value * 512
+		}
+		if c.read("sys/block", name, "queue/rotational") == "0" {
+			disk["type"] = "ssd"
+			ssds = append(ssds, name)
+		} else {
+			disk["type"] = "hdd"
+		}
+		if value := c.read("sys/block", name, "device/model"); value != "" {
+			disk["model"] = value
+		}
+		disks[name] = disk
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	sort.Strings(ssds)
+	g["disks"] = names
+	g["ssds"] = ssds
+	g["disk_info"] = disks
+}
+
+func (c *Collector) collectNetwork(g Grains) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return
+	}
+
+	ipInterfaces := map[string]any{}
+	ip4Interfaces := map[string]any{}
+	ip6Interfaces := map[string]any{}
+	hwaddrInterfaces := map[string]any{}
+	ipv4 := make([]string, 0)
+	ipv6 := make([]string, 0)
+	for _, iface := range ifaces {
+		all := make([]string, 0)
+		v4 := make([]string, 0)
+		v6 := make([]string, 0)
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipNet.IP.String()
+			all = append(all, ip)
+			if ipNet.IP.To4() != nil {
+				v4 = append(v4, ip)
+			} else {
+				v6 = append(v6, ip)
+			}
+		}
+		ipInterfaces[iface.Name] = all
+		ip4Interfaces[iface.Name] = v4
+		ip6Interfaces[iface.Name] = v6
+		if len(iface.HardwareAddr) != 0 {
+			hwaddrInterfaces[iface.Name] = iface.HardwareAddr.String()
+		}
+		ipv4 = append(ipv4, v4...)
+		ipv6 = append(ipv6, v6...)
+	}
+
+	g["ip_interfaces"] = ipInterfaces
+	g["ip4_interfaces"] = ip4Interfaces
+	g["ip6_interfaces"] = ip6Interfaces
+	g["hwaddr_interfaces"] = hwaddrInterfaces
+	g["ipv4"] = ipv4
+	g["ipv6"] = ipv6
+}
+
+func (c *Collector) collectVirtual(g Grains) {
+	virtual := "physical"
+
+	product := strings.ToLower(c.read("sys/class/dmi/id/product_name"))
+	vendor := strings.ToLower(c.read("sys/class/dmi/id/sys_vendor"))
+	cgroup := c.read("proc/1/cgroup")
+	flags, _ := g["cpu_flags"].([]string)
+
+	switch {
+	case fsExists(c.path(".dockerenv")) || strings.Contains(cgroup, "docker"):
+		virtual = "docker"
+	case strings.Contains(cgroup, "kubepods"):
+		virtual = "kubernetes"
+	case strings.Contains(cgroup, "lxc") || fsExists(c.path("dev/lxd")):
+		virtual = "lxc"
+	case strings.Contains(product, "kvm") || strings.Contains(vendor, "qemu"):
+		virtual = "kvm"
+	case strings.Contains(product, "vmware") || strings.Contains(vendor, "vmware"):
+		virtual = "VMware"
+	case strings.Contains(product, "virtualbox"):
+		virtual = "VirtualBox"
+	case strings.Contains(vendor, "microsoft"):
+		virtual = "HyperV"
+	case strings.Contains(vendor, "xen") || fsExists(c.path("proc/xen")):
+		virtual = "xen"
+	case containsString(flags, "hypervisor"):
+		virtual = "virtual"
+	}
+
+	g["virtual"] = virtual
+}
+
+func (c *Collector) collectBootTime(g Grains) {
+	data := c.read("proc/stat")
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "btime" {
+			if value, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+				g["boot_time"] = value
+			}
+			return
+		}
+	}
+}
+
+func (c *Collector) collectMachineID(g Grains) {
+	for _, name := range []string{"etc/machine-id", "var/lib/dbus/machine-id"} {
+		if value := c.read(name); value != "" {
+			g["machine_id"] = value
+			return
+		}
+	}
+}
+
+// ParseKeyValue parses the lines of `key<sep>value` text, the quotes around value are removed
+func ParseKeyValue(text, sep string) map[string]string {
+	out := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewBufferString(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, sep)
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		value = strings.Trim(value, `"'`)
+		out[key] = value
+	}
+	return out
+}
+
+// parseKB parses the value like `6147400 kB`
+func parseKB(text string) (uint64, bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// lookupTimeout bounds the dns lookup of the fqdn grain, so that a broken
+// resolver does not block the registration of minion
+const lookupTimeout = 2 * time.Second
+
+func fqdn(hostname string) string {
+	if hostname == "" {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+	cname, err := net.DefaultResolver.LookupCNAME(ctx, hostname)
+	if err != nil || cname == "" {
+		return hostname
+	}
+	return strings.TrimSuffix(cname, ".")
+}
+
+func fsExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
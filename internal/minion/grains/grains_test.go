@@ -0,0 +1,144 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package grains
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, root, name, data string) {
+	path := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	root := t.TempDir()
+
+	writeFile(t, root, "etc/os-release", `NAME="Rocky Linux"
+VERSION_ID="9.3"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+PRETTY_NAME="Rocky Linux 9.3 (Blue Onyx)"
+`)
+	writeFile(t, root, "etc/machine-id", "0123456789abcdef\n")
+	writeFile(t, root, "proc/sys/kernel/ostype", "Linux\n")
+	writeFile(t, root, "proc/sys/kernel/osrelease", "5.14.0-362.el9.x86_64\n")
+	writeFile(t, root, "proc/cpuinfo", `processor	: 0
+model name	: Intel(R) Xeon(R) Gold 6230
+physical id	: 0
+flags		: fpu vme hypervisor
+
+processor	: 1
+model name	: Intel(R) Xeon(R) Gold 6230
+physical id	: 0
+flags		: fpu vme hypervisor
+`)
+	writeFile(t, root, "proc/meminfo", "MemTotal:        8388608 kB\nSwapTotal:       2097152 kB\n")
+	writeFile(t, root, "proc/stat", "cpu  1 2 3 4\nbtime 1700000000\n")
+	writeFile(t, root, "sys/block/sda/size", "2097152\n")
+	writeFile(t, root, "sys/block/sda/queue/rotational", "0\n")
+	writeFile(t, root, "sys/block/loop0/size", "8\n")
+	writeFile(t, root, "sys/class/dmi/id/product_name", "KVM\n")
+
+	g := NewCollectorWithRoot(root).Collect()
+
+	assert.Equal(t, "Linux", g["kernel"])
+	assert.Equal(t, "5.14.0-362.el9.x86_64", g["kernelrelease"])
+	assert.Equal(t, "rocky", g["distro"])
+	assert.Equal(t, "rhel", g["os_family"])
+	assert.Equal(t, "9.3", g["distro_version"])
+	assert.Equal(t, "Intel(R) Xeon(R) Gold 6230", g["cpu_model"])
+	assert.Equal(t, 2, g["num_cpus"])
+	assert.Equal(t, 1, g["num_sockets"])
+	assert.Equal(t, uint64(8192), g["mem_total"])
+	assert.Equal(t, uint64(2048), g["swap_total"])
+	assert.Equal(t, []string{"sda"}, g["disks"])
+	assert.Equal(t, []string{"sda"}, g["ssds"])
+	assert.Equal(t, "kvm", g["virtual"])
+	assert.Equal(t, int64(1700000000), g["boot_time"])
+	assert.Equal(t, "0123456789abcdef", g["machine_id"])
+	assert.Equal(t, []string{"fpu", "vme", "hypervisor"}, g["cpu_flags"])
+}
+
+func TestCollectArmCPU(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "proc/cpuinfo", `processor	: 0
+BogoMIPS	: 48.00
+Features	: fp asimd evtstrm aes crc32
+CPU implementer	: 0x41
+`)
+
+	g := NewCollectorWithRoot(root).Collect()
+	assert.Equal(t, 1, g["num_cpus"])
+	assert.Equal(t, []string{"fp", "asimd", "evtstrm", "aes", "crc32"}, g["cpu_flags"])
+}
+
+func TestCustomGrains(t *testing.T) {
+	root := t.TempDir()
+
+	writeFile(t, root, "grains.yaml", `
+roles:
+  - web
+datacenter: dc1
+owner:
+  team: ops
+`)
+	writeFile(t, root, "grains.d/10-site", "#!/bin/sh\necho '{\"datacenter\": \"dc2\", \"rack\": \"r1\", \"owner\": {\"email\": \"ops@example.com\"}}'\n")
+	writeFile(t, root, "grains.d/20-broken", "#!/bin/sh\necho 'not json'\n")
+	for _, name := range []string{"10-site", "20-broken"} {
+		if err := os.Chmod(filepath.Join(root, "grains.d", name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g := Grains{"os": "linux", "datacenter": "unknown"}
+
+	custom, errs := LoadExecutables(context.Background(), filepath.Join(root, "grains.d"))
+	assert.Equal(t, 1, len(errs))
+	Merge(g, custom)
+
+	static, err := LoadStatic(filepath.Join(root, "grains.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	Merge(g, static)
+
+	assert.Equal(t, "linux", g["os"])
+	assert.Equal(t, "dc1", g["datacenter"])
+	assert.Equal(t, "r1", g["rack"])
+	assert.Equal(t, []any{"web"}, g["roles"])
+	assert.Equal(t, map[string]any{"team": "ops", "email": "ops@example.com"}, g["owner"])
+
+	missing, err := LoadStatic(filepath.Join(root, "missing.yaml"))
+	assert.NoError(t, err)
+	assert.Empty(t, missing)
+}
@@ -28,12 +28,16 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/vine-io/maco/api/types"
 	"github.com/vine-io/maco/client"
+	"github.com/vine-io/maco/internal/minion/grains"
+	"github.com/vine-io/maco/internal/minion/module"
+	"github.com/vine-io/maco/internal/minion/state"
 	"github.com/vine-io/maco/pkg/fsutil"
 	"github.com/vine-io/maco/pkg/pemutil"
 	genericserver "github.com/vine-io/maco/pkg/server"
@@ -50,7 +54,17 @@ type Minion struct {
 
 	rsaPair *pemutil.RsaPair
 
+	gmu    sync.RWMutex
+	grains grains.Grains
+
+	// 执行模块
+	modules *module.Registry
+	// 正在执行的请求
+	calls *runningCalls
+
 	masterClient *client.Client
+	dispatcher   *client.Dispatcher
+	files        *client.FileClient
 }
 
 func NewMinion(cfg *Config) (*Minion, error) {
@@ -60,7 +74,24 @@ func NewMinion(cfg *Config) (*Minion, error) {
 	ms := &Minion{
 		IEmbedServer: es,
 
-		cfg: cfg,
+		cfg:     cfg,
+		modules: module.NewRegistry(),
+		calls:   newRunningCalls(),
+	}
+
+	module.RegisterBuiltin(ms.modules)
+	ms.modules.SetGrainsFunc(ms.Grains)
+	if err := ms.modules.Register(ms.grainsFunctions()...); err != nil {
+		return nil, err
+	}
+	if err := ms.modules.Register(ms.pillarFunctions()...); err != nil {
+		return nil, err
+	}
+	if err := ms.modules.Register(ms.cpFunctions()...); err != nil {
+		return nil, err
+	}
+	if err := ms.modules.Register(state.Functions(ms.modules)...); err != nil {
+		return nil, err
 	}
 	return ms, nil
 }
@@ -96,6 +127,9 @@ func (m *Minion) start(ctx context.Context) error {
 		return fmt.Errorf("setup minion: %w", err)
 	}
 
+	lg.Info("collecting minion grains")
+	m.refreshGrains()
+
 	target := cfg.Master
 
 	ccfg := client.NewConfig(target)
@@ -103,10 +137,12 @@ func (m *Minion) start(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("connect to maco-master: %w", err)
 	}
+	m.masterClient = masterClient
 
 	in := &types.ConnectRequest{
 		Minion:          minion,
 		MinionPublicKey: pair.Public,
+		Grain:           m.grainMessage(),
 	}
 	var dispatcher *client.Dispatcher
 	dispatcher, minion, err = masterClient.NewDispatcher(ctx, in, lg, m.cfg.DataRoot)
@@ -114,6 +150,8 @@ func (m *Minion) start(ctx context.Context) error {
 		return fmt.Errorf("connect to dispatcher: %w", err)
 	}
 	_ = m.setMinion(minion)
+	m.dispatcher = dispatcher
+	m.files = masterClient.NewFileClient(minion.Name, pair.Private)
 
 	go m.dispatch(dispatcher)
 	return nil
@@ -0,0 +1,281 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ArgType is the type of function argument
+type ArgType string
+
+const (
+	String  ArgType = "string"
+	Integer ArgType = "int"
+	Float   ArgType = "float"
+	Boolean ArgType = "bool"
+	// List accepts json array or comma separated text
+	List ArgType = "list"
+	// Map accepts json object
+	Map ArgType = "map"
+)
+
+// Arg describes an argument of function
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Required bool
+	// Default the default value when the argument is omitted, it must be the parsed type,
+	// e.g. int64 for Integer, []string for List
+	Default any
+	// Keyword the argument can only be passed by name=value, positional arguments skip it
+	Keyword bool
+	Doc     string
+}
+
+// Args is the parsed arguments keyed by name
+type Args map[string]any
+
+// Has checks whether the argument is set
+func (a Args) Has(name string) bool {
+	_, ok := a[name]
+	return ok
+}
+
+func (a Args) String(name string) string {
+	v, _ := a[name].(string)
+	return v
+}
+
+func (a Args) Int(name string) int64 {
+	v, _ := a[name].(int64)
+	return v
+}
+
+func (a Args) Float(name string) float64 {
+	v, _ := a[name].(float64)
+	return v
+}
+
+func (a Args) Bool(name string) bool {
+	v, _ := a[name].(bool)
+	return v
+}
+
+func (a Args) List(name string) []string {
+	v, _ := a[name].([]string)
+	return v
+}
+
+func (a Args) Map(name string) map[string]any {
+	v, _ := a[name].(map[string]any)
+	return v
+}
+
+// ParseArgs parses raw arguments by the schema of function.
+// The argument like `name=value` is a keyword argument when name is defined in schema,
+// the others are positional arguments which are assigned by the order of schema.
+func ParseArgs(fn *Function, raw []string) (Args, []string, error) {
+	schema := make(map[string]*Arg, len(fn.Args))
+	for _, arg := range fn.Args {
+		schema[arg.Name] = arg
+	}
+
+	args := Args{}
+	varargs := make([]string, 0)
+	positional := make([]string, 0, len(raw))
+	for _, text := range raw {
+		if key, value, ok := strings.Cut(text, "="); ok {
+			if arg, exists := schema[key]; exists {
+				v, err := arg.parse(value)
+				if err != nil {
+					return nil, nil, err
+				}
+				args[key] = v
+				continue
+			}
+		}
+		positional = append(positional, text)
+	}
+
+	idx := 0
+	for _, text := range positional {
+		for idx < len(fn.Args) && (fn.Args[idx].Keyword || args.Has(fn.Args[idx].Name)) {
+			idx += 1
+		}
+		if idx >= len(fn.Args) {
+			if fn.Varargs == "" {
+				return nil, nil, fmt.Errorf("%s: too many arguments", fn.Name)
+			}
+			varargs = append(varargs, text)
+			continue
+		}
+		arg := fn.Args[idx]
+		v, err := arg.parse(text)
+		if err != nil {
+			return nil, nil, err
+		}
+		args[arg.Name] = v
+	}
+
+	for _, arg := range fn.Args {
+		if args.Has(arg.Name) {
+			continue
+		}
+		if arg.Required {
+			return nil, nil, fmt.Errorf("%s: missing required argument '%s'", fn.Name, arg.Name)
+		}
+		if arg.Default != nil {
+			args[arg.Name] = arg.Default
+		}
+	}
+
+	return args, varargs, nil
+}
+
+// ParseArgsMap parses the typed arguments by the schema of function, e.g. the arguments decoded
+// from yaml. The string value is parsed as ParseArgs does, the others are converted to the type of argument.
+func ParseArgsMap(fn *Function, values map[string]any) (Args, error) {
+	schema := make(map[string]*Arg, len(fn.Args))
+	for _, arg := range fn.Args {
+		schema[arg.Name] = arg
+	}
+
+	args := Args{}
+	for key, value := range values {
+		arg, ok := schema[key]
+		if !ok {
+			return nil, fmt.Errorf("%s: unexpected argument '%s'", fn.Name, key)
+		}
+		v, err := arg.convert(value)
+		if err != nil {
+			return nil, err
+		}
+		args[key] = v
+	}
+
+	for _, arg := range fn.Args {
+		if args.Has(arg.Name) {
+			continue
+		}
+		if arg.Required {
+			return nil, fmt.Errorf("%s: missing required argument '%s'", fn.Name, arg.Name)
+		}
+		if arg.Default != nil {
+			args[arg.Name] = arg.Default
+		}
+	}
+	return args, nil
+}
+
+// convert converts the typed value to the type of argument
+func (a *Arg) convert(value any) (any, error) {
+	if text, ok := value.(string); ok {
+		return a.parse(text)
+	}
+
+	var v any
+	ok := false
+	switch a.Type {
+	case Integer:
+		switch n := value.(type) {
+		case int:
+			v, ok = int64(n), true
+		case int64:
+			v, ok = n, true
+		case uint64:
+			v, ok = int64(n), true
+		case float64:
+			v, ok = int64(n), n == float64(int64(n))
+		}
+	case Float:
+		switch n := value.(type) {
+		case int:
+			v, ok = float64(n), true
+		case int64:
+			v, ok = float64(n), true
+		case uint64:
+			v, ok = float64(n), true
+		case float64:
+			v, ok = n, true
+		}
+	case Boolean:
+		v, ok = value.(bool)
+	case List:
+		if items, isList := value.([]any); isList {
+			list := make([]string, 0, len(items))
+			for _, item := range items {
+				list = append(list, fmt.Sprint(item))
+			}
+			v, ok = list, true
+		} else if items, isList := value.([]string); isList {
+			v, ok = items, true
+		}
+	case Map:
+		v, ok = value.(map[string]any)
+	default:
+		switch value.(type) {
+		case int, int64, uint64, float64, bool:
+			v, ok = fmt.Sprint(value), true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid argument %s (%s): unexpected value %v", a.Name, a.Type, value)
+	}
+	return v, nil
+}
+
+func (a *Arg) parse(text string) (any, error) {
+	var v any
+	var err error
+	switch a.Type {
+	case Integer:
+		v, err = strconv.ParseInt(text, 10, 64)
+	case Float:
+		v, err = strconv.ParseFloat(text, 64)
+	case Boolean:
+		v, err = strconv.ParseBool(text)
+	case List:
+		items := make([]string, 0)
+		if strings.HasPrefix(strings.TrimSpace(text), "[") {
+			err = json.Unmarshal([]byte(text), &items)
+		} else if text != "" {
+			for _, item := range strings.Split(text, ",") {
+				items = append(items, strings.TrimSpace(item))
+			}
+		}
+		v = items
+	case Map:
+		out := map[string]any{}
+		err = json.Unmarshal([]byte(text), &out)
+		v = out
+	default:
+		v = text
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid argument %s (%s): %v", a.Name, a.Type, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,429 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultShell the shell used to execute commands
+	DefaultShell = "/bin/bash"
+	// NoShell executes the command directly without shell
+	NoShell = "none"
+
+	// waitDelay is how long to wait for the output of command after it is killed
+	waitDelay = 5 * time.Second
+)
+
+// cmdArgs returns the common arguments of cmd functions
+func cmdArgs() []*Arg {
+	return []*Arg{
+		{Name: "cwd", Type: String, Keyword: true, Doc: "the working directory, defaults to the home of runas user or /"},
+		{Name: "env", Type: List, Keyword: true, Doc: "extra environment variables, e.g. env=A=1,B=2"},
+		{Name: "runas", Type: String, Keyword: true, Doc: "the user to run the command as"},
+		{Name: "stdin", Type: String, Keyword: true, Doc: "the data passed to stdin of the command"},
+		{Name: "shell", Type: String, Keyword: true, Default: DefaultShell, Doc: "the shell to execute the command, 'none' executes it without shell"},
+	}
+}
+
+// CmdFunctions returns the functions of cmd module
+func CmdFunctions() []*Function {
+	return []*Function{
+		{
+			Name: "cmd.run",
+			Doc:  "Execute the passed command and return the output as a string.",
+			Args: append([]*Arg{
+				{Name: "cmd", Type: String, Required: true, Doc: "the command to execute"},
+			}, cmdArgs()...),
+			Returns: "the combined output of stdout and stderr, the trailing newline is removed. " +
+				"A non-zero exit code is reported as an error.",
+			Handler: cmdRun,
+		},
+		{
+			Name: "cmd.run_all",
+			Doc:  "Execute the passed command and return stdout, stderr, retcode and pid separately.",
+			Args: append([]*Arg{
+				{Name: "cmd", Type: String, Required: true, Doc: "the command to execute"},
+			}, cmdArgs()...),
+			Returns: "a mapping with pid, retcode, stdout and stderr. A non-zero exit code is not an error.",
+			Handler: cmdRunAll,
+		},
+		{
+			Name: "cmd.script",
+			Doc:  "Execute a script on the minion, the script is a local file or the passed code.",
+			Args: append([]*Arg{
+				{Name: "source", Type: String, Doc: "the path of script on minion"},
+				{Name: "args", Type: String, Doc: "the arguments passed to the script, e.g. args='-v \"a b\"'"},
+				{Name: "code", Type: String, Doc: "the content of script, used when source is not set"},
+			}, cmdArgs()...),
+			Returns: "a mapping with pid, retcode, stdout and stderr. A non-zero exit code is not an error.",
+			Handler: cmdScript,
+		},
+	}
+}
+
+// RunOptions is the options of process started by cmd functions
+type RunOptions struct {
+	// Cmd the command line executed by shell
+	Cmd string
+	// Args the arguments appended to the command when it is executed without shell,
+	// the first one is the program when Cmd is empty
+	Args  []string
+	Cwd   string
+	Env   []string
+	Runas string
+	Stdin string
+	Shell string
+}
+
+func newRunOptions(req *Request) *RunOptions {
+	return &RunOptions{
+		Cmd:   req.Args.String("cmd"),
+		Cwd:   req.Args.String("cwd"),
+		Env:   req.Args.List("env"),
+		Runas: req.Args.String("runas"),
+		Stdin: req.Args.String("stdin"),
+		Shell: req.Args.String("shell"),
+	}
+}
+
+// RunOutput is the output of process
+type RunOutput struct {
+	Pid     int32  `json:"pid"`
+	RetCode int32  `json:"retcode"`
+	Stdout  string `json:"stdout"`
+	Stderr  string `json:"stderr"`
+
+	// combined output of stdout and stderr
+	output string
+}
+
+func (out *RunOutput) result(v any) *Result {
+	return &Result{
+		Return:  v,
+		RetCode: out.RetCode,
+		Stdout:  out.Stdout,
+		Stderr:  out.Stderr,
+		Pid:     out.Pid,
+	}
+}
+
+// Run starts the process and waits for it to exit, the error is returned only when
+// the process can not be started or is killed by context.
+func Run(ctx context.Context, opts *RunOptions) (*RunOutput, error) {
+	var name string
+	var argv []string
+	if opts.Shell == "" || opts.Shell == NoShell {
+		parts, err := SplitCommand(opts.Cmd)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, opts.Args...)
+		if len(parts) == 0 {
+			return nil, errors.New("empty command")
+		}
+		name, argv = parts[0], parts[1:]
+	} else {
+		name, argv = opts.Shell, []string{"-c", opts.Cmd}
+		if len(opts.Args) > 0 {
+			// 参数通过 "$@" 传递给命令
+			argv = append(argv, opts.Shell)
+			argv = append(argv, opts.Args...)
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, name, argv...)
+	// kill the whole process group when the context is done, and stop waiting for the
+	// output held by the processes which leave the group
+	setProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	cmd.Env = os.Environ()
+	cmd.Dir = opts.Cwd
+	if opts.Runas != "" {
+		env, err := setCredential(cmd, opts.Runas)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+	if cmd.Dir == "" {
+		cmd.Dir = "/"
+		if home, ok := envValue(cmd.Env, "HOME"); ok && opts.Runas != "" {
+			cmd.Dir = home
+		}
+	}
+	cmd.Env = append(cmd.Env, opts.Env...)
+	if opts.Stdin != "" {
+		cmd.Stdin = strings.NewReader(opts.Stdin)
+	}
+
+	stdout := bytes.NewBufferString("")
+	stderr := bytes.NewBufferString("")
+	combined := &lockedBuffer{}
+	cmd.Stdout = io.MultiWriter(stdout, combined)
+	cmd.Stderr = io.MultiWriter(stderr, combined)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	out := &RunOutput{Pid: int32(cmd.Process.Pid)}
+
+	err := cmd.Wait()
+	out.Stdout = strings.TrimSuffix(stdout.String(), "\n")
+	out.Stderr = strings.TrimSuffix(stderr.String(), "\n")
+	out.output = strings.TrimSuffix(combined.String(), "\n")
+	if cmd.ProcessState != nil {
+		out.RetCode = int32(cmd.ProcessState.ExitCode())
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			return out, errors.New("command timed out")
+		}
+		return out, context.Cause(ctx)
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return out, err
+	}
+	return out, nil
+}
+
+// cmdPending returns the result of command in test mode, the command is not run
+func cmdPending(cmd string) *Result {
+	out := map[string]any{"cmd": cmd, "changed": true}
+	return changedResult(out, map[string]any{"cmd": cmd})
+}
+
+func cmdRun(ctx context.Context, req *Request) (*Result, error) {
+	if req.Test {
+		return cmdPending(req.Args.String("cmd")), nil
+	}
+	out, err := Run(ctx, newRunOptions(req))
+	if out == nil {
+		return nil, err
+	}
+	result := out.result(out.output)
+	if err == nil && out.RetCode != 0 {
+		msg := out.output
+		if msg == "" {
+			msg = fmt.Sprintf("exit status %d", out.RetCode)
+		}
+		err = errors.New(msg)
+	}
+	return result, err
+}
+
+func cmdRunAll(ctx context.Context, req *Request) (*Result, error) {
+	if req.Test {
+		return cmdPending(req.Args.String("cmd")), nil
+	}
+	out, err := Run(ctx, newRunOptions(req))
+	if out == nil {
+		return nil, err
+	}
+	return out.result(out), err
+}
+
+func cmdScript(ctx context.Context, req *Request) (*Result, error) {
+	if req.Test {
+		source := req.Args.String("source")
+		if source == "" {
+			source = "<code>"
+		}
+		return cmdPending(strings.TrimSpace(source + " " + req.Args.String("args"))), nil
+	}
+	opts := newRunOptions(req)
+
+	source := req.Args.String("source")
+	if source == "" {
+		code := req.Args.String("code")
+		if code == "" {
+			return nil, errors.New("source or code is required")
+		}
+		fd, err := os.CreateTemp("", "maco-script-*")
+		if err != nil {
+			return nil, fmt.Errorf("create script: %w", err)
+		}
+		source = fd.Name()
+		defer os.Remove(source)
+
+		_, err = fd.WriteString(code)
+		_ = fd.Close()
+		if err != nil {
+			return nil, fmt.Errorf("write script: %w", err)
+		}
+		if err = os.Chmod(source, 0700); err != nil {
+			return nil, err
+		}
+		if opts.Runas != "" {
+			if err = chownTo(source, opts.Runas); err != nil {
+				return nil, err
+			}
+		}
+	} else if !filepath.IsAbs(source) && opts.Cwd != "" {
+		source = filepath.Join(opts.Cwd, source)
+	}
+
+	if _, err := os.Stat(source); err != nil {
+		return nil, fmt.Errorf("script: %w", err)
+	}
+
+	// 脚本作为 shell 的参数执行，不要求脚本有执行权限
+	if opts.Shell == "" || opts.Shell == NoShell {
+		opts.Cmd = QuoteCommand([]string{source})
+	} else {
+		opts.Cmd = QuoteCommand([]string{opts.Shell, source})
+	}
+	opts.Shell = NoShell
+	args, err := SplitCommand(req.Args.String("args"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid script arguments: %w", err)
+	}
+	opts.Args = args
+
+	out, err := Run(ctx, opts)
+	if out == nil {
+		return nil, err
+	}
+	return out.result(out), err
+}
+
+// execArgv executes argv directly without shell, returns the output. The exit code in allowed is not an error.
+func execArgv(ctx context.Context, env []string, argv []string, allowed ...int32) (*RunOutput, error) {
+	out, err := Run(ctx, &RunOptions{
+		Args:  argv,
+		Env:   env,
+		Shell: NoShell,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.RetCode == 0 {
+		return out, nil
+	}
+	for _, code := range allowed {
+		if out.RetCode == code {
+			return out, nil
+		}
+	}
+	msg := out.Stderr
+	if msg == "" {
+		msg = out.Stdout
+	}
+	return nil, fmt.Errorf("%s: exit status %d: %s", argv[0], out.RetCode, msg)
+}
+
+// SplitCommand splits the command line to arguments, supports quotes and backslash
+func SplitCommand(text string) ([]string, error) {
+	args := make([]string, 0)
+	var buf strings.Builder
+	var quote rune
+	inArg := false
+	escaped := false
+	for _, c := range text {
+		switch {
+		case escaped:
+			buf.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				buf.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, buf.String())
+				buf.Reset()
+				inArg = false
+			}
+		default:
+			buf.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape in command")
+	}
+	if inArg {
+		args = append(args, buf.String())
+	}
+	return args, nil
+}
+
+// QuoteCommand joins arguments to a command line which is safe for shell
+func QuoteCommand(args []string) string {
+	out := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`!*?[]{}()<>|&;#~") {
+			out = append(out, arg)
+			continue
+		}
+		out = append(out, "'"+strings.ReplaceAll(arg, "'", `'\''`)+"'")
+	}
+	return strings.Join(out, " ")
+}
+
+// lockedBuffer is a bytes.Buffer which is safe for concurrent writes
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func envValue(env []string, key string) (string, bool) {
+	value, found := "", false
+	for _, item := range env {
+		if k, v, ok := strings.Cut(item, "="); ok && k == key {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
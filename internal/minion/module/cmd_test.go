@@ -0,0 +1,109 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func TestSplitCommand(t *testing.T) {
+	args, err := SplitCommand(`echo "hello world" 'a b' c\ d`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"echo", "hello world", "a b", "c d"}, args)
+
+	_, err = SplitCommand(`echo "hello`)
+	assert.Error(t, err)
+
+	assert.Equal(t, `ls '/tmp/a b' 'it'\''s'`, QuoteCommand([]string{"ls", "/tmp/a b", "it's"}))
+}
+
+func TestCmdFunctions(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltin(r)
+	ctx := context.TODO()
+	dir := t.TempDir()
+
+	rsp := r.Call(ctx, &types.CallRequest{
+		Function: "cmd.run_all",
+		Args:     []string{"echo out; echo err >&2; pwd; echo $FOO; cat", "cwd=" + dir, "env=FOO=bar", "stdin=input"},
+	})
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, "out\n"+dir+"\nbar\ninput", rsp.Stdout)
+	assert.Equal(t, "err", rsp.Stderr)
+	assert.NotZero(t, rsp.Pid)
+
+	out := RunOutput{}
+	_ = json.Unmarshal(rsp.Result, &out)
+	assert.Equal(t, rsp.Stdout, out.Stdout)
+	assert.Equal(t, rsp.Pid, out.Pid)
+
+	rsp = r.Call(ctx, &types.CallRequest{Function: "cmd.run_all", Args: []string{"exit 2"}})
+	assert.Equal(t, types.ResultType_ResultOk, rsp.Type)
+	assert.Equal(t, int32(2), rsp.RetCode)
+
+	rsp = r.Call(ctx, &types.CallRequest{Function: "cmd.run", Args: []string{`echo "a  b"`, "shell=none"}})
+	var text string
+	_ = json.Unmarshal(rsp.Result, &text)
+	assert.Equal(t, "a  b", text)
+
+	// the common options are keyword only, an extra positional argument is not taken as cwd
+	rsp = r.Call(ctx, &types.CallRequest{Function: "cmd.run", Args: []string{"pwd", dir}})
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Contains(t, rsp.Error, "too many arguments")
+
+	rsp = r.Call(ctx, &types.CallRequest{Function: "cmd.run", Args: []string{"sleep 5"}, Timeout: 1})
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Equal(t, "command timed out", rsp.Error)
+
+	rsp = r.Call(ctx, &types.CallRequest{
+		Function: "cmd.script",
+		Args:     []string{"code=echo $1-$2", "args=x 'y'"},
+	})
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, "x-y", rsp.Stdout)
+}
+
+func TestRunKillProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	killed := errors.New("killed")
+	time.AfterFunc(200*time.Millisecond, func() { cancel(killed) })
+
+	// the background sleep holds the output, Run returns quickly only when it is killed too
+	start := time.Now()
+	_, err := Run(ctx, &RunOptions{Cmd: "sleep 30 & sleep 30", Shell: "/bin/sh"})
+	assert.Equal(t, killed, err)
+	assert.Less(t, time.Since(start), waitDelay)
+}
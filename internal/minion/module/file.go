@@ -0,0 +1,885 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FileFunctions returns the functions of file module
+func FileFunctions() []*Function {
+	pathArg := &Arg{Name: "path", Type: String, Required: true, Doc: "the absolute path of file"}
+	return []*Function{
+		{
+			Name:    "file.read",
+			Doc:     "Return the content of file.",
+			Args:    []*Arg{pathArg},
+			Returns: "a mapping with path, size and content",
+			Handler: fileRead,
+		},
+		{
+			Name: "file.write",
+			Doc:  "Write the content to file, the file is replaced atomically.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "content", Type: String, Required: true, Doc: "the content of file"},
+				{Name: "mode", Type: String, Doc: "the permission of file, e.g. 0644. Keeps the current mode by default"},
+				{Name: "makedirs", Type: Boolean, Doc: "create the parent directories if they are missing"},
+			},
+			Returns: "a mapping with path, size and changed",
+			Handler: fileWrite,
+		},
+		{
+			Name: "file.append",
+			Doc:  "Append the content to the end of file, the lines which already exist are skipped.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "content", Type: String, Required: true, Doc: "the lines to append"},
+			},
+			Returns: "a mapping with path, the appended lines and changed",
+			Handler: fileAppend,
+		},
+		{
+			Name:    "file.stat",
+			Doc:     "Return the information of file, symlinks are not followed.",
+			Args:    []*Arg{pathArg},
+			Returns: "a mapping with path, type, size, mode, uid, gid, user, group, mtime and target of symlink",
+			Handler: fileStat,
+		},
+		{
+			Name: "file.hash",
+			Doc:  "Return the checksum of file.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "algorithm", Type: String, Default: "sha256", Doc: "one of md5, sha1, sha256 and sha512"},
+			},
+			Returns: "a mapping with path, algorithm and hash",
+			Handler: fileHash,
+		},
+		{
+			Name:    "file.exists",
+			Doc:     "Check whether the file exists.",
+			Args:    []*Arg{pathArg},
+			Returns: "a mapping with path, exists and type",
+			Handler: fileExists,
+		},
+		{
+			Name: "file.mkdir",
+			Doc:  "Create the directory and its parents.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "mode", Type: String, Default: "0755", Doc: "the permission of directory"},
+			},
+			Returns: "a mapping with path and changed",
+			Handler: fileMkdir,
+		},
+		{
+			Name: "file.remove",
+			Doc:  "Remove the file or directory.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "recurse", Type: Boolean, Doc: "remove the directory and its children"},
+			},
+			Returns: "a mapping with path and changed",
+			Handler: fileRemove,
+		},
+		{
+			Name: "file.chmod",
+			Doc:  "Change the permission of file.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "mode", Type: String, Required: true, Doc: "the permission of file, e.g. 0644"},
+			},
+			Returns: "a mapping with path, mode and changed",
+			Handler: fileChmod,
+		},
+		{
+			Name: "file.chown",
+			Doc:  "Change the owner and group of file.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "user", Type: String, Doc: "the name or uid of owner"},
+				{Name: "group", Type: String, Doc: "the name or gid of group"},
+			},
+			Returns: "a mapping with path, user, group and changed",
+			Handler: fileChown,
+		},
+		{
+			Name: "file.replace",
+			Doc:  "Replace the occurrences of regular expression in file.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "pattern", Type: String, Required: true, Doc: "the regular expression, (?m) is enabled"},
+				{Name: "repl", Type: String, Required: true, Doc: "the replacement text, supports $1 for submatches"},
+				{Name: "count", Type: Integer, Default: int64(0), Doc: "the max number of replacements, 0 means all"},
+			},
+			Returns: "a mapping with path, the number of replacements and changed",
+			Handler: fileReplace,
+		},
+		{
+			Name: "file.search",
+			Doc:  "Search the regular expression in file.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "pattern", Type: String, Required: true, Doc: "the regular expression"},
+			},
+			Returns: "a mapping with path, found and the matched lines with line numbers",
+			Handler: fileSearch,
+		},
+		{
+			Name: "file.line",
+			Doc:  "Ensure a line is present or absent in file.",
+			Args: []*Arg{
+				pathArg,
+				{Name: "content", Type: String, Required: true, Doc: "the content of line"},
+				{Name: "ensure", Type: String, Default: "present", Doc: "present or absent"},
+				{Name: "match", Type: String, Doc: "the regular expression of lines which are replaced or removed, defaults to the line itself"},
+			},
+			Returns: "a mapping with path and changed",
+			Handler: fileLine,
+		},
+	}
+}
+
+func filePath(req *Request) (string, error) {
+	path := req.Args.String("path")
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path '%s' is not absolute", path)
+	}
+	return filepath.Clean(path), nil
+}
+
+// ParseMode parses the octal permission text, e.g. 0644
+func ParseMode(text string) (os.FileMode, error) {
+	v, err := strconv.ParseUint(text, 8, 32)
+	if err != nil || v > 07777 {
+		return 0, fmt.Errorf("invalid file mode '%s'", text)
+	}
+	mode := os.FileMode(v & 0777)
+	if v&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if v&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if v&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// FormatMode returns the octal text of permission
+func FormatMode(mode os.FileMode) string {
+	v := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		v |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		v |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		v |= 01000
+	}
+	return fmt.Sprintf("%04o", v)
+}
+
+// WriteFileAtomic writes data to a temporary file and renames it to filename,
+// the mode and owner of existing file are kept.
+func WriteFileAtomic(filename string, data []byte, mode os.FileMode) error {
+	return WriteFileAtomicFunc(filename, mode, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// WriteFileAtomicFunc is WriteFileAtomic which streams the content by write,
+// the filename is untouched if write returns error.
+func WriteFileAtomicFunc(filename string, mode os.FileMode, write func(w io.Writer) error) error {
+	dir := filepath.Dir(filename)
+	fd, err := os.CreateTemp(dir, "."+filepath.Base(filename)+".maco-*")
+	if err != nil {
+		return err
+	}
+	tmp := fd.Name()
+	defer os.Remove(tmp)
+
+	if err = write(fd); err != nil {
+		_ = fd.Close()
+		return err
+	}
+	if err = fd.Sync(); err != nil {
+		_ = fd.Close()
+		return err
+	}
+	if err = fd.Close(); err != nil {
+		return err
+	}
+
+	if stat, sErr := os.Stat(filename); sErr == nil {
+		if mode == 0 {
+			mode = stat.Mode()
+		}
+		if uid, gid, ok := fileOwner(stat); ok {
+			_ = os.Lchown(tmp, uid, gid)
+		}
+	}
+	if mode == 0 {
+		mode = 0644
+	}
+	if err = os.Chmod(tmp, mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func fileRead(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{
+		"path":    path,
+		"size":    len(data),
+		"content": string(data),
+	}
+	return Return(out), nil
+}
+
+func fileWrite(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	content := []byte(req.Args.String("content"))
+
+	var mode os.FileMode
+	if text := req.Args.String("mode"); text != "" {
+		if mode, err = ParseMode(text); err != nil {
+			return nil, err
+		}
+	}
+	if req.Args.Bool("makedirs") && !req.Test {
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := map[string]any{}
+	stat, err := os.Stat(path)
+	switch {
+	case err == nil:
+		if stat.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", path)
+		}
+		current, rErr := os.ReadFile(path)
+		if rErr != nil {
+			return nil, rErr
+		}
+		if !bytes.Equal(current, content) {
+			changes["diff"] = "content changed"
+		}
+		if mode != 0 && stat.Mode().Perm() != mode.Perm() {
+			changes["mode"] = map[string]string{"old": FormatMode(stat.Mode()), "new": FormatMode(mode)}
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		changes["diff"] = "new file"
+	default:
+		return nil, err
+	}
+
+	if len(changes) > 0 && !req.Test {
+		if err = WriteFileAtomic(path, content, mode); err != nil {
+			return nil, err
+		}
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"size":    len(content),
+		"changed": len(changes) > 0,
+	}
+	return changedResult(out, changes), nil
+}
+
+func fileAppend(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	exists := map[string]struct{}{}
+	for _, line := range strings.Split(string(current), "\n") {
+		exists[line] = struct{}{}
+	}
+	appended := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSuffix(req.Args.String("content"), "\n"), "\n") {
+		if _, ok := exists[line]; ok {
+			continue
+		}
+		exists[line] = struct{}{}
+		appended = append(appended, line)
+	}
+
+	if len(appended) > 0 && !req.Test {
+		buf := bytes.NewBuffer(current)
+		if len(current) > 0 && !bytes.HasSuffix(current, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(strings.Join(appended, "\n") + "\n")
+		if err = WriteFileAtomic(path, buf.Bytes(), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"lines":   appended,
+		"changed": len(appended) > 0,
+	}
+	return changedResult(out, map[string]any{"appended": appended}), nil
+}
+
+func fileStat(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := map[string]any{
+		"path":  path,
+		"type":  fileType(stat.Mode()),
+		"size":  stat.Size(),
+		"mode":  FormatMode(stat.Mode()),
+		"mtime": stat.ModTime().Unix(),
+	}
+	if uid, gid, ok := fileOwner(stat); ok {
+		out["uid"] = uid
+		out["gid"] = gid
+		out["user"] = userName(uid)
+		out["group"] = groupName(gid)
+	}
+	if stat.Mode()&os.ModeSymlink != 0 {
+		out["target"], _ = os.Readlink(path)
+	}
+	return Return(out), nil
+}
+
+func fileType(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return "file"
+	case mode.IsDir():
+		return "dir"
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeNamedPipe != 0:
+		return "pipe"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	default:
+		return "unknown"
+	}
+}
+
+// NewHash returns the hash.Hash by algorithm name
+func NewHash(algorithm string) (hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "md5":
+		return md5.New(), nil
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256", "":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm '%s'", algorithm)
+	}
+}
+
+// HashFile returns the hex checksum of file
+func HashFile(filename, algorithm string) (string, error) {
+	h, err := NewHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	fd, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	if _, err = io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func fileHash(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	algorithm := strings.ToLower(req.Args.String("algorithm"))
+	sum, err := HashFile(path, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{
+		"path":      path,
+		"algorithm": algorithm,
+		"hash":      sum,
+	}
+	return Return(out), nil
+}
+
+func fileExists(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{
+		"path":   path,
+		"exists": false,
+	}
+	stat, err := os.Lstat(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		return Return(out), nil
+	}
+	out["exists"] = true
+	out["type"] = fileType(stat.Mode())
+	return Return(out), nil
+}
+
+func fileMkdir(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := ParseMode(req.Args.String("mode"))
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	stat, err := os.Stat(path)
+	if err == nil {
+		if !stat.IsDir() {
+			return nil, fmt.Errorf("%s exists and is not a directory", path)
+		}
+	} else {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if !req.Test {
+			if err = os.MkdirAll(path, mode); err != nil {
+				return nil, err
+			}
+		}
+		changed = true
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"changed": changed,
+	}
+	return changedResult(out, map[string]any{"created": path}), nil
+}
+
+func fileRemove(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	if path == "/" {
+		return nil, errors.New("refusing to remove /")
+	}
+
+	changed := false
+	stat, err := os.Lstat(path)
+	if err == nil {
+		switch {
+		case req.Test:
+		case stat.IsDir() && req.Args.Bool("recurse"):
+			err = os.RemoveAll(path)
+		default:
+			err = os.Remove(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		changed = true
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"changed": changed,
+	}
+	return changedResult(out, map[string]any{"removed": path}), nil
+}
+
+func fileChmod(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := ParseMode(req.Args.String("mode"))
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	old := FormatMode(stat.Mode())
+	changed := old != FormatMode(mode)
+	if changed && !req.Test {
+		if err = os.Chmod(path, mode); err != nil {
+			return nil, err
+		}
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"mode":    FormatMode(mode),
+		"changed": changed,
+	}
+	return changedResult(out, map[string]any{"mode": map[string]string{"old": old, "new": FormatMode(mode)}}), nil
+}
+
+func fileChown(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	userText, groupText := req.Args.String("user"), req.Args.String("group")
+	if userText == "" && groupText == "" {
+		return nil, errors.New("user or group is required")
+	}
+	stat, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	uid, gid, ok := fileOwner(stat)
+	if !ok {
+		return nil, errors.New("chown is not supported on this platform")
+	}
+
+	newUid, newGid := uid, gid
+	if userText != "" {
+		if newUid, err = lookupUid(userText); err != nil {
+			return nil, err
+		}
+	}
+	if groupText != "" {
+		if newGid, err = lookupGid(groupText); err != nil {
+			return nil, err
+		}
+	}
+
+	changes := map[string]any{}
+	if newUid != uid {
+		changes["user"] = map[string]string{"old": userName(uid), "new": userName(newUid)}
+	}
+	if newGid != gid {
+		changes["group"] = map[string]string{"old": groupName(gid), "new": groupName(newGid)}
+	}
+	if len(changes) > 0 && !req.Test {
+		if err = os.Lchown(path, newUid, newGid); err != nil {
+			return nil, err
+		}
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"user":    userName(newUid),
+		"group":   groupName(newGid),
+		"changed": len(changes) > 0,
+	}
+	return changedResult(out, changes), nil
+}
+
+func fileReplace(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile("(?m)" + req.Args.String("pattern"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	repl := []byte(req.Args.String("repl"))
+	limit := int(req.Args.Int("count"))
+	if limit <= 0 {
+		limit = -1
+	}
+	matches := re.FindAllSubmatchIndex(data, limit)
+	replaced := make([]byte, 0, len(data))
+	last := 0
+	for _, match := range matches {
+		replaced = append(replaced, data[last:match[0]]...)
+		replaced = re.Expand(replaced, repl, data, match)
+		last = match[1]
+	}
+	replaced = append(replaced, data[last:]...)
+	count := len(matches)
+
+	changed := !bytes.Equal(data, replaced)
+	if changed && !req.Test {
+		if err = WriteFileAtomic(path, replaced, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"count":   count,
+		"changed": changed,
+	}
+	return changedResult(out, map[string]any{"replaced": count}), nil
+}
+
+func fileSearch(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	re, err := regexp.Compile(req.Args.String("pattern"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	matches := make([]map[string]any, 0)
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if re.MatchString(line) {
+			matches = append(matches, map[string]any{"line": n, "text": line})
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"found":   len(matches) > 0,
+		"matches": matches,
+	}
+	return Return(out), nil
+}
+
+func fileLine(ctx context.Context, req *Request) (*Result, error) {
+	path, err := filePath(req)
+	if err != nil {
+		return nil, err
+	}
+	content := strings.TrimSuffix(req.Args.String("content"), "\n")
+	ensure := req.Args.String("ensure")
+	if ensure != "present" && ensure != "absent" {
+		return nil, fmt.Errorf("invalid ensure '%s', must be present or absent", ensure)
+	}
+
+	var re *regexp.Regexp
+	if pattern := req.Args.String("match"); pattern != "" {
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid match: %w", err)
+		}
+	}
+	matched := func(line string) bool {
+		if re != nil {
+			return re.MatchString(line)
+		}
+		return line == content
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if ensure == "absent" {
+			out := map[string]any{"path": path, "changed": false}
+			return Return(out), nil
+		}
+	}
+
+	text := string(data)
+	lines := []string{}
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+
+	result := make([]string, 0, len(lines)+1)
+	changes := map[string]any{}
+	switch ensure {
+	case "present":
+		found := false
+		for _, line := range lines {
+			if line == content {
+				found = true
+			}
+		}
+		if !found {
+			replaced := false
+			for _, line := range lines {
+				if !replaced && re != nil && re.MatchString(line) {
+					changes["old"] = line
+					line = content
+					replaced = true
+				}
+				result = append(result, line)
+			}
+			if !replaced {
+				result = append(result, content)
+			}
+			changes["new"] = content
+		} else {
+			result = lines
+		}
+	case "absent":
+		removed := make([]string, 0)
+		for _, line := range lines {
+			if matched(line) {
+				removed = append(removed, line)
+				continue
+			}
+			result = append(result, line)
+		}
+		if len(removed) > 0 {
+			changes["removed"] = removed
+		}
+	}
+
+	changed := len(changes) > 0
+	if changed && !req.Test {
+		out := strings.Join(result, "\n")
+		if len(result) > 0 {
+			out += "\n"
+		}
+		if err = WriteFileAtomic(path, []byte(out), 0); err != nil {
+			return nil, err
+		}
+	}
+
+	out := map[string]any{
+		"path":    path,
+		"changed": changed,
+	}
+	return changedResult(out, changes), nil
+}
+
+// changedResult creates Result with changes, the changes are ignored if out["changed"] is false
+func changedResult(out map[string]any, changes any) *Result {
+	result := Return(out)
+	if changed, _ := out["changed"].(bool); changed {
+		result.Changed = true
+		result.Changes = changes
+	}
+	return result
+}
+
+func userName(uid int) string {
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(uid)
+}
+
+func groupName(gid int) string {
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		return g.Name
+	}
+	return strconv.Itoa(gid)
+}
+
+// lookupUid returns the uid of user name or uid text
+func lookupUid(text string) (int, error) {
+	if uid, err := strconv.Atoi(text); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(text)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(u.Uid)
+}
+
+// lookupGid returns the gid of group name or gid text
+func lookupGid(text string) (int, error) {
+	if gid, err := strconv.Atoi(text); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(text)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func TestFileTestMode(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltin(r)
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.conf")
+	_ = os.WriteFile(name, []byte("port=80\n"), 0644)
+
+	rsp, out := callRequestJSON[map[string]any](r, &types.CallRequest{
+		Function: "file.write", Args: []string{filepath.Join(dir, "sub", "b.conf"), "content=x", "makedirs=true"}, Test: true})
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, true, out["changed"])
+	assert.True(t, rsp.Changes.Changed)
+	assert.True(t, rsp.Changes.Test)
+	_, err := os.Stat(filepath.Join(dir, "sub"))
+	assert.True(t, os.IsNotExist(err))
+
+	_, out = callRequestJSON[map[string]any](r, &types.CallRequest{Function: "file.replace", Args: []string{name, "pattern=^port=80$", "repl=port=8080"}, Test: true})
+	assert.Equal(t, true, out["changed"])
+	_, out = callRequestJSON[map[string]any](r, &types.CallRequest{Function: "file.chmod", Args: []string{name, "0600"}, Test: true})
+	assert.Equal(t, true, out["changed"])
+	_, out = callRequestJSON[map[string]any](r, &types.CallRequest{Function: "file.remove", Args: []string{name}, Test: true})
+	assert.Equal(t, true, out["changed"])
+
+	stat, err := os.Stat(name)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0644), stat.Mode().Perm())
+	}
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "port=80\n", string(data))
+}
+
+func TestFileFunctions(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltin(r)
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.conf")
+
+	rsp, out := callJSON[map[string]any](r, "file.write", name, "content=port=80\nuser=www\n", "mode=0600")
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, true, out["changed"])
+	assert.True(t, rsp.Changes.Changed)
+
+	rsp, out = callJSON[map[string]any](r, "file.write", name, "content=port=80\nuser=www\n")
+	assert.Equal(t, false, out["changed"])
+	assert.Nil(t, rsp.Changes)
+
+	_, out = callJSON[map[string]any](r, "file.stat", name)
+	assert.Equal(t, "file", out["type"])
+	assert.Equal(t, "0600", out["mode"])
+
+	_, out = callJSON[map[string]any](r, "file.chmod", name, "0644")
+	assert.Equal(t, true, out["changed"])
+	_, out = callJSON[map[string]any](r, "file.chmod", name, "0644")
+	assert.Equal(t, false, out["changed"])
+
+	_, out = callJSON[map[string]any](r, "file.replace", name, `pattern=^port=(\d+)$`, "repl=port=8${1}")
+	assert.Equal(t, true, out["changed"])
+	assert.Equal(t, float64(1), out["count"])
+
+	_, out = callJSON[map[string]any](r, "file.search", name, "pattern=^port")
+	assert.Equal(t, true, out["found"])
+	assert.Equal(t, []any{map[string]any{"line": float64(1), "text": "port=880"}}, out["matches"])
+
+	_, out = callJSON[map[string]any](r, "file.line", name, "content=user=nginx", "match=^user=")
+	assert.Equal(t, true, out["changed"])
+	_, out = callJSON[map[string]any](r, "file.line", name, "content=user=nginx", "match=^user=")
+	assert.Equal(t, false, out["changed"])
+	_, out = callJSON[map[string]any](r, "file.append", name, "content=user=nginx\nworkers=4")
+	assert.Equal(t, []any{"workers=4"}, out["lines"])
+	_, out = callJSON[map[string]any](r, "file.line", name, "content=workers=4", "ensure=absent")
+	assert.Equal(t, true, out["changed"])
+
+	data, _ := os.ReadFile(name)
+	assert.Equal(t, "port=880\nuser=nginx\n", string(data))
+
+	_, out = callJSON[map[string]any](r, "file.read", name)
+	assert.Equal(t, string(data), out["content"])
+
+	_, out = callJSON[map[string]any](r, "file.hash", name, "algorithm=md5")
+	sum, _ := HashFile(name, "md5")
+	assert.Equal(t, sum, out["hash"])
+
+	sub := filepath.Join(dir, "a", "b")
+	_, out = callJSON[map[string]any](r, "file.mkdir", sub)
+	assert.Equal(t, true, out["changed"])
+	_, out = callJSON[map[string]any](r, "file.exists", sub)
+	assert.Equal(t, "dir", out["type"])
+
+	rsp = r.Call(context.TODO(), &types.CallRequest{Function: "file.remove", Args: []string{filepath.Join(dir, "a")}})
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	_, out = callJSON[map[string]any](r, "file.remove", filepath.Join(dir, "a"), "recurse=true")
+	assert.Equal(t, true, out["changed"])
+	_, out = callJSON[map[string]any](r, "file.exists", sub)
+	assert.Equal(t, false, out["exists"])
+
+	rsp = r.Call(context.TODO(), &types.CallRequest{Function: "file.read", Args: []string{"relative/path"}})
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+}
@@ -0,0 +1,626 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// PkgBackend is the package manager used by pkg module
+type PkgBackend interface {
+	// Name returns the name of backend, e.g. apt
+	Name() string
+	// ListPkgs returns the installed packages and versions
+	ListPkgs(ctx context.Context) (map[string]string, error)
+	// ListUpgrades returns the packages which can be upgraded and the available versions
+	ListUpgrades(ctx context.Context, refresh bool) (map[string]string, error)
+	// Install installs packages, the item of pkgs is the name or name=version
+	Install(ctx context.Context, pkgs []string, refresh bool) error
+	// Remove removes packages
+	Remove(ctx context.Context, pkgs []string) error
+	// Upgrade upgrades the given packages, or all packages if pkgs is empty
+	Upgrade(ctx context.Context, pkgs []string, refresh bool) error
+}
+
+// PkgBackendFactory creates PkgBackend
+type PkgBackendFactory func() PkgBackend
+
+var (
+	pkgMu       sync.RWMutex
+	pkgBackends = map[string]PkgBackendFactory{
+		"apt": func() PkgBackend { return &aptBackend{} },
+		"dnf": func() PkgBackend { return &rpmBackend{bin: "dnf"} },
+		"yum": func() PkgBackend { return &rpmBackend{bin: "yum"} },
+		"apk": func() PkgBackend { return &apkBackend{} },
+	}
+
+	// pkgFamilies maps os_family grain to the backends, the first one found in PATH is used
+	pkgFamilies = map[string][]string{
+		"debian":    {"apt"},
+		"ubuntu":    {"apt"},
+		"rhel":      {"dnf", "yum"},
+		"fedora":    {"dnf", "yum"},
+		"centos":    {"dnf", "yum"},
+		"rocky":     {"dnf", "yum"},
+		"almalinux": {"dnf", "yum"},
+		"amzn":      {"dnf", "yum"},
+		"alpine":    {"apk"},
+	}
+
+	// pkgBinaries the binary of backends which is used to detect backend by PATH
+	pkgBinaries = map[string]string{
+		"apt": "apt-get",
+		"dnf": "dnf",
+		"yum": "yum",
+		"apk": "apk",
+	}
+)
+
+// RegisterPkgBackend registers or replaces the package backend
+func RegisterPkgBackend(name string, factory PkgBackendFactory) {
+	pkgMu.Lock()
+	defer pkgMu.Unlock()
+	pkgBackends[name] = factory
+}
+
+// DetectPkgBackend returns the package backend of minion. The provider is used when it is not empty,
+// otherwise the backend is detected by os_family grain and then by the binaries in PATH.
+func DetectPkgBackend(grains map[string]any, provider string) (PkgBackend, error) {
+	pkgMu.RLock()
+	defer pkgMu.RUnlock()
+
+	if provider != "" {
+		factory, ok := pkgBackends[provider]
+		if !ok {
+			return nil, fmt.Errorf("unknown package provider '%s'", provider)
+		}
+		return factory(), nil
+	}
+
+	candidates := make([]string, 0)
+	if family, ok := grains["os_family"].(string); ok {
+		candidates = append(candidates, pkgFamilies[strings.ToLower(family)]...)
+	}
+	candidates = append(candidates, "apt", "dnf", "yum", "apk")
+	for _, name := range candidates {
+		if _, err := exec.LookPath(pkgBinaries[name]); err != nil {
+			continue
+		}
+		if factory, ok := pkgBackends[name]; ok {
+			return factory(), nil
+		}
+	}
+	return nil, errors.New("no supported package manager found")
+}
+
+// PkgFunctions returns the functions of pkg module
+func PkgFunctions() []*Function {
+	providerArg := &Arg{Name: "provider", Type: String, Keyword: true, Doc: "the package backend, e.g. apt, dnf, yum or apk. Detected by os_family grain by default"}
+	refreshArg := &Arg{Name: "refresh", Type: Boolean, Keyword: true, Doc: "refresh the package database before the operation"}
+	pkgsArg := &Arg{Name: "pkgs", Type: List, Keyword: true, Doc: "the packages, the same as positional arguments"}
+	return []*Function{
+		{
+			Name:    "pkg.install",
+			Doc:     "Install packages, a specific version is passed as name=version.",
+			Args:    []*Arg{pkgsArg, refreshArg, providerArg},
+			Varargs: "names",
+			Returns: "the mapping of changed packages and their old and new versions",
+			Handler: pkgInstall,
+		},
+		{
+			Name:    "pkg.remove",
+			Doc:     "Remove packages.",
+			Args:    []*Arg{pkgsArg, providerArg},
+			Varargs: "names",
+			Returns: "the mapping of changed packages and their old and new versions",
+			Handler: pkgRemove,
+		},
+		{
+			Name:    "pkg.upgrade",
+			Doc:     "Upgrade the given packages, or all packages if no package is passed.",
+			Args:    []*Arg{pkgsArg, refreshArg, providerArg},
+			Varargs: "names",
+			Returns: "the mapping of changed packages and their old and new versions",
+			Handler: pkgUpgrade,
+		},
+		{
+			Name:    "pkg.version",
+			Doc:     "Return the installed versions of packages.",
+			Args:    []*Arg{pkgsArg, providerArg},
+			Varargs: "names",
+			Returns: "the mapping of package and version, the version is empty if the package is not installed",
+			Handler: pkgVersion,
+		},
+		{
+			Name:    "pkg.list_pkgs",
+			Doc:     "Return the installed packages.",
+			Args:    []*Arg{providerArg},
+			Returns: "the mapping of package and version",
+			Handler: pkgListPkgs,
+		},
+		{
+			Name:    "pkg.list_upgrades",
+			Doc:     "Return the packages which can be upgraded.",
+			Args:    []*Arg{refreshArg, providerArg},
+			Returns: "the mapping of package and available version",
+			Handler: pkgListUpgrades,
+		},
+	}
+}
+
+// PkgChange is the version change of package
+type PkgChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// DiffPkgs returns the changed packages between two lists
+func DiffPkgs(before, after map[string]string) map[string]*PkgChange {
+	changes := map[string]*PkgChange{}
+	for name, version := range after {
+		if old := before[name]; old != version {
+			changes[name] = &PkgChange{Old: old, New: version}
+		}
+	}
+	for name, version := range before {
+		if _, ok := after[name]; !ok {
+			changes[name] = &PkgChange{Old: version, New: ""}
+		}
+	}
+	return changes
+}
+
+// pkgNames returns the packages of request, the names starting with '-' are rejected
+// to not be taken as the options of package manager.
+func pkgNames(req *Request) ([]string, error) {
+	names := append([]string{}, req.Args.List("pkgs")...)
+	names = append(names, req.Varargs...)
+	for _, name := range names {
+		if strings.HasPrefix(name, "-") {
+			return nil, fmt.Errorf("invalid package name '%s'", name)
+		}
+	}
+	return names, nil
+}
+
+// PkgPending is the new version of package predicted in test mode when the version to be
+// installed is unknown
+const PkgPending = "latest"
+
+// pkgChanged runs the operation and returns the diff of installed packages. In test mode the
+// operation is not run, predict computes the packages after operation instead.
+func pkgChanged(ctx context.Context, req *Request, apply func(backend PkgBackend, names []string) error,
+	predict func(backend PkgBackend, before map[string]string, names []string) (map[string]string, error)) (*Result, error) {
+	backend, err := DetectPkgBackend(req.Grains, req.Args.String("provider"))
+	if err != nil {
+		return nil, err
+	}
+	names, err := pkgNames(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 && req.Function != "pkg.upgrade" {
+		return nil, errors.New("no packages specified")
+	}
+
+	before, err := backend.ListPkgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var after map[string]string
+	if req.Test {
+		after, err = predict(backend, before, names)
+	} else {
+		if err = apply(backend, names); err != nil {
+			return nil, err
+		}
+		after, err = backend.ListPkgs(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	changes := DiffPkgs(before, after)
+	result := Return(changes)
+	if len(changes) > 0 {
+		result.Changed = true
+		result.Changes = changes
+	}
+	return result, nil
+}
+
+// copyPkgs returns the copy of package list
+func copyPkgs(pkgs map[string]string) map[string]string {
+	out := make(map[string]string, len(pkgs))
+	for name, version := range pkgs {
+		out[name] = version
+	}
+	return out
+}
+
+func pkgInstall(ctx context.Context, req *Request) (*Result, error) {
+	apply := func(backend PkgBackend, names []string) error {
+		return backend.Install(ctx, names, req.Args.Bool("refresh"))
+	}
+	predict := func(backend PkgBackend, before map[string]string, names []string) (map[string]string, error) {
+		after := copyPkgs(before)
+		for _, item := range names {
+			name, version, _ := strings.Cut(item, "=")
+			if _, ok := before[name]; ok && (version == "" || before[name] == version) {
+				continue
+			}
+			if version == "" {
+				version = PkgPending
+			}
+			after[name] = version
+		}
+		return after, nil
+	}
+	return pkgChanged(ctx, req, apply, predict)
+}
+
+func pkgRemove(ctx context.Context, req *Request) (*Result, error) {
+	apply := func(backend PkgBackend, names []string) error {
+		return backend.Remove(ctx, names)
+	}
+	predict := func(backend PkgBackend, before map[string]string, names []string) (map[string]string, error) {
+		after := copyPkgs(before)
+		for _, name := range names {
+			delete(after, name)
+		}
+		return after, nil
+	}
+	return pkgChanged(ctx, req, apply, predict)
+}
+
+func pkgUpgrade(ctx context.Context, req *Request) (*Result, error) {
+	apply := func(backend PkgBackend, names []string) error {
+		return backend.Upgrade(ctx, names, req.Args.Bool("refresh"))
+	}
+	predict := func(backend PkgBackend, before map[string]string, names []string) (map[string]string, error) {
+		// the package index is not refreshed in test mode
+		upgrades, err := backend.ListUpgrades(ctx, false)
+		if err != nil {
+			return nil, err
+		}
+		// the names may be pinned to versions as install does
+		wanted := make(map[string]string, len(names))
+		for _, item := range names {
+			name, version, _ := strings.Cut(item, "=")
+			wanted[name] = version
+		}
+		after := copyPkgs(before)
+		for name, version := range upgrades {
+			pinned, ok := wanted[name]
+			if len(names) > 0 && !ok {
+				continue
+			}
+			if pinned != "" {
+				version = pinned
+			}
+			after[name] = version
+		}
+		return after, nil
+	}
+	return pkgChanged(ctx, req, apply, predict)
+}
+
+func pkgVersion(ctx context.Context, req *Request) (*Result, error) {
+	backend, err := DetectPkgBackend(req.Grains, req.Args.String("provider"))
+	if err != nil {
+		return nil, err
+	}
+	names, err := pkgNames(req)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, errors.New("no packages specified")
+	}
+	installed, err := backend.ListPkgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for _, name := range names {
+		out[name] = installed[name]
+	}
+	return Return(out), nil
+}
+
+func pkgListPkgs(ctx context.Context, req *Request) (*Result, error) {
+	backend, err := DetectPkgBackend(req.Grains, req.Args.String("provider"))
+	if err != nil {
+		return nil, err
+	}
+	out, err := backend.ListPkgs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Return(out), nil
+}
+
+func pkgListUpgrades(ctx context.Context, req *Request) (*Result, error) {
+	backend, err := DetectPkgBackend(req.Grains, req.Args.String("provider"))
+	if err != nil {
+		return nil, err
+	}
+	out, err := backend.ListUpgrades(ctx, req.Args.Bool("refresh"))
+	if err != nil {
+		return nil, err
+	}
+	return Return(out), nil
+}
+
+// aptBackend is the backend of Debian and Ubuntu
+type aptBackend struct{}
+
+var aptEnv = []string{"DEBIAN_FRONTEND=noninteractive", "APT_LISTCHANGES_FRONTEND=none"}
+
+func (b *aptBackend) Name() string { return "apt" }
+
+func (b *aptBackend) ListPkgs(ctx context.Context) (map[string]string, error) {
+	out, err := execArgv(ctx, nil, []string{"dpkg-query", "-W", "-f=${Package}\t${Version}\t${db:Status-Abbrev}\n"})
+	if err != nil {
+		return nil, err
+	}
+	pkgs := map[string]string{}
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 || !strings.HasPrefix(fields[2], "ii") {
+			continue
+		}
+		pkgs[fields[0]] = fields[1]
+	}
+	return pkgs, nil
+}
+
+func (b *aptBackend) refresh(ctx context.Context) error {
+	_, err := execArgv(ctx, aptEnv, []string{"apt-get", "update", "-q"})
+	return err
+}
+
+func (b *aptBackend) ListUpgrades(ctx context.Context, refresh bool) (map[string]string, error) {
+	if refresh {
+		if err := b.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+	out, err := execArgv(ctx, aptEnv, []string{"apt-get", "-s", "-q", "upgrade"})
+	if err != nil {
+		return nil, err
+	}
+	// Inst name [old] (new suite [arch])
+	pkgs := map[string]string{}
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		if !strings.HasPrefix(line, "Inst ") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		name := fields[1]
+		if i := strings.Index(line, "("); i > 0 {
+			if version := strings.Fields(line[i+1:]); len(version) > 0 {
+				pkgs[name] = version[0]
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+func (b *aptBackend) Install(ctx context.Context, pkgs []string, refresh bool) error {
+	if refresh {
+		if err := b.refresh(ctx); err != nil {
+			return err
+		}
+	}
+	_, err := execArgv(ctx, aptEnv, append([]string{"apt-get", "install", "-y", "-q"}, pkgs...))
+	return err
+}
+
+func (b *aptBackend) Remove(ctx context.Context, pkgs []string) error {
+	_, err := execArgv(ctx, aptEnv, append([]string{"apt-get", "remove", "-y", "-q"}, pkgs...))
+	return err
+}
+
+func (b *aptBackend) Upgrade(ctx context.Context, pkgs []string, refresh bool) error {
+	if refresh {
+		if err := b.refresh(ctx); err != nil {
+			return err
+		}
+	}
+	argv := []string{"apt-get", "upgrade", "-y", "-q"}
+	if len(pkgs) > 0 {
+		argv = append([]string{"apt-get", "install", "--only-upgrade", "-y", "-q"}, pkgs...)
+	}
+	_, err := execArgv(ctx, aptEnv, argv)
+	return err
+}
+
+// rpmBackend is the backend of RHEL, Fedora and CentOS, uses dnf or yum
+type rpmBackend struct {
+	bin string
+}
+
+func (b *rpmBackend) Name() string { return b.bin }
+
+// rpmPkgName converts name=version to name-version
+func rpmPkgName(pkg string) string {
+	if name, version, ok := strings.Cut(pkg, "="); ok {
+		return name + "-" + version
+	}
+	return pkg
+}
+
+func (b *rpmBackend) ListPkgs(ctx context.Context) (map[string]string, error) {
+	out, err := execArgv(ctx, nil, []string{"rpm", "-qa", "--queryformat", "%{NAME}\t%{EPOCH}:%{VERSION}-%{RELEASE}\n"})
+	if err != nil {
+		return nil, err
+	}
+	pkgs := map[string]string{}
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		name, version, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		pkgs[name] = strings.TrimPrefix(version, "(none):")
+	}
+	return pkgs, nil
+}
+
+func (b *rpmBackend) ListUpgrades(ctx context.Context, refresh bool) (map[string]string, error) {
+	argv := []string{b.bin, "-q", "check-update"}
+	if !refresh {
+		argv = append(argv, "-C")
+	}
+	// check-update 存在可升级的包时返回 100
+	out, err := execArgv(ctx, nil, argv, 100)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := map[string]string{}
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		name := fields[0]
+		if i := strings.LastIndex(name, "."); i > 0 {
+			name = name[:i]
+		}
+		pkgs[name] = fields[1]
+	}
+	return pkgs, nil
+}
+
+func (b *rpmBackend) Install(ctx context.Context, pkgs []string, refresh bool) error {
+	argv := []string{b.bin, "install", "-y"}
+	if refresh {
+		argv = append(argv, "--refresh")
+	}
+	for _, pkg := range pkgs {
+		argv = append(argv, rpmPkgName(pkg))
+	}
+	_, err := execArgv(ctx, nil, argv)
+	return err
+}
+
+func (b *rpmBackend) Remove(ctx context.Context, pkgs []string) error {
+	_, err := execArgv(ctx, nil, append([]string{b.bin, "remove", "-y"}, pkgs...))
+	return err
+}
+
+func (b *rpmBackend) Upgrade(ctx context.Context, pkgs []string, refresh bool) error {
+	argv := []string{b.bin, "upgrade", "-y"}
+	if refresh {
+		argv = append(argv, "--refresh")
+	}
+	for _, pkg := range pkgs {
+		argv = append(argv, rpmPkgName(pkg))
+	}
+	_, err := execArgv(ctx, nil, argv)
+	return err
+}
+
+// apkBackend is the backend of Alpine
+type apkBackend struct{}
+
+func (b *apkBackend) Name() string { return "apk" }
+
+// splitApkPkg splits name-version-rN to name and version
+func splitApkPkg(text string) (string, string) {
+	parts := strings.Split(text, "-")
+	if len(parts) < 3 {
+		return text, ""
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), strings.Join(parts[len(parts)-2:], "-")
+}
+
+func (b *apkBackend) ListPkgs(ctx context.Context) (map[string]string, error) {
+	out, err := execArgv(ctx, nil, []string{"apk", "info", "-v"})
+	if err != nil {
+		return nil, err
+	}
+	pkgs := map[string]string{}
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "WARNING") {
+			continue
+		}
+		name, version := splitApkPkg(line)
+		pkgs[name] = version
+	}
+	return pkgs, nil
+}
+
+func (b *apkBackend) ListUpgrades(ctx context.Context, refresh bool) (map[string]string, error) {
+	if refresh {
+		if _, err := execArgv(ctx, nil, []string{"apk", "update"}); err != nil {
+			return nil, err
+		}
+	}
+	out, err := execArgv(ctx, nil, []string{"apk", "version", "-l", "<"})
+	if err != nil {
+		return nil, err
+	}
+	// name-version-rN < new-version
+	pkgs := map[string]string{}
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[1] != "<" {
+			continue
+		}
+		name, _ := splitApkPkg(fields[0])
+		pkgs[name] = fields[2]
+	}
+	return pkgs, nil
+}
+
+func (b *apkBackend) Install(ctx context.Context, pkgs []string, refresh bool) error {
+	argv := []string{"apk", "add"}
+	if refresh {
+		argv = append(argv, "--update-cache")
+	}
+	_, err := execArgv(ctx, nil, append(argv, pkgs...))
+	return err
+}
+
+func (b *apkBackend) Remove(ctx context.Context, pkgs []string) error {
+	_, err := execArgv(ctx, nil, append([]string{"apk", "del"}, pkgs...))
+	return err
+}
+
+func (b *apkBackend) Upgrade(ctx context.Context, pkgs []string, refresh bool) error {
+	argv := []string{"apk", "upgrade"}
+	if refresh {
+		argv = append(argv, "--update-cache")
+	}
+	_, err := execArgv(ctx, nil, append(argv, pkgs...))
+	return err
+}
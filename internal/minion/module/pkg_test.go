@@ -0,0 +1,108 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func TestPkgFunctions(t *testing.T) {
+	bin, err := filepath.Abs("testdata/fakepkg")
+	if !assert.NoError(t, err) {
+		return
+	}
+	dir := t.TempDir()
+	db := filepath.Join(dir, "installed")
+	repo := filepath.Join(dir, "repo")
+	_ = os.WriteFile(db, []byte("musl 1.2.4-r0\ncurl 8.0.0-r0\n"), 0644)
+	_ = os.WriteFile(repo, []byte("musl 1.2.4-r0\ncurl 8.5.0-r0\nnginx 1.24.0-r1\n"), 0644)
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_PKG_DB", db)
+	t.Setenv("FAKE_PKG_REPO", repo)
+
+	r := NewRegistry()
+	RegisterBuiltin(r)
+	r.SetGrainsFunc(func() map[string]any {
+		return map[string]any{"os_family": "alpine"}
+	})
+
+	rsp, out := callJSON[map[string]any](r, "pkg.list_pkgs")
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, map[string]any{"musl": "1.2.4-r0", "curl": "8.0.0-r0"}, out)
+
+	_, out = callJSON[map[string]any](r, "pkg.list_upgrades", "refresh=true")
+	assert.Equal(t, map[string]any{"curl": "8.5.0-r0"}, out)
+
+	// test mode predicts the changes without installing
+	rsp, out = callRequestJSON[map[string]any](r, &types.CallRequest{Function: "pkg.install", Args: []string{"nginx", "musl"}, Test: true})
+	assert.Equal(t, map[string]any{"nginx": map[string]any{"old": "", "new": PkgPending}}, out)
+	assert.True(t, rsp.Changes.Test)
+	_, out = callJSON[map[string]any](r, "pkg.version", "nginx")
+	assert.Equal(t, map[string]any{"nginx": ""}, out)
+
+	rsp, out = callJSON[map[string]any](r, "pkg.install", "nginx", "musl")
+	assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error)
+	assert.Equal(t, map[string]any{"nginx": map[string]any{"old": "", "new": "1.24.0-r1"}}, out)
+	assert.True(t, rsp.Changes.Changed)
+
+	rsp, out = callJSON[map[string]any](r, "pkg.install", "nginx")
+	assert.Empty(t, out)
+	assert.Nil(t, rsp.Changes)
+
+	// the pinned version is stripped to match the upgrades
+	rsp, out = callRequestJSON[map[string]any](r, &types.CallRequest{Function: "pkg.upgrade", Args: []string{"curl=8.5.0-r0"}, Test: true})
+	assert.Equal(t, map[string]any{"curl": map[string]any{"old": "8.0.0-r0", "new": "8.5.0-r0"}}, out)
+
+	_, out = callJSON[map[string]any](r, "pkg.upgrade")
+	assert.Equal(t, map[string]any{"curl": map[string]any{"old": "8.0.0-r0", "new": "8.5.0-r0"}}, out)
+
+	_, out = callJSON[map[string]any](r, "pkg.version", "curl", "vim")
+	assert.Equal(t, map[string]any{"curl": "8.5.0-r0", "vim": ""}, out)
+
+	_, out = callJSON[map[string]any](r, "pkg.remove", "pkgs=nginx")
+	assert.Equal(t, map[string]any{"nginx": map[string]any{"old": "1.24.0-r1", "new": ""}}, out)
+
+	rsp, _ = callJSON[map[string]any](r, "pkg.install", "--allow-untrusted", "nginx")
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Contains(t, rsp.Error, "invalid package name")
+
+	rsp, _ = callJSON[map[string]any](r, "pkg.install", "missing")
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+
+	rsp, _ = callJSON[map[string]any](r, "pkg.list_pkgs", "provider=pacman")
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+}
+
+func TestSplitApkPkg(t *testing.T) {
+	name, version := splitApkPkg("py3-setuptools-68.0.0-r0")
+	assert.Equal(t, "py3-setuptools", name)
+	assert.Equal(t, "68.0.0-r0", version)
+}
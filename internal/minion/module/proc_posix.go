@@ -0,0 +1,120 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// lookupIds returns the uid, gid and supplementary groups of user
+func lookupIds(name string) (*user.User, uint32, uint32, []uint32, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, 0, 0, nil, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, 0, 0, nil, fmt.Errorf("invalid uid of %s: %w", name, err)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, 0, 0, nil, fmt.Errorf("invalid gid of %s: %w", name, err)
+	}
+	groups := make([]uint32, 0)
+	gids, _ := u.GroupIds()
+	for _, item := range gids {
+		if v, e := strconv.ParseUint(item, 10, 32); e == nil {
+			groups = append(groups, uint32(v))
+		}
+	}
+	return u, uint32(uid), uint32(gid), groups, nil
+}
+
+// setCredential runs the command as the given user, returns the environment variables of user
+func setCredential(cmd *exec.Cmd, runas string) ([]string, error) {
+	u, uid, gid, groups, err := lookupIds(runas)
+	if err != nil {
+		return nil, fmt.Errorf("runas %s: %w", runas, err)
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	// 当前用户和目标用户相同时，不需要切换用户
+	if uint32(os.Getuid()) != uid {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uid, Gid: gid, Groups: groups}
+	}
+
+	env := []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+	}
+	return env, nil
+}
+
+// setProcessGroup starts the command in a new process group, the whole group is killed
+// when the context of command is done, so the children of command do not outlive it
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// chownTo changes the owner of file to the given user
+func chownTo(filename, runas string) error {
+	_, uid, gid, _, err := lookupIds(runas)
+	if err != nil {
+		return fmt.Errorf("runas %s: %w", runas, err)
+	}
+	return os.Chown(filename, int(uid), int(gid))
+}
+
+// fileOwner returns the uid and gid of file
+func fileOwner(stat os.FileInfo) (int, int, bool) {
+	st, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int(st.Uid), int(st.Gid), true
+}
+
+// diskUsage returns the usage of filesystem which contains the path
+func diskUsage(path string) (*DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: path, Err: err}
+	}
+	return newDiskUsage(uint64(st.Bsize), st.Blocks, st.Bfree, st.Bavail, st.Files, st.Ffree), nil
+}
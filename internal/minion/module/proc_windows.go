@@ -0,0 +1,49 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+func setCredential(cmd *exec.Cmd, runas string) ([]string, error) {
+	return nil, errors.New("runas is not supported on windows")
+}
+
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func chownTo(filename, runas string) error {
+	return errors.New("runas is not supported on windows")
+}
+
+func fileOwner(stat os.FileInfo) (int, int, bool) {
+	return 0, 0, false
+}
+
+func diskUsage(path string) (*DiskUsage, error) {
+	return nil, errors.New("diskusage is not supported on windows")
+}
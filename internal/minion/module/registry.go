@@ -0,0 +1,313 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package module implements the execution modules of maco-minion.
+//
+// An execution function is registered by its dotted name `module.function`,
+// e.g. `cmd.run`, together with a typed argument schema and the description of
+// its return value. The arguments of types.CallRequest are parsed by the schema,
+// both positional arguments and keyword arguments (name=value) are supported:
+//
+//	maco '*' cmd.run 'ls -l' cwd=/tmp
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+// NotAvailableError is returned when the function is not registered
+type NotAvailableError struct {
+	Name string
+}
+
+func (e *NotAvailableError) Error() string {
+	return fmt.Sprintf("function %s is not available", e.Name)
+}
+
+// IsNotAvailable checks whether the error is NotAvailableError
+func IsNotAvailable(err error) bool {
+	_, ok := err.(*NotAvailableError)
+	return ok
+}
+
+// Handler is the implementation of execution function
+type Handler func(ctx context.Context, req *Request) (*Result, error)
+
+// Function describes an execution function
+type Function struct {
+	// Name the dotted name of function, e.g. cmd.run
+	Name string
+	// Doc the description of function
+	Doc string
+	// Args the argument schema of function
+	Args []*Arg
+	// Varargs the name of extra positional arguments, empty if the function does not accept them
+	Varargs string
+	// Returns the description of return value
+	Returns string
+
+	Handler Handler
+}
+
+// Module returns the module name of function
+func (f *Function) Module() string {
+	module, _, _ := strings.Cut(f.Name, ".")
+	return module
+}
+
+// Request is the parsed call request
+type Request struct {
+	// Function the name of function
+	Function string
+	// Args the arguments parsed by the schema
+	Args Args
+	// Varargs the extra positional arguments
+	Varargs []string
+	// Pillar the pillar data of minion
+	Pillar map[string]any
+	// Grains the grains of minion, it is empty if Registry has no grains source
+	Grains map[string]any
+	// Test reports whether the function runs in test mode, the functions which modify the
+	// minion must compute the predicted changes without applying them
+	Test bool
+
+	Call *types.CallRequest
+}
+
+// Result is the output of execution function
+type Result struct {
+	// Return the return value of function, it will be encoded as json
+	Return any
+	// RetCode the exit code of function
+	RetCode int32
+	// Stdout, Stderr and Pid are the output of process started by function
+	Stdout string
+	Stderr string
+	Pid    int32
+	// Changed reports whether the function modified the minion
+	Changed bool
+	// Changes the details of modification, it will be encoded as json
+	Changes any
+	// States the results of state run, they are reported in types.ResultChanges
+	States []*types.StateResult
+}
+
+// Return creates Result with return value
+func Return(v any) *Result {
+	return &Result{Return: v}
+}
+
+// Registry is the collection of execution functions
+type Registry struct {
+	mu    sync.RWMutex
+	funcs map[string]*Function
+
+	grains func() map[string]any
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{funcs: map[string]*Function{}}
+}
+
+// SetGrainsFunc sets the source of grains which are passed to functions
+func (r *Registry) SetGrainsFunc(fn func() map[string]any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.grains = fn
+}
+
+// Register adds functions to Registry
+func (r *Registry) Register(fns ...*Function) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, fn := range fns {
+		module, name, ok := strings.Cut(fn.Name, ".")
+		if !ok || module == "" || name == "" {
+			return fmt.Errorf("invalid function name '%s', must be module.function", fn.Name)
+		}
+		if fn.Handler == nil {
+			return fmt.Errorf("function %s has no handler", fn.Name)
+		}
+		if _, exists := r.funcs[fn.Name]; exists {
+			return fmt.Errorf("function %s already registered", fn.Name)
+		}
+		r.funcs[fn.Name] = fn
+	}
+	return nil
+}
+
+// MustRegister adds functions to Registry, panics if any error
+func (r *Registry) MustRegister(fns ...*Function) {
+	if err := r.Register(fns...); err != nil {
+		panic(err)
+	}
+}
+
+// Get returns the function by name
+func (r *Registry) Get(name string) (*Function, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.funcs[name]
+	if !ok {
+		return nil, &NotAvailableError{Name: name}
+	}
+	return fn, nil
+}
+
+// Functions returns all functions sorted by name
+func (r *Registry) Functions() []*Function {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	out := make([]*Function, 0, len(r.funcs))
+	for _, fn := range r.funcs {
+		out = append(out, fn)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Modules returns the names of all modules
+func (r *Registry) Modules() []string {
+	modules := make([]string, 0)
+	seen := map[string]struct{}{}
+	for _, fn := range r.Functions() {
+		module := fn.Module()
+		if _, ok := seen[module]; ok {
+			continue
+		}
+		seen[module] = struct{}{}
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+// Call executes the function of CallRequest and converts the result to CallResponse
+func (r *Registry) Call(ctx context.Context, in *types.CallRequest) *types.CallResponse {
+	rsp := &types.CallResponse{
+		Id:   in.Id,
+		Type: types.ResultType_ResultOk,
+	}
+
+	result, err := r.call(ctx, in)
+	if result != nil {
+		rsp.RetCode = result.RetCode
+		rsp.Stdout = result.Stdout
+		rsp.Stderr = result.Stderr
+		rsp.Pid = result.Pid
+		if result.Changed || len(result.States) > 0 {
+			rsp.Changes = &types.ResultChanges{Changed: result.Changed, States: result.States, Test: in.Test}
+			if result.Changes != nil {
+				rsp.Changes.Data, _ = json.Marshal(result.Changes)
+			}
+		}
+		if result.Return != nil {
+			data, mErr := json.Marshal(result.Return)
+			if mErr != nil && err == nil {
+				err = fmt.Errorf("marshal result: %w", mErr)
+			}
+			rsp.Result = data
+		}
+	}
+	if err != nil {
+		rsp.Type = types.ResultType_ResultError
+		rsp.Error = err.Error()
+	}
+	return rsp
+}
+
+func (r *Registry) call(ctx context.Context, in *types.CallRequest) (*Result, error) {
+	fn, err := r.Get(in.Function)
+	if err != nil {
+		return nil, err
+	}
+
+	args, varargs, err := ParseArgs(fn, in.Args)
+	if err != nil {
+		return nil, err
+	}
+	pillar, err := types.ValuesInterface(in.Pillars)
+	if err != nil {
+		return nil, fmt.Errorf("decode pillar: %w", err)
+	}
+
+	req := &Request{
+		Function: fn.Name,
+		Args:     args,
+		Varargs:  varargs,
+		Pillar:   pillar,
+		Grains:   map[string]any{},
+		Test:     in.Test,
+		Call:     in,
+	}
+	r.mu.RLock()
+	grainsFn := r.grains
+	r.mu.RUnlock()
+	if grainsFn != nil {
+		req.Grains = grainsFn()
+	}
+
+	if in.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(in.Timeout)*time.Second)
+		defer cancel()
+	}
+	return fn.Handler(ctx, req)
+}
+
+// Exec calls the function with typed arguments on behalf of the parent request, the pillar,
+// grains and call of parent are inherited. It is used by the functions which compose other
+// functions, e.g. the state functions.
+func (r *Registry) Exec(ctx context.Context, parent *Request, function string, args map[string]any, varargs ...string) (*Result, error) {
+	fn, err := r.Get(function)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ParseArgsMap(fn, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(varargs) > 0 && fn.Varargs == "" {
+		return nil, fmt.Errorf("%s: too many arguments", fn.Name)
+	}
+
+	req := &Request{
+		Function: fn.Name,
+		Args:     parsed,
+		Varargs:  varargs,
+		Pillar:   parent.Pillar,
+		Grains:   parent.Grains,
+		Test:     parent.Test,
+		Call:     parent.Call,
+	}
+	return fn.Handler(ctx, req)
+}
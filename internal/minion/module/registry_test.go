@@ -0,0 +1,109 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func TestParseArgs(t *testing.T) {
+	fn := &Function{
+		Name: "test.args",
+		Args: []*Arg{
+			{Name: "name", Type: String, Required: true},
+			{Name: "count", Type: Integer, Default: int64(1)},
+			{Name: "force", Type: Boolean},
+			{Name: "items", Type: List},
+		},
+		Varargs: "extra",
+	}
+
+	args, varargs, err := ParseArgs(fn, []string{"force=true", "foo", "3", "a,b", "x=y"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "foo", args.String("name"))
+	assert.Equal(t, int64(3), args.Int("count"))
+	assert.True(t, args.Bool("force"))
+	assert.Equal(t, []string{"a", "b"}, args.List("items"))
+	assert.Equal(t, []string{"x=y"}, varargs)
+
+	args, _, err = ParseArgs(fn, []string{"name=bar", `items=["c"]`})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(1), args.Int("count"))
+	assert.Equal(t, []string{"c"}, args.List("items"))
+
+	_, _, err = ParseArgs(fn, []string{})
+	assert.Error(t, err)
+
+	_, _, err = ParseArgs(fn, []string{"foo", "count=x"})
+	assert.Error(t, err)
+
+	fn.Varargs = ""
+	_, _, err = ParseArgs(fn, []string{"foo", "1", "true", "a", "b"})
+	assert.Error(t, err)
+}
+
+func TestRegistryCall(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltin(r)
+
+	assert.Error(t, r.Register(&Function{Name: "cmd", Handler: cmdRun}))
+	assert.Error(t, r.Register(&Function{Name: "cmd.run", Handler: cmdRun}))
+
+	rsp := r.Call(context.TODO(), &types.CallRequest{Id: 1, Function: "foo.bar"})
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Equal(t, "function foo.bar is not available", rsp.Error)
+
+	rsp = r.Call(context.TODO(), &types.CallRequest{Id: 2, Function: "cmd.run", Args: []string{"echo hello"}, Timeout: 10})
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	var out string
+	_ = json.Unmarshal(rsp.Result, &out)
+	assert.Equal(t, "hello", out)
+
+	rsp = r.Call(context.TODO(), &types.CallRequest{Id: 3, Function: "cmd.run", Args: []string{"exit 3"}})
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Equal(t, int32(3), rsp.RetCode)
+}
+
+// callJSON calls the function with the arguments and decodes the json result into T
+func callJSON[T any](r *Registry, function string, args ...string) (*types.CallResponse, T) {
+	return callRequestJSON[T](r, &types.CallRequest{Function: function, Args: args})
+}
+
+// callRequestJSON calls the request, e.g. in test mode or with timeout, and decodes the json result into T
+func callRequestJSON[T any](r *Registry, in *types.CallRequest) (*types.CallResponse, T) {
+	rsp := r.Call(context.TODO(), in)
+	var out T
+	_ = json.Unmarshal(rsp.Result, &out)
+	return rsp, out
+}
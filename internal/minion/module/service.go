@@ -0,0 +1,477 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ServiceState is the state of service
+type ServiceState struct {
+	Name string `json:"name"`
+	// Active the service is running
+	Active bool `json:"active"`
+	// Enabled the service is started on boot
+	Enabled bool `json:"enabled"`
+	// State the raw state of service, e.g. active, inactive, failed
+	State string `json:"state"`
+	Pid   int    `json:"pid,omitempty"`
+}
+
+// ServiceBackend is the service manager used by service module
+type ServiceBackend interface {
+	// Name returns the name of backend, e.g. systemd
+	Name() string
+	Status(ctx context.Context, name string) (*ServiceState, error)
+	Start(ctx context.Context, name string) error
+	Stop(ctx context.Context, name string) error
+	Restart(ctx context.Context, name string) error
+	Reload(ctx context.Context, name string) error
+	Enable(ctx context.Context, name string) error
+	Disable(ctx context.Context, name string) error
+	// List returns all services and their raw states
+	List(ctx context.Context) (map[string]string, error)
+}
+
+// ServiceBackendFactory creates ServiceBackend
+type ServiceBackendFactory func() ServiceBackend
+
+var (
+	svcMu       sync.RWMutex
+	svcBackends = map[string]ServiceBackendFactory{
+		"systemd": func() ServiceBackend { return &systemdBackend{} },
+		"sysv":    func() ServiceBackend { return &sysvBackend{root: "/etc"} },
+	}
+)
+
+// RegisterServiceBackend registers or replaces the service backend
+func RegisterServiceBackend(name string, factory ServiceBackendFactory) {
+	svcMu.Lock()
+	defer svcMu.Unlock()
+	svcBackends[name] = factory
+}
+
+// DetectServiceBackend returns the service backend of minion. The provider is used when it is not empty,
+// otherwise systemd is used if it is running, SysV init scripts are the fallback.
+func DetectServiceBackend(provider string) (ServiceBackend, error) {
+	svcMu.RLock()
+	defer svcMu.RUnlock()
+
+	if provider == "" {
+		provider = "sysv"
+		if stat, err := os.Stat("/run/systemd/system"); err == nil && stat.IsDir() {
+			if _, err = exec.LookPath("systemctl"); err == nil {
+				provider = "systemd"
+			}
+		}
+	}
+	factory, ok := svcBackends[provider]
+	if !ok {
+		return nil, fmt.Errorf("unknown service provider '%s'", provider)
+	}
+	return factory(), nil
+}
+
+// ServiceFunctions returns the functions of service module
+func ServiceFunctions() []*Function {
+	nameArg := &Arg{Name: "name", Type: String, Required: true, Doc: "the name of service, e.g. nginx"}
+	providerArg := &Arg{Name: "provider", Type: String, Keyword: true, Doc: "the service backend, systemd or sysv. Detected by default"}
+	actions := []struct {
+		name string
+		doc  string
+	}{
+		{"start", "Start the service."},
+		{"stop", "Stop the service."},
+		{"restart", "Restart the service."},
+		{"reload", "Reload the configuration of service."},
+		{"enable", "Enable the service to start on boot."},
+		{"disable", "Disable the service to start on boot."},
+	}
+
+	fns := make([]*Function, 0, len(actions)+3)
+	for _, action := range actions {
+		fns = append(fns, &Function{
+			Name:    "service." + action.name,
+			Doc:     action.doc,
+			Args:    []*Arg{nameArg, providerArg},
+			Returns: "a mapping with name, the states before and after the call and changed",
+			Handler: serviceAction(action.name),
+		})
+	}
+	fns = append(fns,
+		&Function{
+			Name:    "service.status",
+			Doc:     "Return the state of service.",
+			Args:    []*Arg{nameArg, providerArg},
+			Returns: "the state with name, active, enabled, state and pid",
+			Handler: serviceStatus,
+		},
+		&Function{
+			Name:    "service.is_enabled",
+			Doc:     "Check whether the service is enabled to start on boot.",
+			Args:    []*Arg{nameArg, providerArg},
+			Returns: "true if the service is enabled",
+			Handler: serviceIsEnabled,
+		},
+		&Function{
+			Name:    "service.list",
+			Doc:     "Return all services.",
+			Args:    []*Arg{providerArg},
+			Returns: "the mapping of service and its raw state",
+			Handler: serviceList,
+		},
+	)
+	return fns
+}
+
+// serviceChanged reports whether the action changes the state of service
+func serviceChanged(action string, before, after *ServiceState) bool {
+	switch action {
+	case "restart", "reload":
+		return true
+	default:
+		return before.Active != after.Active || before.Enabled != after.Enabled
+	}
+}
+
+// predictService returns the predicted state of service after action, it is used in test mode
+func predictService(action string, before *ServiceState) *ServiceState {
+	after := *before
+	switch action {
+	case "start", "restart":
+		after.Active, after.State = true, "active"
+	case "stop":
+		after.Active, after.State, after.Pid = false, "inactive", 0
+	case "enable":
+		after.Enabled = true
+	case "disable":
+		after.Enabled = false
+	}
+	return &after
+}
+
+// serviceApply runs the action of service
+func serviceApply(ctx context.Context, backend ServiceBackend, action, name string) error {
+	switch action {
+	case "start":
+		return backend.Start(ctx, name)
+	case "stop":
+		return backend.Stop(ctx, name)
+	case "restart":
+		return backend.Restart(ctx, name)
+	case "reload":
+		return backend.Reload(ctx, name)
+	case "enable":
+		return backend.Enable(ctx, name)
+	case "disable":
+		return backend.Disable(ctx, name)
+	}
+	return nil
+}
+
+func serviceAction(action string) Handler {
+	return func(ctx context.Context, req *Request) (*Result, error) {
+		backend, err := DetectServiceBackend(req.Args.String("provider"))
+		if err != nil {
+			return nil, err
+		}
+		name := req.Args.String("name")
+		before, err := backend.Status(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var after *ServiceState
+		if req.Test {
+			after = predictService(action, before)
+		} else {
+			if err = serviceApply(ctx, backend, action, name); err != nil {
+				return nil, err
+			}
+			if after, err = backend.Status(ctx, name); err != nil {
+				return nil, err
+			}
+		}
+
+		changed := serviceChanged(action, before, after)
+		out := map[string]any{
+			"name":    name,
+			"before":  before,
+			"after":   after,
+			"changed": changed,
+		}
+		return changedResult(out, map[string]any{"before": before, "after": after}), nil
+	}
+}
+
+func serviceStatus(ctx context.Context, req *Request) (*Result, error) {
+	backend, err := DetectServiceBackend(req.Args.String("provider"))
+	if err != nil {
+		return nil, err
+	}
+	state, err := backend.Status(ctx, req.Args.String("name"))
+	if err != nil {
+		return nil, err
+	}
+	return Return(state), nil
+}
+
+func serviceIsEnabled(ctx context.Context, req *Request) (*Result, error) {
+	backend, err := DetectServiceBackend(req.Args.String("provider"))
+	if err != nil {
+		return nil, err
+	}
+	state, err := backend.Status(ctx, req.Args.String("name"))
+	if err != nil {
+		return nil, err
+	}
+	return Return(state.Enabled), nil
+}
+
+func serviceList(ctx context.Context, req *Request) (*Result, error) {
+	backend, err := DetectServiceBackend(req.Args.String("provider"))
+	if err != nil {
+		return nil, err
+	}
+	out, err := backend.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Return(out), nil
+}
+
+// systemdBackend wraps systemctl
+type systemdBackend struct{}
+
+func (b *systemdBackend) Name() string { return "systemd" }
+
+func unitName(name string) string {
+	if strings.Contains(name, ".") {
+		return name
+	}
+	return name + ".service"
+}
+
+func (b *systemdBackend) Status(ctx context.Context, name string) (*ServiceState, error) {
+	out, err := execArgv(ctx, nil, []string{"systemctl", "show", unitName(name), "--no-pager",
+		"--property=LoadState,ActiveState,UnitFileState,MainPID"})
+	if err != nil {
+		return nil, err
+	}
+	props := ParseProperties(out.Stdout)
+	if props["LoadState"] == "not-found" {
+		return nil, fmt.Errorf("service %s not found", name)
+	}
+
+	state := &ServiceState{
+		Name:    name,
+		State:   props["ActiveState"],
+		Active:  props["ActiveState"] == "active" || props["ActiveState"] == "reloading",
+		Enabled: strings.HasPrefix(props["UnitFileState"], "enabled"),
+	}
+	state.Pid, _ = strconv.Atoi(props["MainPID"])
+	return state, nil
+}
+
+func (b *systemdBackend) systemctl(ctx context.Context, action, name string) error {
+	_, err := execArgv(ctx, nil, []string{"systemctl", action, unitName(name)})
+	return err
+}
+
+func (b *systemdBackend) Start(ctx context.Context, name string) error {
+	return b.systemctl(ctx, "start", name)
+}
+
+func (b *systemdBackend) Stop(ctx context.Context, name string) error {
+	return b.systemctl(ctx, "stop", name)
+}
+
+func (b *systemdBackend) Restart(ctx context.Context, name string) error {
+	return b.systemctl(ctx, "restart", name)
+}
+
+func (b *systemdBackend) Reload(ctx context.Context, name string) error {
+	return b.systemctl(ctx, "reload", name)
+}
+
+func (b *systemdBackend) Enable(ctx context.Context, name string) error {
+	return b.systemctl(ctx, "enable", name)
+}
+
+func (b *systemdBackend) Disable(ctx context.Context, name string) error {
+	return b.systemctl(ctx, "disable", name)
+}
+
+func (b *systemdBackend) List(ctx context.Context) (map[string]string, error) {
+	out, err := execArgv(ctx, nil, []string{"systemctl", "list-units", "--type=service", "--all",
+		"--no-legend", "--no-pager", "--plain"})
+	if err != nil {
+		return nil, err
+	}
+	// unit load active sub description
+	services := map[string]string{}
+	for _, line := range strings.Split(out.Stdout, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		services[strings.TrimSuffix(fields[0], ".service")] = fields[2]
+	}
+	return services, nil
+}
+
+// ParseProperties parses the key=value lines
+func ParseProperties(text string) map[string]string {
+	props := map[string]string{}
+	for _, line := range strings.Split(text, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			props[key] = value
+		}
+	}
+	return props
+}
+
+// sysvBackend manages the SysV init scripts in /etc/init.d
+type sysvBackend struct {
+	root string
+}
+
+func (b *sysvBackend) Name() string { return "sysv" }
+
+func (b *sysvBackend) script(name string) (string, error) {
+	if strings.ContainsAny(name, "/") {
+		return "", fmt.Errorf("invalid service name '%s'", name)
+	}
+	script := filepath.Join(b.root, "init.d", name)
+	if _, err := os.Stat(script); err != nil {
+		return "", fmt.Errorf("service %s not found", name)
+	}
+	return script, nil
+}
+
+func (b *sysvBackend) Status(ctx context.Context, name string) (*ServiceState, error) {
+	script, err := b.script(name)
+	if err != nil {
+		return nil, err
+	}
+	out, err := Run(ctx, &RunOptions{Args: []string{script, "status"}, Shell: NoShell})
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ServiceState{Name: name, State: "inactive"}
+	// LSB: 0 program is running, 3 program is not running
+	if out.RetCode == 0 {
+		state.Active = true
+		state.State = "active"
+	}
+	links, _ := filepath.Glob(filepath.Join(b.root, "rc[2345].d", "S[0-9][0-9]"+name))
+	state.Enabled = len(links) > 0
+	return state, nil
+}
+
+func (b *sysvBackend) invoke(ctx context.Context, name, action string) error {
+	script, err := b.script(name)
+	if err != nil {
+		return err
+	}
+	_, err = execArgv(ctx, nil, []string{script, action})
+	return err
+}
+
+func (b *sysvBackend) Start(ctx context.Context, name string) error {
+	return b.invoke(ctx, name, "start")
+}
+
+func (b *sysvBackend) Stop(ctx context.Context, name string) error {
+	return b.invoke(ctx, name, "stop")
+}
+
+func (b *sysvBackend) Restart(ctx context.Context, name string) error {
+	return b.invoke(ctx, name, "restart")
+}
+
+func (b *sysvBackend) Reload(ctx context.Context, name string) error {
+	return b.invoke(ctx, name, "reload")
+}
+
+func (b *sysvBackend) toggle(ctx context.Context, name string, enable bool) error {
+	if _, err := b.script(name); err != nil {
+		return err
+	}
+	if _, err := exec.LookPath("update-rc.d"); err == nil {
+		action := "disable"
+		if enable {
+			action = "enable"
+		}
+		_, err = execArgv(ctx, nil, []string{"update-rc.d", name, "defaults"})
+		if err != nil {
+			return err
+		}
+		_, err = execArgv(ctx, nil, []string{"update-rc.d", name, action})
+		return err
+	}
+	if _, err := exec.LookPath("chkconfig"); err == nil {
+		action := "off"
+		if enable {
+			action = "on"
+		}
+		_, err = execArgv(ctx, nil, []string{"chkconfig", name, action})
+		return err
+	}
+	return errors.New("neither update-rc.d nor chkconfig is found")
+}
+
+func (b *sysvBackend) Enable(ctx context.Context, name string) error {
+	return b.toggle(ctx, name, true)
+}
+
+func (b *sysvBackend) Disable(ctx context.Context, name string) error {
+	return b.toggle(ctx, name, false)
+}
+
+func (b *sysvBackend) List(ctx context.Context) (map[string]string, error) {
+	entries, err := os.ReadDir(filepath.Join(b.root, "init.d"))
+	if err != nil {
+		return nil, err
+	}
+	services := map[string]string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		state, err := b.Status(ctx, entry.Name())
+		if err != nil {
+			continue
+		}
+		services[entry.Name()] = state.State
+	}
+	return services, nil
+}
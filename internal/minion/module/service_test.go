@@ -0,0 +1,111 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func TestServiceFunctions(t *testing.T) {
+	bin, err := filepath.Abs("testdata/fakesvc")
+	if !assert.NoError(t, err) {
+		return
+	}
+	db := filepath.Join(t.TempDir(), "services")
+	_ = os.WriteFile(db, []byte("nginx.service inactive disabled\nsshd.service active enabled\n"), 0644)
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_SVC_DB", db)
+
+	r := NewRegistry()
+	RegisterBuiltin(r)
+
+	rsp, out := callJSON[any](r, "service.status", "nginx", "provider=systemd")
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, map[string]any{"name": "nginx", "active": false, "enabled": false, "state": "inactive"}, out)
+
+	rsp, out = callJSON[any](r, "service.start", "nginx", "provider=systemd")
+	assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error)
+	assert.Equal(t, map[string]any{
+		"name":    "nginx",
+		"before":  map[string]any{"name": "nginx", "active": false, "enabled": false, "state": "inactive"},
+		"after":   map[string]any{"name": "nginx", "active": true, "enabled": false, "state": "active", "pid": float64(100)},
+		"changed": true,
+	}, out)
+	assert.True(t, rsp.Changes.Changed)
+
+	rsp, out = callJSON[any](r, "service.start", "nginx", "provider=systemd")
+	assert.Equal(t, false, out.(map[string]any)["changed"])
+	assert.Nil(t, rsp.Changes)
+
+	_, out = callJSON[any](r, "service.is_enabled", "nginx", "provider=systemd")
+	assert.Equal(t, false, out)
+	rsp, _ = callJSON[any](r, "service.enable", "nginx", "provider=systemd")
+	assert.True(t, rsp.Changes.Changed)
+	_, out = callJSON[any](r, "service.is_enabled", "nginx", "provider=systemd")
+	assert.Equal(t, true, out)
+
+	rsp, _ = callJSON[any](r, "service.restart", "sshd", "provider=systemd")
+	assert.True(t, rsp.Changes.Changed)
+
+	rsp, _ = callJSON[any](r, "service.stop", "sshd", "provider=systemd")
+	assert.True(t, rsp.Changes.Changed)
+
+	_, out = callJSON[any](r, "service.list", "provider=systemd")
+	assert.Equal(t, map[string]any{"nginx": "active", "sshd": "inactive"}, out)
+
+	rsp, _ = callJSON[any](r, "service.status", "missing", "provider=systemd")
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Contains(t, rsp.Error, "service missing not found")
+}
+
+func TestSysvBackend(t *testing.T) {
+	root := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(root, "init.d"), 0755)
+	_ = os.MkdirAll(filepath.Join(root, "rc3.d"), 0755)
+	script := filepath.Join(root, "init.d", "cron")
+	_ = os.WriteFile(script, []byte("#!/bin/sh\n[ \"$1\" = status ] && exit 3\nexit 0\n"), 0755)
+	_ = os.Symlink(script, filepath.Join(root, "rc3.d", "S20cron"))
+
+	b := &sysvBackend{root: root}
+	state, err := b.Status(context.TODO(), "cron")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &ServiceState{Name: "cron", Enabled: true, State: "inactive"}, state)
+
+	services, err := b.List(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cron": "inactive"}, services)
+
+	_, err = b.Status(context.TODO(), "missing")
+	assert.Error(t, err)
+}
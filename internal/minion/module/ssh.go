@@ -0,0 +1,315 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAuthorizedKeys is the authorized_keys file relative to the home of user
+const DefaultAuthorizedKeys = ".ssh/authorized_keys"
+
+// AuthKey is a line of authorized_keys
+type AuthKey struct {
+	Options string `json:"options,omitempty"`
+	Enc     string `json:"enc"`
+	Key     string `json:"key"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// Line returns the line of authorized_keys
+func (k *AuthKey) Line() string {
+	parts := make([]string, 0, 4)
+	if k.Options != "" {
+		parts = append(parts, k.Options)
+	}
+	parts = append(parts, k.Enc, k.Key)
+	if k.Comment != "" {
+		parts = append(parts, k.Comment)
+	}
+	return strings.Join(parts, " ")
+}
+
+func isKeyType(text string) bool {
+	for _, prefix := range []string{"ssh-", "ecdsa-", "sk-"} {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAuthKey parses the line of authorized_keys, e.g.
+//
+//	no-pty,from="10.0.0.1" ssh-ed25519 AAAAC3Nza... admin@example
+func ParseAuthKey(line string) (*AuthKey, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, errors.New("empty authorized key")
+	}
+
+	key := &AuthKey{}
+	if !isKeyType(line) {
+		// the options end at the first space outside of quotes
+		quoted := false
+		end := len(line)
+		for i, c := range line {
+			if c == '"' {
+				quoted = !quoted
+			} else if c == ' ' && !quoted {
+				end = i
+				break
+			}
+		}
+		key.Options = line[:end]
+		line = strings.TrimSpace(line[end:])
+	}
+
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 || !isKeyType(fields[0]) {
+		return nil, fmt.Errorf("invalid authorized key '%s'", line)
+	}
+	key.Enc, key.Key = fields[0], fields[1]
+	if len(fields) == 3 {
+		key.Comment = strings.TrimSpace(fields[2])
+	}
+	return key, nil
+}
+
+// SSHFunctions returns the functions of ssh module
+func SSHFunctions() []*Function {
+	return newAccounts("/").sshFunctions()
+}
+
+func (a *accounts) sshFunctions() []*Function {
+	userArg := &Arg{Name: "user", Type: String, Required: true, Doc: "the owner of authorized_keys"}
+	configArg := &Arg{Name: "config", Type: String, Keyword: true, Default: DefaultAuthorizedKeys,
+		Doc: "the authorized_keys file, the relative path is relative to the home of user"}
+	return []*Function{
+		{
+			Name: "ssh.set_auth_key",
+			Doc:  "Add the public key to authorized_keys, the line of the same key is replaced if it differs.",
+			Args: []*Arg{
+				userArg,
+				{Name: "key", Type: String, Required: true, Doc: "the public key line, or the base64 key with enc"},
+				{Name: "enc", Type: String, Keyword: true, Default: "ssh-ed25519", Doc: "the key type used when key is base64 only"},
+				{Name: "comment", Type: String, Keyword: true, Doc: "the comment of key"},
+				{Name: "options", Type: List, Keyword: true, Doc: "the options of key, e.g. no-pty"},
+				configArg,
+			},
+			Returns: "a mapping with changed, state (new, replaced or unchanged) and file",
+			Handler: a.setAuthKey,
+		},
+		{
+			Name: "ssh.rm_auth_key",
+			Doc:  "Remove the public key from authorized_keys.",
+			Args: []*Arg{
+				userArg,
+				{Name: "key", Type: String, Required: true, Doc: "the public key line or the base64 key"},
+				configArg,
+			},
+			Returns: "a mapping with changed and file",
+			Handler: a.rmAuthKey,
+		},
+	}
+}
+
+// authKeysFile returns the user and authorized_keys file
+func (a *accounts) authKeysFile(req *Request) (*UserInfo, string, error) {
+	u, err := a.mustUser(req.Args.String("user"))
+	if err != nil {
+		return nil, "", err
+	}
+	config := req.Args.String("config")
+	if !filepath.IsAbs(config) {
+		config = filepath.Join(u.Home, config)
+	}
+	if err = checkAuthKeysPath(u, config); err != nil {
+		return nil, "", err
+	}
+	return u, config, nil
+}
+
+// checkAuthKeysPath refuses the authorized_keys whose existing path components are symlinks,
+// or are owned by the others than root and the user when maco-minion runs as root. So the user
+// can't redirect the read and write of root to other files.
+func checkAuthKeysPath(u *UserInfo, filename string) error {
+	filename = filepath.Clean(filename)
+	for name := filename; ; name = filepath.Dir(name) {
+		stat, err := os.Lstat(name)
+		switch {
+		case err == nil:
+			if stat.Mode()&os.ModeSymlink != 0 {
+				return fmt.Errorf("refuse to use %s: %s is a symlink", filename, name)
+			}
+			if name == filename && !stat.Mode().IsRegular() {
+				return fmt.Errorf("refuse to use %s: not a regular file", filename)
+			}
+			if uid, _, ok := fileOwner(stat); ok && os.Geteuid() == 0 && uid != 0 && uid != u.Uid {
+				return fmt.Errorf("refuse to use %s: %s is not owned by root or %s", filename, name, u.Name)
+			}
+		case !os.IsNotExist(err):
+			return err
+		}
+		if name == filepath.Dir(name) {
+			return nil
+		}
+	}
+}
+
+// readAuthKeys returns the lines of authorized_keys, missing file is empty
+func readAuthKeys(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return []string{}, nil
+	}
+	return lines, nil
+}
+
+// writeAuthKeys writes authorized_keys with 0600 and creates its directory with 0700,
+// both are owned by the user when maco-minion runs as root
+func writeAuthKeys(u *UserInfo, filename string, lines []string) error {
+	dir := filepath.Dir(filename)
+	_, statErr := os.Lstat(dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	data := strings.Join(lines, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	if err := WriteFileAtomic(filename, []byte(data), 0600); err != nil {
+		return err
+	}
+	if os.Geteuid() == 0 {
+		if os.IsNotExist(statErr) {
+			_ = os.Lchown(dir, u.Uid, u.Gid)
+		}
+		return os.Lchown(filename, u.Uid, u.Gid)
+	}
+	return nil
+}
+
+func (a *accounts) setAuthKey(ctx context.Context, req *Request) (*Result, error) {
+	u, filename, err := a.authKeysFile(req)
+	if err != nil {
+		return nil, err
+	}
+
+	text := req.Args.String("key")
+	key, err := ParseAuthKey(text)
+	if err != nil {
+		// the base64 key only
+		if strings.ContainsAny(strings.TrimSpace(text), " \t") {
+			return nil, err
+		}
+		key = &AuthKey{Enc: req.Args.String("enc"), Key: strings.TrimSpace(text)}
+	}
+	if comment := req.Args.String("comment"); comment != "" {
+		key.Comment = comment
+	}
+	if options := req.Args.List("options"); len(options) > 0 {
+		key.Options = strings.Join(options, ",")
+	}
+	line := key.Line()
+
+	lines, err := readAuthKeys(filename)
+	if err != nil {
+		return nil, err
+	}
+	state := "new"
+	for i, item := range lines {
+		existing, err := ParseAuthKey(item)
+		if err != nil || existing.Key != key.Key {
+			continue
+		}
+		if item == line {
+			state = "unchanged"
+		} else {
+			state = "replaced"
+			lines[i] = line
+		}
+		break
+	}
+	out := map[string]any{"changed": state != "unchanged", "state": state, "file": filename}
+	if state == "unchanged" {
+		return changedResult(out, nil), nil
+	}
+
+	if state == "new" {
+		lines = append(lines, line)
+	}
+	if !req.Test {
+		if err = writeAuthKeys(u, filename, lines); err != nil {
+			return nil, err
+		}
+	}
+	return changedResult(out, map[string]any{state: line}), nil
+}
+
+func (a *accounts) rmAuthKey(ctx context.Context, req *Request) (*Result, error) {
+	u, filename, err := a.authKeysFile(req)
+	if err != nil {
+		return nil, err
+	}
+	target := strings.TrimSpace(req.Args.String("key"))
+	if key, err := ParseAuthKey(target); err == nil {
+		target = key.Key
+	}
+
+	lines, err := readAuthKeys(filename)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0, len(lines))
+	removed := make([]string, 0)
+	for _, item := range lines {
+		if key, err := ParseAuthKey(item); err == nil && key.Key == target {
+			removed = append(removed, item)
+			continue
+		}
+		kept = append(kept, item)
+	}
+	out := map[string]any{"changed": len(removed) > 0, "file": filename}
+	if len(removed) == 0 {
+		return changedResult(out, nil), nil
+	}
+
+	if !req.Test {
+		if err = writeAuthKeys(u, filename, kept); err != nil {
+			return nil, err
+		}
+	}
+	return changedResult(out, map[string]any{"removed": removed}), nil
+}
@@ -0,0 +1,483 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DiskUsage is the usage of filesystem returned by status.diskusage
+type DiskUsage struct {
+	Filesystem string `json:"filesystem,omitempty"`
+	Type       string `json:"type,omitempty"`
+	Total      uint64 `json:"total"`
+	Used       uint64 `json:"used"`
+	Free       uint64 `json:"free"`
+	Available  uint64 `json:"available"`
+	// Capacity the percentage of used space, e.g. 42.5
+	Capacity float64 `json:"capacity"`
+	Inodes   uint64  `json:"inodes"`
+	IFree    uint64  `json:"ifree"`
+}
+
+// pseudoFS the filesystems skipped by status.diskusage
+var pseudoFS = map[string]struct{}{
+	"autofs": {}, "binfmt_misc": {}, "bpf": {}, "cgroup": {}, "cgroup2": {}, "configfs": {},
+	"debugfs": {}, "devpts": {}, "devtmpfs": {}, "fusectl": {}, "hugetlbfs": {}, "mqueue": {},
+	"nsfs": {}, "proc": {}, "pstore": {}, "rpc_pipefs": {}, "securityfs": {}, "selinuxfs": {},
+	"sysfs": {}, "tracefs": {},
+}
+
+// cpuFields the columns of cpu lines in /proc/stat
+var cpuFields = []string{"user", "nice", "system", "idle", "iowait", "irq", "softirq", "steal", "guest", "guest_nice"}
+
+// status reads the state of minion from the filesystem rooted at root
+type status struct {
+	root string
+}
+
+// StatusFunctions returns the functions of status module, they parse /proc and statfs of the host
+func StatusFunctions() []*Function {
+	return newStatus("/").functions()
+}
+
+func newStatus(root string) *status {
+	return &status{root: root}
+}
+
+func (s *status) path(elem ...string) string {
+	return filepath.Join(append([]string{s.root}, elem...)...)
+}
+
+func (s *status) read(elem ...string) (string, error) {
+	data, err := os.ReadFile(s.path(elem...))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *status) functions() []*Function {
+	return []*Function{
+		{
+			Name:    "status.loadavg",
+			Doc:     "Return the load average of the minion.",
+			Returns: "a mapping with 1m, 5m, 15m, running, total and last_pid",
+			Handler: s.loadavg,
+		},
+		{
+			Name:    "status.uptime",
+			Doc:     "Return the uptime of the minion.",
+			Returns: "a mapping with seconds, days, since (RFC3339) and since_t (unix timestamp)",
+			Handler: s.uptime,
+		},
+		{
+			Name:    "status.meminfo",
+			Doc:     "Return the memory information from /proc/meminfo, the kB values are converted to bytes.",
+			Returns: "the mapping of field and value",
+			Handler: s.meminfo,
+		},
+		{
+			Name:    "status.cpuinfo",
+			Doc:     "Return the processors from /proc/cpuinfo.",
+			Returns: "the list of processors, the flags of processor is a list",
+			Handler: s.cpuinfo,
+		},
+		{
+			Name:    "status.cpustats",
+			Doc:     "Return the cpu statistics from /proc/stat.",
+			Returns: "a mapping with cpu, cpus, intr, ctxt, btime, processes, procs_running, procs_blocked and softirq",
+			Handler: s.cpustats,
+		},
+		{
+			Name:    "status.diskusage",
+			Doc:     "Return the usage of filesystems, all mounted filesystems are returned if no path is given.",
+			Varargs: "paths",
+			Returns: "the mapping of path and usage, sizes are in bytes",
+			Handler: s.diskusage,
+		},
+		{
+			Name:    "status.netstats",
+			Doc:     "Return the network statistics from /proc/net/snmp and /proc/net/netstat.",
+			Returns: "the mapping of protocol and counters, e.g. Tcp, Udp, TcpExt",
+			Handler: s.netstats,
+		},
+		{
+			Name:    "status.procs",
+			Doc:     "Return the processes of the minion.",
+			Returns: "the mapping of pid and process with name, state, ppid, uid, threads, rss and cmd",
+			Handler: s.procs,
+		},
+		{
+			Name:    "status.w",
+			Doc:     "Return the logged in users from utmp.",
+			Returns: "the list of sessions with user, tty, host, pid, login and idle seconds",
+			Handler: s.w,
+		},
+	}
+}
+
+func (s *status) loadavg(ctx context.Context, req *Request) (*Result, error) {
+	text, err := s.read("proc/loadavg")
+	if err != nil {
+		return nil, err
+	}
+	// 0.20 0.18 0.14 1/72 17608
+	fields := strings.Fields(text)
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("invalid /proc/loadavg: %s", text)
+	}
+	out := map[string]any{}
+	for i, key := range []string{"1m", "5m", "15m"} {
+		out[key], _ = strconv.ParseFloat(fields[i], 64)
+	}
+	running, total, _ := strings.Cut(fields[3], "/")
+	out["running"], _ = strconv.ParseInt(running, 10, 64)
+	out["total"], _ = strconv.ParseInt(total, 10, 64)
+	out["last_pid"], _ = strconv.ParseInt(fields[4], 10, 64)
+	return Return(out), nil
+}
+
+func (s *status) uptime(ctx context.Context, req *Request) (*Result, error) {
+	text, err := s.read("proc/uptime")
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid /proc/uptime: %s", text)
+	}
+	seconds, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid /proc/uptime: %w", err)
+	}
+
+	since := time.Now().Add(-time.Duration(seconds * float64(time.Second)))
+	return Return(map[string]any{
+		"seconds": seconds,
+		"days":    int64(seconds) / 86400,
+		"since":   since.Format(time.RFC3339),
+		"since_t": since.Unix(),
+	}), nil
+}
+
+func (s *status) meminfo(ctx context.Context, req *Request) (*Result, error) {
+	text, err := s.read("proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]uint64{}
+	for _, line := range strings.Split(text, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			n *= 1024
+		}
+		out[strings.TrimSpace(key)] = n
+	}
+	return Return(out), nil
+}
+
+func (s *status) cpuinfo(ctx context.Context, req *Request) (*Result, error) {
+	text, err := s.read("proc/cpuinfo")
+	if err != nil {
+		return nil, err
+	}
+	processors := make([]map[string]any, 0)
+	// processors are separated by empty line
+	for _, block := range strings.Split(text, "\n\n") {
+		processor := map[string]any{}
+		for _, line := range strings.Split(block, "\n") {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			key = strings.TrimSpace(key)
+			value = strings.TrimSpace(value)
+			switch key {
+			case "flags", "bugs", "Features":
+				processor[key] = strings.Fields(value)
+			default:
+				processor[key] = value
+			}
+		}
+		if len(processor) > 0 {
+			processors = append(processors, processor)
+		}
+	}
+	return Return(processors), nil
+}
+
+func (s *status) cpustats(ctx context.Context, req *Request) (*Result, error) {
+	text, err := s.read("proc/stat")
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{}
+	cpus := map[string]map[string]uint64{}
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		key := fields[0]
+		switch {
+		case strings.HasPrefix(key, "cpu"):
+			times := map[string]uint64{}
+			for i, value := range fields[1:] {
+				if i >= len(cpuFields) {
+					break
+				}
+				times[cpuFields[i]], _ = strconv.ParseUint(value, 10, 64)
+			}
+			if key == "cpu" {
+				out["cpu"] = times
+			} else {
+				cpus[key] = times
+			}
+		default:
+			// intr and softirq are followed by the counters of each number, only the total is kept
+			out[key], _ = strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	out["cpus"] = cpus
+	return Return(out), nil
+}
+
+// mounts returns the mount points and their device and type, the pseudo filesystems are skipped
+func (s *status) mounts() (map[string][2]string, error) {
+	text, err := s.read("proc/mounts")
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][2]string{}
+	for _, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		if _, ok := pseudoFS[fields[2]]; ok {
+			continue
+		}
+		// the space in mount point is escaped as \040
+		target := strings.ReplaceAll(fields[1], `\040`, " ")
+		out[target] = [2]string{fields[0], fields[2]}
+	}
+	return out, nil
+}
+
+func (s *status) diskusage(ctx context.Context, req *Request) (*Result, error) {
+	mounts, err := s.mounts()
+	if err != nil && len(req.Varargs) == 0 {
+		return nil, err
+	}
+
+	paths := req.Varargs
+	if len(paths) == 0 {
+		for target := range mounts {
+			paths = append(paths, target)
+		}
+		sort.Strings(paths)
+	}
+
+	out := map[string]*DiskUsage{}
+	for _, path := range paths {
+		usage, err := diskUsage(path)
+		if err != nil {
+			// the mount point may be unavailable, e.g. stale nfs
+			if len(req.Varargs) == 0 {
+				continue
+			}
+			return nil, err
+		}
+		if mount, ok := mounts[path]; ok {
+			usage.Filesystem, usage.Type = mount[0], mount[1]
+		}
+		out[path] = usage
+	}
+	return Return(out), nil
+}
+
+// newDiskUsage creates DiskUsage by the blocks of statfs
+func newDiskUsage(bsize, blocks, bfree, bavail, files, ffree uint64) *DiskUsage {
+	usage := &DiskUsage{
+		Total:     blocks * bsize,
+		Free:      bfree * bsize,
+		Available: bavail * bsize,
+		Inodes:    files,
+		IFree:     ffree,
+	}
+	usage.Used = usage.Total - usage.Free
+	// the same as df, the reserved blocks are excluded
+	if total := usage.Used + usage.Available; total > 0 {
+		usage.Capacity = float64(int64(float64(usage.Used)/float64(total)*10000)) / 100
+	}
+	return usage
+}
+
+func (s *status) netstats(ctx context.Context, req *Request) (*Result, error) {
+	out := map[string]map[string]int64{}
+	found := false
+	for _, name := range []string{"proc/net/snmp", "proc/net/netstat"} {
+		text, err := s.read(name)
+		if err != nil {
+			continue
+		}
+		found = true
+
+		// the header line and value line of each protocol are adjacent:
+		//
+		//	Tcp: RtoAlgorithm RtoMin
+		//	Tcp: 1 200
+		lines := strings.Split(strings.TrimSpace(text), "\n")
+		for i := 0; i+1 < len(lines); i += 2 {
+			keys := strings.Fields(lines[i])
+			values := strings.Fields(lines[i+1])
+			if len(keys) == 0 || len(keys) != len(values) || keys[0] != values[0] {
+				continue
+			}
+			proto := strings.TrimSuffix(keys[0], ":")
+			counters := map[string]int64{}
+			for j := 1; j < len(keys); j++ {
+				counters[keys[j]], _ = strconv.ParseInt(values[j], 10, 64)
+			}
+			out[proto] = counters
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not readable", s.path("proc/net/snmp"))
+	}
+	return Return(out), nil
+}
+
+func (s *status) procs(ctx context.Context, req *Request) (*Result, error) {
+	entries, err := os.ReadDir(s.path("proc"))
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]map[string]any{}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil || !entry.IsDir() {
+			continue
+		}
+		// the process may exit at any time
+		text, err := s.read("proc", entry.Name(), "status")
+		if err != nil {
+			continue
+		}
+		info := map[string]string{}
+		for _, line := range strings.Split(text, "\n") {
+			if key, value, ok := strings.Cut(line, ":"); ok {
+				info[key] = strings.TrimSpace(value)
+			}
+		}
+
+		proc := map[string]any{
+			"name":  info["Name"],
+			"state": info["State"],
+		}
+		proc["ppid"], _ = strconv.ParseInt(info["PPid"], 10, 64)
+		proc["threads"], _ = strconv.ParseInt(info["Threads"], 10, 64)
+		if fields := strings.Fields(info["Uid"]); len(fields) > 0 {
+			proc["uid"], _ = strconv.ParseInt(fields[0], 10, 64)
+		}
+		if fields := strings.Fields(info["VmRSS"]); len(fields) > 0 {
+			rss, _ := strconv.ParseUint(fields[0], 10, 64)
+			proc["rss"] = rss * 1024
+		}
+		if cmdline, err := s.read("proc", entry.Name(), "cmdline"); err == nil {
+			proc["cmd"] = strings.TrimSpace(strings.ReplaceAll(cmdline, "\x00", " "))
+		}
+		out[entry.Name()] = proc
+	}
+	return Return(out), nil
+}
+
+// the layout of struct utmp on linux, the fields are in the byte order of host
+const (
+	utmpSize        = 384
+	utmpUserProcess = 7
+)
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func (s *status) w(ctx context.Context, req *Request) (*Result, error) {
+	var data []byte
+	var err error
+	for _, name := range []string{"var/run/utmp", "run/utmp"} {
+		if data, err = os.ReadFile(s.path(name)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	sessions := make([]map[string]any, 0)
+	for offset := 0; offset+utmpSize <= len(data); offset += utmpSize {
+		record := data[offset : offset+utmpSize]
+		if int16(binary.NativeEndian.Uint16(record[0:2])) != utmpUserProcess {
+			continue
+		}
+		tty := cString(record[8:40])
+		login := time.Unix(int64(int32(binary.NativeEndian.Uint32(record[340:344]))), 0)
+		session := map[string]any{
+			"user":    cString(record[44:76]),
+			"tty":     tty,
+			"host":    cString(record[76:332]),
+			"pid":     int32(binary.NativeEndian.Uint32(record[4:8])),
+			"login":   login.Format(time.RFC3339),
+			"login_t": login.Unix(),
+		}
+		// the idle time is the duration since the last access of terminal
+		if stat, err := os.Stat(s.path("dev", tty)); err == nil && tty != "" {
+			session["idle"] = int64(now.Sub(stat.ModTime()).Seconds())
+		}
+		sessions = append(sessions, session)
+	}
+	return Return(sessions), nil
+}
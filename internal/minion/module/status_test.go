@@ -0,0 +1,137 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func writeProcFile(t *testing.T, root, name, data string) {
+	filename := filepath.Join(root, name)
+	_ = os.MkdirAll(filepath.Dir(filename), 0755)
+	if err := os.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStatusFunctions(t *testing.T) {
+	root := t.TempDir()
+	writeProcFile(t, root, "proc/loadavg", "0.20 0.18 0.14 1/72 17608\n")
+	writeProcFile(t, root, "proc/uptime", "90061.50 2739.59\n")
+	writeProcFile(t, root, "proc/meminfo", "MemTotal:        8048352 kB\nHugePages_Total:       0\n")
+	writeProcFile(t, root, "proc/cpuinfo", "processor\t: 0\nmodel name\t: Fake CPU\nflags\t\t: fpu sse\n\n"+
+		"processor\t: 1\nmodel name\t: Fake CPU\nflags\t\t: fpu sse\n")
+	writeProcFile(t, root, "proc/stat", "cpu  100 0 50 1000 10 0 2 0 0 0\ncpu0 100 0 50 1000 10 0 2 0 0 0\n"+
+		"intr 1234 0 1\nctxt 5678\nbtime 1700000000\nprocesses 90\nprocs_running 1\nprocs_blocked 0\n")
+	writeProcFile(t, root, "proc/mounts", "proc /proc proc rw 0 0\n/dev/sda1 / ext4 rw 0 0\n")
+	writeProcFile(t, root, "proc/net/snmp", "Tcp: RtoMin ActiveOpens\nTcp: 200 12\nUdp: InDatagrams\nUdp: 7\n")
+	writeProcFile(t, root, "proc/net/netstat", "TcpExt: SyncookiesSent\nTcpExt: 3\n")
+	writeProcFile(t, root, "proc/42/status", "Name:\tnginx\nState:\tS (sleeping)\nPPid:\t1\n"+
+		"Uid:\t33\t33\t33\t33\nVmRSS:\t    2048 kB\nThreads:\t4\n")
+	writeProcFile(t, root, "proc/42/cmdline", "nginx: worker\x00-g\x00daemon off;\x00")
+
+	record := make([]byte, utmpSize*2)
+	binary.NativeEndian.PutUint16(record[0:2], utmpUserProcess)
+	binary.NativeEndian.PutUint32(record[4:8], 1001)
+	copy(record[8:40], "pts/0")
+	copy(record[44:76], "alice")
+	copy(record[76:332], "10.0.0.1")
+	binary.NativeEndian.PutUint32(record[340:344], 1700000000)
+	// the second record is a dead process
+	binary.NativeEndian.PutUint16(record[utmpSize:utmpSize+2], 8)
+	writeProcFile(t, root, "var/run/utmp", string(record))
+
+	r := NewRegistry()
+	r.MustRegister(newStatus(root).functions()...)
+
+	rsp, loadavg := callJSON[map[string]any](r, "status.loadavg")
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, map[string]any{
+		"1m": 0.2, "5m": 0.18, "15m": 0.14, "running": float64(1), "total": float64(72), "last_pid": float64(17608),
+	}, loadavg)
+
+	_, uptime := callJSON[map[string]any](r, "status.uptime")
+	assert.Equal(t, 90061.5, uptime["seconds"])
+	assert.Equal(t, float64(1), uptime["days"])
+
+	_, meminfo := callJSON[map[string]any](r, "status.meminfo")
+	assert.Equal(t, map[string]any{"MemTotal": float64(8048352 * 1024), "HugePages_Total": float64(0)}, meminfo)
+
+	_, cpus := callJSON[[]any](r, "status.cpuinfo")
+	if assert.Len(t, cpus, 2) {
+		assert.Equal(t, map[string]any{"processor": "1", "model name": "Fake CPU", "flags": []any{"fpu", "sse"}}, cpus[1])
+	}
+
+	_, stats := callJSON[map[string]any](r, "status.cpustats")
+	assert.Equal(t, float64(1000), stats["cpu"].(map[string]any)["idle"])
+	assert.Equal(t, float64(50), stats["cpus"].(map[string]any)["cpu0"].(map[string]any)["system"])
+	assert.Equal(t, float64(1234), stats["intr"])
+	assert.Equal(t, float64(1700000000), stats["btime"])
+
+	_, disks := callJSON[map[string]map[string]any](r, "status.diskusage", "/")
+	usage := disks["/"]
+	assert.Equal(t, "/dev/sda1", usage["filesystem"])
+	assert.Equal(t, "ext4", usage["type"])
+	assert.Greater(t, usage["total"], float64(0))
+
+	_, netstats := callJSON[map[string]any](r, "status.netstats")
+	assert.Equal(t, map[string]any{
+		"Tcp":    map[string]any{"RtoMin": float64(200), "ActiveOpens": float64(12)},
+		"Udp":    map[string]any{"InDatagrams": float64(7)},
+		"TcpExt": map[string]any{"SyncookiesSent": float64(3)},
+	}, netstats)
+
+	_, procs := callJSON[map[string]any](r, "status.procs")
+	assert.Equal(t, map[string]any{
+		"42": map[string]any{
+			"name": "nginx", "state": "S (sleeping)", "ppid": float64(1), "uid": float64(33),
+			"threads": float64(4), "rss": float64(2048 * 1024), "cmd": "nginx: worker -g daemon off;",
+		},
+	}, procs)
+
+	_, sessions := callJSON[[]map[string]any](r, "status.w")
+	if assert.Len(t, sessions, 1) {
+		session := sessions[0]
+		assert.Equal(t, "alice", session["user"])
+		assert.Equal(t, "pts/0", session["tty"])
+		assert.Equal(t, "10.0.0.1", session["host"])
+		assert.Equal(t, float64(1001), session["pid"])
+		assert.Equal(t, float64(1700000000), session["login_t"])
+	}
+}
+
+func TestNewDiskUsage(t *testing.T) {
+	usage := newDiskUsage(4096, 1000, 400, 300, 100, 60)
+	assert.Equal(t, uint64(4096000), usage.Total)
+	assert.Equal(t, uint64(2457600), usage.Used)
+	assert.Equal(t, uint64(1228800), usage.Available)
+	assert.Equal(t, 66.66, usage.Capacity)
+}
@@ -0,0 +1,158 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+// Argspec returns the argument schema of function
+func (f *Function) Argspec() *types.Argspec {
+	spec := &types.Argspec{Args: make([]*types.ArgSpec, 0, len(f.Args)), Varargs: f.Varargs}
+	for _, arg := range f.Args {
+		spec.Args = append(spec.Args, &types.ArgSpec{
+			Name:     arg.Name,
+			Type:     string(arg.Type),
+			Required: arg.Required,
+			Default:  arg.Default,
+			Keyword:  arg.Keyword,
+			Doc:      arg.Doc,
+		})
+	}
+	return spec
+}
+
+// Document returns the documentation of function
+func (f *Function) Document() *types.FunctionDoc {
+	return &types.FunctionDoc{
+		Name:    f.Name,
+		Doc:     f.Doc,
+		Argspec: *f.Argspec(),
+		Returns: f.Returns,
+	}
+}
+
+// Match returns the functions matched by the patterns, all functions are returned if patterns is empty.
+// A pattern without '.' matches all functions of module, otherwise it is a glob of function name,
+// e.g. "cmd", "cmd.run", "file.*".
+func (r *Registry) Match(patterns ...string) ([]*Function, error) {
+	fns := r.Functions()
+	if len(patterns) == 0 {
+		return fns, nil
+	}
+
+	out := make([]*Function, 0)
+	for _, fn := range fns {
+		for _, pattern := range patterns {
+			matched := false
+			if !strings.Contains(pattern, ".") {
+				matched = fn.Module() == pattern
+			} else {
+				var err error
+				matched, err = path.Match(pattern, fn.Name)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if matched {
+				out = append(out, fn)
+				break
+			}
+		}
+	}
+
+	// the exact name which is not registered
+	if len(out) == 0 && len(patterns) == 1 && strings.Contains(patterns[0], ".") &&
+		!strings.ContainsAny(patterns[0], "*?[") {
+		return nil, &NotAvailableError{Name: patterns[0]}
+	}
+	return out, nil
+}
+
+// SysFunctions returns the functions of sys module which describe the functions of Registry
+func SysFunctions(r *Registry) []*Function {
+	return []*Function{
+		{
+			Name:    "sys.list_modules",
+			Doc:     "List the modules loaded on the minion.",
+			Returns: "the sorted list of module names",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				return Return(r.Modules()), nil
+			},
+		},
+		{
+			Name:    "sys.list_functions",
+			Doc:     "List the functions loaded on the minion, optionally filtered by module names or globs.",
+			Varargs: "modules",
+			Returns: "the sorted list of function names",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				fns, err := r.Match(req.Varargs...)
+				if err != nil {
+					return nil, err
+				}
+				names := make([]string, 0, len(fns))
+				for _, fn := range fns {
+					names = append(names, fn.Name)
+				}
+				return Return(names), nil
+			},
+		},
+		{
+			Name:    "sys.doc",
+			Doc:     "Return the documentation of functions by function names, module names or globs.",
+			Varargs: "functions",
+			Returns: "the mapping of function name and its documentation",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				fns, err := r.Match(req.Varargs...)
+				if err != nil {
+					return nil, err
+				}
+				out := make(map[string]*types.FunctionDoc, len(fns))
+				for _, fn := range fns {
+					out[fn.Name] = fn.Document()
+				}
+				return Return(out), nil
+			},
+		},
+		{
+			Name:    "sys.argspec",
+			Doc:     "Return the argument schema of functions by function names, module names or globs.",
+			Varargs: "functions",
+			Returns: "the mapping of function name and its arguments",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				fns, err := r.Match(req.Varargs...)
+				if err != nil {
+					return nil, err
+				}
+				out := make(map[string]*types.Argspec, len(fns))
+				for _, fn := range fns {
+					out[fn.Name] = fn.Argspec()
+				}
+				return Return(out), nil
+			},
+		},
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func TestSysFunctions(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltin(r)
+
+	rsp, modules := callJSON[[]string](r, "sys.list_modules")
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, []string{"cmd", "file", "group", "pkg", "service", "ssh", "status", "sys", "test", "user"}, modules)
+
+	_, functions := callJSON[[]string](r, "sys.list_functions", "sys")
+	assert.Equal(t, []string{"sys.argspec", "sys.doc", "sys.list_functions", "sys.list_modules"}, functions)
+
+	_, functions = callJSON[[]string](r, "sys.list_functions", "cmd.run*")
+	assert.Equal(t, []string{"cmd.run", "cmd.run_all"}, functions)
+
+	_, docs := callJSON[map[string]*types.FunctionDoc](r, "sys.doc", "cmd.run")
+	if assert.Contains(t, docs, "cmd.run") {
+		doc := docs["cmd.run"]
+		assert.Equal(t, "cmd.run", doc.Name)
+		assert.NotEmpty(t, doc.Doc)
+		assert.Equal(t, "cmd", doc.Args[0].Name)
+		assert.True(t, doc.Args[0].Required)
+	}
+
+	_, specs := callJSON[map[string]*types.Argspec](r, "sys.argspec", "service")
+	assert.Len(t, specs, 9)
+	assert.Equal(t, &types.ArgSpec{Name: "provider", Type: string(String), Keyword: true,
+		Doc: "the service backend, systemd or sysv. Detected by default"}, specs["service.list"].Args[0])
+
+	rsp, _ = callJSON[any](r, "sys.doc", "cmd.missing")
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Equal(t, "function cmd.missing is not available", rsp.Error)
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+
+	version "github.com/vine-io/maco/pkg/version"
+)
+
+// MaxRandomPayload is the max size of test.random_payload. The result goes
+// through the chunked rsa encryption of the dispatch stream, decrypting it takes
+// the master seconds of cpu per MiB, so the payload is kept small.
+const MaxRandomPayload = 1024 * 1024
+
+const payloadAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// TestFunctions returns the functions of test module, they don't depend on any external command
+// and are used to probe the round trip between maco-master and maco-minion.
+func TestFunctions() []*Function {
+	return []*Function{
+		{
+			Name:    "test.ping",
+			Doc:     "Check whether the minion is responding.",
+			Returns: "true",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				return Return(true), nil
+			},
+		},
+		{
+			Name:    "test.echo",
+			Doc:     "Return the given text.",
+			Args:    []*Arg{{Name: "text", Type: String, Required: true, Doc: "the text to echo"}},
+			Returns: "the text",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				return Return(req.Args.String("text")), nil
+			},
+		},
+		{
+			Name: "test.sleep",
+			Doc:  "Sleep for the given seconds, it is interrupted by the timeout of call.",
+			Args: []*Arg{
+				{Name: "seconds", Type: Float, Required: true, Doc: "the duration to sleep, e.g. 1.5"},
+			},
+			Returns: "true when the sleep is finished",
+			Handler: testSleep,
+		},
+		{
+			Name:    "test.version",
+			Doc:     "Return the version of maco-minion.",
+			Returns: "a mapping with version, commit, build date, go version, os and arch",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				return Return(map[string]string{
+					"version": version.ReleaseVersion(),
+					"commit":  version.GitCommit,
+					"date":    version.BuildDate,
+					"go":      runtime.Version(),
+					"os":      runtime.GOOS,
+					"arch":    runtime.GOARCH,
+				}), nil
+			},
+		},
+		{
+			Name: "test.fib",
+			Doc:  "Compute the num-th Fibonacci number.",
+			Args: []*Arg{
+				{Name: "num", Type: Integer, Required: true, Doc: "the index of Fibonacci number, between 0 and 93"},
+			},
+			Returns: "a mapping with the value and elapsed seconds",
+			Handler: testFib,
+		},
+		{
+			Name: "test.exception",
+			Doc:  "Return an error with the given message, used to check the error propagation.",
+			Args: []*Arg{
+				{Name: "message", Type: String, Default: "test exception", Doc: "the message of error"},
+			},
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				return nil, errors.New(req.Args.String("message"))
+			},
+		},
+		{
+			Name: "test.random_payload",
+			Doc:  "Return a random alphanumeric text of the given size, used to check the transmission of large result.",
+			Args: []*Arg{
+				{Name: "size", Type: Integer, Default: int64(1024), Doc: "the size of payload in bytes, at most 1 MiB"},
+			},
+			Returns: "the random text",
+			Handler: testRandomPayload,
+		},
+	}
+}
+
+func testSleep(ctx context.Context, req *Request) (*Result, error) {
+	seconds := req.Args.Float("seconds")
+	if seconds < 0 {
+		return nil, fmt.Errorf("invalid seconds %v", seconds)
+	}
+
+	timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return nil, fmt.Errorf("sleep interrupted: %w", ctx.Err())
+	case <-timer.C:
+		return Return(true), nil
+	}
+}
+
+func testFib(ctx context.Context, req *Request) (*Result, error) {
+	num := req.Args.Int("num")
+	// fib(94) overflows uint64
+	if num < 0 || num > 93 {
+		return nil, fmt.Errorf("num must be between 0 and 93, got %d", num)
+	}
+
+	start := time.Now()
+	var a, b uint64 = 0, 1
+	for i := int64(0); i < num; i++ {
+		a, b = b, a+b
+	}
+	return Return(map[string]any{
+		"value":   a,
+		"elapsed": time.Since(start).Seconds(),
+	}), nil
+}
+
+func testRandomPayload(ctx context.Context, req *Request) (*Result, error) {
+	size := req.Args.Int("size")
+	if size < 0 || size > MaxRandomPayload {
+		return nil, fmt.Errorf("size must be between 0 and %d, got %d", MaxRandomPayload, size)
+	}
+
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	for i := range buf {
+		buf[i] = payloadAlphabet[int(buf[i])%len(payloadAlphabet)]
+	}
+	return Return(string(buf)), nil
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func TestTestFunctions(t *testing.T) {
+	r := NewRegistry()
+	RegisterBuiltin(r)
+
+	rsp, out := callJSON[any](r, "test.ping")
+	assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error)
+	assert.Equal(t, true, out)
+
+	_, out = callJSON[any](r, "test.echo", "hello world")
+	assert.Equal(t, "hello world", out)
+
+	_, out = callJSON[any](r, "test.sleep", "0.01")
+	assert.Equal(t, true, out)
+
+	rsp, _ = callRequestJSON[any](r, &types.CallRequest{Function: "test.sleep", Args: []string{"5"}, Timeout: 1})
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Contains(t, rsp.Error, "sleep interrupted")
+
+	_, out = callJSON[any](r, "test.fib", "10")
+	assert.Equal(t, float64(55), out.(map[string]any)["value"])
+
+	rsp, _ = callJSON[any](r, "test.fib", "94")
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+
+	rsp, _ = callJSON[any](r, "test.exception", "boom")
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Equal(t, "boom", rsp.Error)
+
+	_, out = callJSON[any](r, "test.random_payload", "size=4096")
+	assert.Len(t, out, 4096)
+	assert.Regexp(t, "^[a-zA-Z0-9]+$", out)
+
+	rsp, _ = callJSON[any](r, "test.random_payload", fmt.Sprintf("size=%d", MaxRandomPayload+1))
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+
+	_, out = callJSON[any](r, "test.version")
+	assert.Equal(t, "latest", out.(map[string]any)["version"])
+}
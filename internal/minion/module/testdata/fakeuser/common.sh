@@ -0,0 +1,23 @@
+# shared helpers of the fake shadow-utils used by the tests of user and group modules.
+# The account files are $FAKE_ETC/passwd and $FAKE_ETC/group.
+
+etc=${FAKE_ETC:?}
+passwd="$etc/passwd"
+group="$etc/group"
+
+# next_id file min: the next free id of file
+next_id() { awk -F: -v m="$2" 'BEGIN { n = m } $3 >= n { n = $3 + 1 } END { print n }' "$1"; }
+# gid_of name-or-gid
+gid_of() { awk -F: -v g="$1" '$1 == g || $3 == g { print $3; exit }' "$group"; }
+# set_members user groups(comma separated) append
+set_members() {
+  awk -F: -v OFS=: -v u="$1" -v gs=",$2," -v a="$3" '{
+    n = split($4, ms, ","); out = ""
+    for (i = 1; i <= n; i++) {
+      if (ms[i] == "" || (ms[i] == u && a != "1")) continue
+      out = out (out == "" ? "" : ",") ms[i]
+    }
+    if (index(gs, "," $1 ",") > 0 && index("," out ",", "," u ",") == 0) out = out (out == "" ? "" : ",") u
+    $4 = out; print
+  }' "$group" > "$group.tmp" && mv "$group.tmp" "$group"
+}
@@ -0,0 +1,516 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UserInfo is the account returned by user.info
+type UserInfo struct {
+	Name  string `json:"name"`
+	Uid   int    `json:"uid"`
+	Gid   int    `json:"gid"`
+	Gecos string `json:"gecos"`
+	Home  string `json:"home"`
+	Shell string `json:"shell"`
+	// Group the name of primary group
+	Group string `json:"group"`
+	// Groups the supplementary groups, sorted by name
+	Groups []string `json:"groups"`
+}
+
+// GroupInfo is the group in /etc/group
+type GroupInfo struct {
+	Name    string   `json:"name"`
+	Gid     int      `json:"gid"`
+	Members []string `json:"members"`
+}
+
+// accounts manages the users and groups in the /etc rooted at root.
+// The files are read directly, the modifications are made by shadow-utils,
+// e.g. useradd, usermod and groupadd.
+type accounts struct {
+	root string
+}
+
+func newAccounts(root string) *accounts {
+	return &accounts{root: root}
+}
+
+// UserFunctions returns the functions of user module
+func UserFunctions() []*Function {
+	return newAccounts("/").userFunctions()
+}
+
+// GroupFunctions returns the functions of group module
+func GroupFunctions() []*Function {
+	return newAccounts("/").groupFunctions()
+}
+
+// readColon reads the colon separated file, e.g. /etc/passwd
+func (a *accounts) readColon(name string, fields int) ([][]string, error) {
+	data, err := os.ReadFile(filepath.Join(a.root, "etc", name))
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, ":")
+		if len(parts) < fields {
+			continue
+		}
+		out = append(out, parts)
+	}
+	return out, nil
+}
+
+func (a *accounts) groups() ([]*GroupInfo, error) {
+	lines, err := a.readColon("group", 4)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*GroupInfo, 0, len(lines))
+	for _, parts := range lines {
+		group := &GroupInfo{Name: parts[0], Members: []string{}}
+		group.Gid, _ = strconv.Atoi(parts[2])
+		for _, member := range strings.Split(parts[3], ",") {
+			if member = strings.TrimSpace(member); member != "" {
+				group.Members = append(group.Members, member)
+			}
+		}
+		sort.Strings(group.Members)
+		out = append(out, group)
+	}
+	return out, nil
+}
+
+// group returns the group by name, it returns nil if the group does not exist
+func (a *accounts) group(name string) (*GroupInfo, error) {
+	groups, err := a.groups()
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if group.Name == name {
+			return group, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a *accounts) users() ([]*UserInfo, error) {
+	lines, err := a.readColon("passwd", 7)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := a.groups()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*UserInfo, 0, len(lines))
+	for _, parts := range lines {
+		u := &UserInfo{
+			Name:   parts[0],
+			Gecos:  parts[4],
+			Home:   parts[5],
+			Shell:  parts[6],
+			Groups: []string{},
+		}
+		u.Uid, _ = strconv.Atoi(parts[2])
+		u.Gid, _ = strconv.Atoi(parts[3])
+		u.Group = strconv.Itoa(u.Gid)
+		for _, group := range groups {
+			if group.Gid == u.Gid {
+				u.Group = group.Name
+			}
+			if containsString(group.Members, u.Name) {
+				u.Groups = append(u.Groups, group.Name)
+			}
+		}
+		sort.Strings(u.Groups)
+		out = append(out, u)
+	}
+	return out, nil
+}
+
+// user returns the user by name, it returns nil if the user does not exist
+func (a *accounts) user(name string) (*UserInfo, error) {
+	users, err := a.users()
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		if u.Name == name {
+			return u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (a *accounts) mustUser(name string) (*UserInfo, error) {
+	u, err := a.user(name)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, fmt.Errorf("user %s not found", name)
+	}
+	return u, nil
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *accounts) userFunctions() []*Function {
+	nameArg := &Arg{Name: "name", Type: String, Required: true, Doc: "the name of user"}
+	return []*Function{
+		{
+			Name: "user.add",
+			Doc:  "Create the user, nothing is changed if the user exists.",
+			Args: []*Arg{
+				nameArg,
+				{Name: "uid", Type: Integer, Keyword: true, Doc: "the uid of user"},
+				{Name: "gid", Type: String, Keyword: true, Doc: "the name or gid of primary group"},
+				{Name: "groups", Type: List, Keyword: true, Doc: "the supplementary groups"},
+				{Name: "home", Type: String, Keyword: true, Doc: "the home directory"},
+				{Name: "shell", Type: String, Keyword: true, Doc: "the login shell"},
+				{Name: "gecos", Type: String, Keyword: true, Doc: "the full name or comment"},
+				{Name: "createhome", Type: Boolean, Keyword: true, Default: true, Doc: "create the home directory"},
+				{Name: "system", Type: Boolean, Keyword: true, Doc: "create a system account"},
+			},
+			Returns: "a mapping with changed and the user info",
+			Handler: a.userAdd,
+		},
+		{
+			Name: "user.delete",
+			Doc:  "Delete the user, nothing is changed if the user does not exist.",
+			Args: []*Arg{
+				nameArg,
+				{Name: "remove", Type: Boolean, Keyword: true, Doc: "remove the home directory and mail spool"},
+				{Name: "force", Type: Boolean, Keyword: true, Doc: "delete the user even if it is logged in"},
+			},
+			Returns: "a mapping with changed",
+			Handler: a.userDelete,
+		},
+		{
+			Name:    "user.info",
+			Doc:     "Return the information of user.",
+			Args:    []*Arg{nameArg},
+			Returns: "the user with name, uid, gid, gecos, home, shell, group and groups",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				u, err := a.mustUser(req.Args.String("name"))
+				if err != nil {
+					return nil, err
+				}
+				return Return(u), nil
+			},
+		},
+		{
+			Name:    "user.list",
+			Doc:     "Return the names of all users.",
+			Returns: "the sorted list of user names",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				users, err := a.users()
+				if err != nil {
+					return nil, err
+				}
+				names := make([]string, 0, len(users))
+				for _, u := range users {
+					names = append(names, u.Name)
+				}
+				sort.Strings(names)
+				return Return(names), nil
+			},
+		},
+		{
+			Name: "user.chshell",
+			Doc:  "Change the login shell of user.",
+			Args: []*Arg{
+				nameArg,
+				{Name: "shell", Type: String, Required: true, Doc: "the login shell, e.g. /bin/bash"},
+			},
+			Returns: "a mapping with changed, the old and new shell",
+			Handler: a.userChshell,
+		},
+		{
+			Name: "user.chgroups",
+			Doc:  "Change the supplementary groups of user.",
+			Args: []*Arg{
+				nameArg,
+				{Name: "groups", Type: List, Required: true, Doc: "the supplementary groups"},
+				{Name: "append", Type: Boolean, Keyword: true, Doc: "add the groups instead of replacing"},
+			},
+			Returns: "a mapping with changed, the old and new groups",
+			Handler: a.userChgroups,
+		},
+	}
+}
+
+func (a *accounts) userAdd(ctx context.Context, req *Request) (*Result, error) {
+	name := req.Args.String("name")
+	u, err := a.user(name)
+	if err != nil {
+		return nil, err
+	}
+	if u != nil {
+		return changedResult(map[string]any{"changed": false, "user": u}, nil), nil
+	}
+
+	argv := []string{"useradd"}
+	if req.Args.Has("uid") {
+		argv = append(argv, "-u", strconv.FormatInt(req.Args.Int("uid"), 10))
+	}
+	if gid := req.Args.String("gid"); gid != "" {
+		argv = append(argv, "-g", gid)
+	}
+	if groups := req.Args.List("groups"); len(groups) > 0 {
+		argv = append(argv, "-G", strings.Join(groups, ","))
+	}
+	if home := req.Args.String("home"); home != "" {
+		argv = append(argv, "-d", home)
+	}
+	if shell := req.Args.String("shell"); shell != "" {
+		argv = append(argv, "-s", shell)
+	}
+	if gecos := req.Args.String("gecos"); gecos != "" {
+		argv = append(argv, "-c", gecos)
+	}
+	if req.Args.Bool("createhome") {
+		argv = append(argv, "-m")
+	} else {
+		argv = append(argv, "-M")
+	}
+	if req.Args.Bool("system") {
+		argv = append(argv, "-r")
+	}
+	argv = append(argv, name)
+	if req.Test {
+		u = &UserInfo{
+			Name:   name,
+			Uid:    int(req.Args.Int("uid")),
+			Gecos:  req.Args.String("gecos"),
+			Home:   req.Args.String("home"),
+			Shell:  req.Args.String("shell"),
+			Group:  req.Args.String("gid"),
+			Groups: req.Args.List("groups"),
+		}
+		return changedResult(map[string]any{"changed": true, "user": u}, map[string]any{"user": u}), nil
+	}
+	if _, err = execArgv(ctx, nil, argv); err != nil {
+		return nil, err
+	}
+
+	u, err = a.mustUser(name)
+	if err != nil {
+		return nil, err
+	}
+	return changedResult(map[string]any{"changed": true, "user": u}, map[string]any{"user": u}), nil
+}
+
+func (a *accounts) userDelete(ctx context.Context, req *Request) (*Result, error) {
+	name := req.Args.String("name")
+	u, err := a.user(name)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return changedResult(map[string]any{"changed": false}, nil), nil
+	}
+
+	argv := []string{"userdel"}
+	if req.Args.Bool("remove") {
+		argv = append(argv, "-r")
+	}
+	if req.Args.Bool("force") {
+		argv = append(argv, "-f")
+	}
+	argv = append(argv, name)
+	if !req.Test {
+		if _, err = execArgv(ctx, nil, argv); err != nil {
+			return nil, err
+		}
+	}
+	return changedResult(map[string]any{"changed": true}, map[string]any{"user": u}), nil
+}
+
+func (a *accounts) userChshell(ctx context.Context, req *Request) (*Result, error) {
+	name := req.Args.String("name")
+	shell := req.Args.String("shell")
+	u, err := a.mustUser(name)
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]any{"changed": false, "old": u.Shell, "new": shell}
+	if u.Shell == shell {
+		return changedResult(out, nil), nil
+	}
+
+	if !req.Test {
+		if _, err = execArgv(ctx, nil, []string{"usermod", "-s", shell, name}); err != nil {
+			return nil, err
+		}
+	}
+	out["changed"] = true
+	return changedResult(out, map[string]any{"old": u.Shell, "new": shell}), nil
+}
+
+func (a *accounts) userChgroups(ctx context.Context, req *Request) (*Result, error) {
+	name := req.Args.String("name")
+	u, err := a.mustUser(name)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]string, 0)
+	if req.Args.Bool("append") {
+		groups = append(groups, u.Groups...)
+	}
+	for _, group := range req.Args.List("groups") {
+		// the primary group is not a supplementary group
+		if group != u.Group && !containsString(groups, group) {
+			groups = append(groups, group)
+		}
+	}
+	sort.Strings(groups)
+
+	out := map[string]any{"changed": false, "old": u.Groups, "new": groups}
+	if strings.Join(groups, ",") == strings.Join(u.Groups, ",") {
+		return changedResult(out, nil), nil
+	}
+
+	if !req.Test {
+		if _, err = execArgv(ctx, nil, []string{"usermod", "-G", strings.Join(groups, ","), name}); err != nil {
+			return nil, err
+		}
+	}
+	out["changed"] = true
+	return changedResult(out, map[string]any{"old": u.Groups, "new": groups}), nil
+}
+
+func (a *accounts) groupFunctions() []*Function {
+	nameArg := &Arg{Name: "name", Type: String, Required: true, Doc: "the name of group"}
+	return []*Function{
+		{
+			Name: "group.add",
+			Doc:  "Create the group, nothing is changed if the group exists.",
+			Args: []*Arg{
+				nameArg,
+				{Name: "gid", Type: Integer, Keyword: true, Doc: "the gid of group"},
+				{Name: "system", Type: Boolean, Keyword: true, Doc: "create a system group"},
+			},
+			Returns: "a mapping with changed and the group info",
+			Handler: a.groupAdd,
+		},
+		{
+			Name:    "group.delete",
+			Doc:     "Delete the group, nothing is changed if the group does not exist.",
+			Args:    []*Arg{nameArg},
+			Returns: "a mapping with changed",
+			Handler: a.groupDelete,
+		},
+		{
+			Name:    "group.members",
+			Doc:     "Return the members of group.",
+			Args:    []*Arg{nameArg},
+			Returns: "the sorted list of members",
+			Handler: func(ctx context.Context, req *Request) (*Result, error) {
+				name := req.Args.String("name")
+				group, err := a.group(name)
+				if err != nil {
+					return nil, err
+				}
+				if group == nil {
+					return nil, fmt.Errorf("group %s not found", name)
+				}
+				return Return(group.Members), nil
+			},
+		},
+	}
+}
+
+func (a *accounts) groupAdd(ctx context.Context, req *Request) (*Result, error) {
+	name := req.Args.String("name")
+	group, err := a.group(name)
+	if err != nil {
+		return nil, err
+	}
+	if group != nil {
+		return changedResult(map[string]any{"changed": false, "group": group}, nil), nil
+	}
+
+	argv := []string{"groupadd"}
+	if req.Args.Has("gid") {
+		argv = append(argv, "-g", strconv.FormatInt(req.Args.Int("gid"), 10))
+	}
+	if req.Args.Bool("system") {
+		argv = append(argv, "-r")
+	}
+	argv = append(argv, name)
+	if req.Test {
+		group = &GroupInfo{Name: name, Gid: int(req.Args.Int("gid")), Members: []string{}}
+		return changedResult(map[string]any{"changed": true, "group": group}, map[string]any{"group": group}), nil
+	}
+	if _, err = execArgv(ctx, nil, argv); err != nil {
+		return nil, err
+	}
+
+	if group, err = a.group(name); err != nil {
+		return nil, err
+	}
+	return changedResult(map[string]any{"changed": true, "group": group}, map[string]any{"group": group}), nil
+}
+
+func (a *accounts) groupDelete(ctx context.Context, req *Request) (*Result, error) {
+	name := req.Args.String("name")
+	group, err := a.group(name)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		return changedResult(map[string]any{"changed": false}, nil), nil
+	}
+
+	if !req.Test {
+		if _, err = execArgv(ctx, nil, []string{"groupdel", name}); err != nil {
+			return nil, err
+		}
+	}
+	return changedResult(map[string]any{"changed": true}, map[string]any{"group": group}), nil
+}
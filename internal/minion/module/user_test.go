@@ -0,0 +1,188 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package module
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+func newAccountsRegistry(t *testing.T) (*Registry, string) {
+	bin, err := filepath.Abs("testdata/fakeuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	writeProcFile(t, root, "etc/passwd", "root:x:0:0:root:/root:/bin/bash\n")
+	writeProcFile(t, root, "etc/group", "root:x:0:\nwheel:x:10:root\ndocker:x:999:\n")
+
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_ETC", filepath.Join(root, "etc"))
+
+	a := newAccounts(root)
+	r := NewRegistry()
+	r.MustRegister(a.userFunctions()...)
+	r.MustRegister(a.groupFunctions()...)
+	r.MustRegister(a.sshFunctions()...)
+	return r, root
+}
+
+func TestUserFunctions(t *testing.T) {
+	r, root := newAccountsRegistry(t)
+
+	rsp, out := callJSON[any](r, "user.add", "alice", "shell=/bin/bash", "groups=wheel", "uid=1500")
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.True(t, rsp.Changes.Changed)
+	assert.Equal(t, map[string]any{
+		"name": "alice", "uid": float64(1500), "gid": float64(1500), "gecos": "",
+		"home": filepath.Join(root, "etc/home/alice"), "shell": "/bin/bash", "group": "alice", "groups": []any{"wheel"},
+	}, out.(map[string]any)["user"])
+
+	rsp, out = callJSON[any](r, "user.add", "alice", "shell=/bin/zsh")
+	assert.Equal(t, false, out.(map[string]any)["changed"])
+	assert.Nil(t, rsp.Changes)
+
+	_, out = callJSON[any](r, "user.list")
+	assert.Equal(t, []any{"alice", "root"}, out)
+
+	rsp, _ = callJSON[any](r, "user.chshell", "alice", "/bin/zsh")
+	assert.True(t, rsp.Changes.Changed)
+	rsp, _ = callJSON[any](r, "user.chshell", "alice", "/bin/zsh")
+	assert.Nil(t, rsp.Changes)
+	_, out = callJSON[any](r, "user.info", "alice")
+	assert.Equal(t, "/bin/zsh", out.(map[string]any)["shell"])
+
+	rsp, out = callJSON[any](r, "user.chgroups", "alice", "docker", "append=true")
+	assert.True(t, rsp.Changes.Changed)
+	assert.Equal(t, []any{"docker", "wheel"}, out.(map[string]any)["new"])
+	rsp, _ = callJSON[any](r, "user.chgroups", "alice", "wheel,docker")
+	assert.Nil(t, rsp.Changes)
+	rsp, _ = callJSON[any](r, "user.chgroups", "alice", "docker")
+	assert.True(t, rsp.Changes.Changed)
+	_, out = callJSON[any](r, "group.members", "wheel")
+	assert.Equal(t, []any{"root"}, out)
+
+	rsp, _ = callJSON[any](r, "user.delete", "alice")
+	assert.True(t, rsp.Changes.Changed)
+	rsp, _ = callJSON[any](r, "user.delete", "alice")
+	assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error)
+	assert.Nil(t, rsp.Changes)
+
+	rsp, _ = callJSON[any](r, "user.info", "alice")
+	assert.Equal(t, "user alice not found", rsp.Error)
+}
+
+func TestGroupFunctions(t *testing.T) {
+	r, _ := newAccountsRegistry(t)
+
+	rsp, out := callJSON[any](r, "group.add", "ops", "gid=2000")
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.True(t, rsp.Changes.Changed)
+	assert.Equal(t, map[string]any{"name": "ops", "gid": float64(2000), "members": []any{}}, out.(map[string]any)["group"])
+
+	rsp, _ = callJSON[any](r, "group.add", "ops")
+	assert.Nil(t, rsp.Changes)
+
+	rsp, _ = callJSON[any](r, "group.delete", "ops")
+	assert.True(t, rsp.Changes.Changed)
+	rsp, _ = callJSON[any](r, "group.delete", "ops")
+	assert.Nil(t, rsp.Changes)
+
+	rsp, _ = callJSON[any](r, "group.members", "ops")
+	assert.Equal(t, "group ops not found", rsp.Error)
+}
+
+func TestSSHFunctions(t *testing.T) {
+	r, root := newAccountsRegistry(t)
+	writeProcFile(t, root, "etc/passwd", "root:x:0:0:root:"+filepath.Join(root, "root")+":/bin/bash\n")
+	filename := filepath.Join(root, "root", DefaultAuthorizedKeys)
+
+	key := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFake admin@example"
+	rsp, out := callJSON[any](r, "ssh.set_auth_key", "root", key)
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) {
+		return
+	}
+	assert.Equal(t, map[string]any{"changed": true, "state": "new", "file": filename}, out)
+	stat, err := os.Stat(filename)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	}
+
+	rsp, out = callJSON[any](r, "ssh.set_auth_key", "root", key)
+	assert.Equal(t, "unchanged", out.(map[string]any)["state"])
+	assert.Nil(t, rsp.Changes)
+
+	_, out = callJSON[any](r, "ssh.set_auth_key", "root", "AAAAC3NzaC1lZDI1NTE5AAAAIFake", "comment=ops", "options=no-pty")
+	assert.Equal(t, "replaced", out.(map[string]any)["state"])
+	_, _ = callJSON[any](r, "ssh.set_auth_key", "root", "ssh-rsa AAAAB3NzaC1yc2EFake")
+	data, _ := os.ReadFile(filename)
+	assert.Equal(t, "no-pty ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFake ops\nssh-rsa AAAAB3NzaC1yc2EFake\n", string(data))
+
+	rsp, _ = callJSON[any](r, "ssh.rm_auth_key", "root", "AAAAC3NzaC1lZDI1NTE5AAAAIFake")
+	assert.True(t, rsp.Changes.Changed)
+	rsp, _ = callJSON[any](r, "ssh.rm_auth_key", "root", "AAAAC3NzaC1lZDI1NTE5AAAAIFake")
+	assert.Nil(t, rsp.Changes)
+	data, _ = os.ReadFile(filename)
+	assert.Equal(t, "ssh-rsa AAAAB3NzaC1yc2EFake\n", string(data))
+
+	// the symlinks in the path of authorized_keys are refused
+	target := filepath.Join(root, "shadow")
+	writeProcFile(t, root, "shadow", "secret\n")
+	_ = os.Remove(filename)
+	_ = os.Symlink(target, filename)
+	rsp, _ = callJSON[any](r, "ssh.set_auth_key", "root", key)
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Contains(t, rsp.Error, "is a symlink")
+
+	ssh := filepath.Dir(filename)
+	_ = os.RemoveAll(ssh)
+	_ = os.Symlink(root, ssh)
+	rsp, _ = callJSON[any](r, "ssh.set_auth_key", "root", key, "config=.ssh/shadow")
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Contains(t, rsp.Error, "is a symlink")
+	data, _ = os.ReadFile(target)
+	assert.Equal(t, "secret\n", string(data))
+}
+
+func TestParseAuthKey(t *testing.T) {
+	key, err := ParseAuthKey(`from="10.0.0.1,10.0.0.2",command="echo hi there" ssh-ed25519 AAAA user@host`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &AuthKey{
+			Options: `from="10.0.0.1,10.0.0.2",command="echo hi there"`,
+			Enc:     "ssh-ed25519",
+			Key:     "AAAA",
+			Comment: "user@host",
+		}, key)
+	}
+
+	_, err = ParseAuthKey("not a key")
+	assert.Error(t, err)
+}
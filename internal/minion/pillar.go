@@ -0,0 +1,60 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package minion
+
+import (
+	"context"
+
+	"github.com/vine-io/maco/internal/minion/module"
+	"github.com/vine-io/maco/pkg/selector"
+)
+
+// pillarFunctions returns the functions of pillar module.
+// The pillar data is compiled by maco-master for current minion and carried by each call.
+func (m *Minion) pillarFunctions() []*module.Function {
+	return []*module.Function{
+		{
+			Name:    "pillar.items",
+			Doc:     "Return all of the pillar data of minion.",
+			Returns: "the pillar document",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				return module.Return(req.Pillar), nil
+			},
+		},
+		{
+			Name: "pillar.get",
+			Doc:  "Return the value of pillar key, nested keys are separated by ':'.",
+			Args: []*module.Arg{
+				{Name: "key", Type: module.String, Required: true, Doc: "the pillar key, e.g. db:password"},
+				{Name: "default", Type: module.String, Doc: "the value returned when the key is missing"},
+			},
+			Returns: "the value of pillar key",
+			Handler: func(ctx context.Context, req *module.Request) (*module.Result, error) {
+				value, ok := selector.Lookup(req.Pillar, req.Args.String("key"), selector.DefaultDelimiter)
+				if !ok && req.Args.Has("default") {
+					value = req.Args.String("default")
+				}
+				return module.Return(value), nil
+			},
+		},
+	}
+}
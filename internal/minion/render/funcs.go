@@ -0,0 +1,482 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package render
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Funcs returns the helper functions of template, they follow the names and the argument
+// order of sprig, so the value is the last argument and can be piped, e.g.
+// {{ .Grains.os | lower }} or {{ .Pillar.servers | join "," }}.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		// defaults
+		"default":  defaultValue,
+		"empty":    empty,
+		"coalesce": coalesce,
+		"ternary":  ternary,
+		"required": required,
+		"fail":     func(msg string) (string, error) { return "", errors.New(msg) },
+
+		// strings
+		"upper":      strings.ToUpper,
+		"lower":      strings.ToLower,
+		"title":      title,
+		"trim":       strings.TrimSpace,
+		"trimAll":    func(cut, s string) string { return strings.Trim(s, cut) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(sub, s string) bool { return strings.Contains(s, sub) },
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"repeat":     func(n int, s string) string { return strings.Repeat(s, n) },
+		"quote":      quote,
+		"squote":     squote,
+		"indent":     indent,
+		"nindent":    func(n int, s string) string { return "\n" + indent(n, s) },
+		"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"toString":   toString,
+
+		// regexp
+		"regexMatch":      func(re, s string) (bool, error) { return regexp.MatchString(re, s) },
+		"regexFind":       regexFind,
+		"regexReplaceAll": regexReplaceAll,
+
+		// numbers
+		"int":   toInt,
+		"atoi":  func(s string) (int, error) { return strconv.Atoi(strings.TrimSpace(s)) },
+		"add":   func(a, b any) (int64, error) { return arith(a, b, func(x, y int64) int64 { return x + y }) },
+		"sub":   func(a, b any) (int64, error) { return arith(a, b, func(x, y int64) int64 { return x - y }) },
+		"mul":   func(a, b any) (int64, error) { return arith(a, b, func(x, y int64) int64 { return x * y }) },
+		"div":   divide,
+		"mod":   modulo,
+		"max":   func(a, b any) (int64, error) { return arith(a, b, maxInt) },
+		"min":   func(a, b any) (int64, error) { return arith(a, b, minInt) },
+		"until": until,
+
+		// lists and dicts
+		"list":  func(items ...any) []any { return items },
+		"first": first,
+		"last":  last,
+		"has":   has,
+		"uniq":  uniq,
+		"sortAlpha": func(list any) ([]string, error) {
+			out, err := strList(list)
+			sort.Strings(out)
+			return out, err
+		},
+		"dict":   dict,
+		"get":    func(d map[string]any, key string) any { return d[key] },
+		"hasKey": func(d map[string]any, key string) bool { _, ok := d[key]; return ok },
+		"keys":   keys,
+		"merge":  merge,
+
+		// encoding
+		"toJson":       toJSON,
+		"toPrettyJson": toPrettyJSON,
+		"fromJson":     fromJSON,
+		"toYaml":       toYAML,
+		"b64enc":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+		"b64dec":       b64dec,
+		"md5sum":       func(s string) string { sum := md5.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"sha1sum":      func(s string) string { sum := sha1.Sum([]byte(s)); return hex.EncodeToString(sum[:]) },
+		"sha256sum":    func(s string) string { sum := sha256.Sum256([]byte(s)); return hex.EncodeToString(sum[:]) },
+
+		// paths, environment and time
+		"base":  filepath.Base,
+		"dir":   filepath.Dir,
+		"ext":   filepath.Ext,
+		"clean": filepath.Clean,
+		"env":   os.Getenv,
+		"now":   time.Now,
+		"date":  func(layout string, t time.Time) string { return t.Format(layout) },
+	}
+}
+
+// empty reports whether the value is the zero value of its type
+func empty(v any) bool {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return true
+	}
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	default:
+		return rv.IsZero()
+	}
+}
+
+func defaultValue(def any, v ...any) any {
+	if len(v) == 0 || empty(v[0]) {
+		return def
+	}
+	return v[0]
+}
+
+func coalesce(values ...any) any {
+	for _, v := range values {
+		if !empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+func ternary(yes, no any, cond bool) any {
+	if cond {
+		return yes
+	}
+	return no
+}
+
+func required(msg string, v any) (any, error) {
+	if empty(v) {
+		return nil, errors.New(msg)
+	}
+	return v, nil
+}
+
+func title(s string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+func quote(values ...any) string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, strconv.Quote(toString(v)))
+	}
+	return strings.Join(out, " ")
+}
+
+func squote(values ...any) string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, "'"+toString(v)+"'")
+	}
+	return strings.Join(out, " ")
+}
+
+func indent(n int, s string) string {
+	pad := strings.Repeat(" ", n)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+func join(sep string, list any) (string, error) {
+	items, err := strList(list)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(items, sep), nil
+}
+
+// toString formats the value, nil is the empty string
+func toString(v any) string {
+	switch tv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return tv
+	case []byte:
+		return string(tv)
+	case error:
+		return tv.Error()
+	case fmt.Stringer:
+		return tv.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func regexFind(re, s string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.FindString(s), nil
+}
+
+func regexReplaceAll(re, s, repl string) (string, error) {
+	r, err := regexp.Compile(re)
+	if err != nil {
+		return "", err
+	}
+	return r.ReplaceAllString(s, repl), nil
+}
+
+// toInt converts the number or numeric string to int64
+func toInt(v any) (int64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%v overflows int64", v)
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return int64(rv.Float()), nil
+	case reflect.String:
+		return strconv.ParseInt(strings.TrimSpace(rv.String()), 10, 64)
+	case reflect.Bool:
+		if rv.Bool() {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("can not convert %T to int", v)
+}
+
+func arith(a, b any, fn func(x, y int64) int64) (int64, error) {
+	x, err := toInt(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	return fn(x, y), nil
+}
+
+func divide(a, b any) (int64, error) {
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return arith(a, y, func(x, y int64) int64 { return x / y })
+}
+
+func modulo(a, b any) (int64, error) {
+	y, err := toInt(b)
+	if err != nil {
+		return 0, err
+	}
+	if y == 0 {
+		return 0, errors.New("division by zero")
+	}
+	return arith(a, y, func(x, y int64) int64 { return x % y })
+}
+
+func maxInt(x, y int64) int64 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func minInt(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// until returns the list of 0 to n-1, e.g. {{ range until 3 }}
+func until(n any) ([]int64, error) {
+	count, err := toInt(n)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]int64, 0, count)
+	for i := int64(0); i < count; i++ {
+		out = append(out, i)
+	}
+	return out, nil
+}
+
+// anyList converts the slice or array to []any
+func anyList(list any) ([]any, error) {
+	rv := reflect.ValueOf(list)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		out := make([]any, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			out = append(out, rv.Index(i).Interface())
+		}
+		return out, nil
+	case reflect.Invalid:
+		return []any{}, nil
+	}
+	return nil, fmt.Errorf("%T is not a list", list)
+}
+
+func strList(list any) ([]string, error) {
+	items, err := anyList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		out = append(out, toString(item))
+	}
+	return out, nil
+}
+
+func first(list any) (any, error) {
+	items, err := anyList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+func last(list any) (any, error) {
+	items, err := anyList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+func has(needle, list any) (bool, error) {
+	items, err := anyList(list)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if reflect.DeepEqual(item, needle) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func uniq(list any) ([]any, error) {
+	items, err := anyList(list)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, 0, len(items))
+	for _, item := range items {
+		found := false
+		for _, exists := range out {
+			if reflect.DeepEqual(item, exists) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, item)
+		}
+	}
+	return out, nil
+}
+
+// dict creates the map from the pairs of key and value, e.g. {{ dict "a" 1 "b" 2 }}
+func dict(pairs ...any) (map[string]any, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict requires the pairs of key and value")
+	}
+	out := make(map[string]any, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		out[toString(pairs[i])] = pairs[i+1]
+	}
+	return out, nil
+}
+
+func keys(dicts ...map[string]any) []string {
+	out := make([]string, 0)
+	for _, d := range dicts {
+		for key := range d {
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// merge returns the new map which merges the maps, the former keys take precedence
+func merge(dst map[string]any, srcs ...map[string]any) map[string]any {
+	out := make(map[string]any, len(dst))
+	for key, value := range dst {
+		out[key] = value
+	}
+	for _, src := range srcs {
+		for key, value := range src {
+			if _, ok := out[key]; !ok {
+				out[key] = value
+			}
+		}
+	}
+	return out
+}
+
+func toJSON(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func toPrettyJSON(v any) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	return string(data), err
+}
+
+func fromJSON(s string) (any, error) {
+	var out any
+	err := json.Unmarshal([]byte(s), &out)
+	return out, err
+}
+
+func toYAML(v any) (string, error) {
+	data, err := yaml.Marshal(v)
+	return strings.TrimSuffix(string(data), "\n"), err
+}
+
+func b64dec(s string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	return string(data), err
+}
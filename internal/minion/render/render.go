@@ -0,0 +1,139 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package render renders the templates of managed files on the minion. The templates are
+// Go text/template with the sprig style helper functions, the grains and pillar of minion
+// are passed as the context, so the per-host values never leave the minion.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/vine-io/maco/pkg/selector"
+)
+
+// Go is the name of Go text/template renderer
+const Go = "go"
+
+// Context is the data of template, e.g. {{ .Grains.os }} or {{ .Pillar.db.password }}
+type Context struct {
+	// ID the state id which renders the template
+	ID string
+	// SLS the state file which declares the state
+	SLS string
+	// Grains the grains of minion
+	Grains map[string]any
+	// Pillar the pillar data of minion
+	Pillar map[string]any
+	// Args the arguments of state
+	Args map[string]any
+}
+
+// Error is the error of template rendering, it reports the template file and line
+type Error struct {
+	File string
+	// Line the line of template, 0 means unknown
+	Line int
+	Err  string
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("render %s line %d: %s", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("render %s: %s", e.File, e.Err)
+}
+
+// Render renders the template text, name is the template file which is used in errors.
+// The missing key of map is an error, the grains and pillar functions look up the optional
+// keys with default values, e.g. {{ pillar "nginx:port" 80 }}.
+func Render(name, text string, ctx *Context) (string, error) {
+	if ctx == nil {
+		ctx = &Context{}
+	}
+	funcs := Funcs()
+	funcs["grains"] = lookupFunc(ctx.Grains)
+	funcs["pillar"] = lookupFunc(ctx.Pillar)
+
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", newError(name, err)
+	}
+	buf := bytes.NewBuffer(nil)
+	if err = tmpl.Execute(buf, ctx); err != nil {
+		return "", newError(name, err)
+	}
+	return buf.String(), nil
+}
+
+// Supported reports whether the renderer is supported, the empty renderer disables rendering
+func Supported(renderer string) bool {
+	return renderer == "" || renderer == Go
+}
+
+// lookupFunc returns the function which looks up the nested key separated by ':',
+// e.g. {{ pillar "db:password" "secret" }}. The optional argument is the default value.
+func lookupFunc(data map[string]any) func(key string, def ...any) (any, error) {
+	return func(key string, def ...any) (any, error) {
+		if len(def) > 1 {
+			return nil, errors.New("too many default values")
+		}
+		value, ok := selector.Lookup(data, key, selector.DefaultDelimiter)
+		if !ok {
+			if len(def) > 0 {
+				return def[0], nil
+			}
+			return nil, fmt.Errorf("key %s not found", key)
+		}
+		return value, nil
+	}
+}
+
+// newError converts the error of text/template, e.g.
+// 'template: motd:3:5: executing "motd" at <.Pillar.x>: map has no entry for key "x"'
+func newError(name string, err error) error {
+	out := &Error{File: name, Err: err.Error()}
+	var execErr template.ExecError
+	if errors.As(err, &execErr) {
+		err = execErr.Err
+		out.Err = err.Error()
+	}
+	text := strings.TrimPrefix(out.Err, "template: ")
+	if !strings.HasPrefix(text, name+":") {
+		return out
+	}
+	text = strings.TrimPrefix(text, name+":")
+	pos, msg, ok := strings.Cut(text, " ")
+	if !ok {
+		return out
+	}
+	line, _, _ := strings.Cut(strings.TrimSuffix(pos, ":"), ":")
+	if n, cErr := strconv.Atoi(line); cErr == nil {
+		out.Line = n
+		out.Err = strings.TrimPrefix(msg, fmt.Sprintf("executing %q ", name))
+	}
+	return out
+}
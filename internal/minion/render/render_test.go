@@ -0,0 +1,122 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package render
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	ctx := &Context{
+		ID:     "/etc/nginx/nginx.conf",
+		Grains: map[string]any{"os": "Ubuntu", "ipv4": []any{"10.0.0.5", "127.0.0.1"}},
+		Pillar: map[string]any{"nginx": map[string]any{"workers": 4, "servers": []any{"a", "b", "a"}}},
+		Args:   map[string]any{"context": map[string]any{"port": int64(8080)}},
+	}
+	text := `# {{ .ID }} on {{ .Grains.os | lower }}
+worker_processes {{ pillar "nginx:workers" }};
+listen {{ first .Grains.ipv4 }}:{{ add .Args.context.port 1 }};
+upstream {{ pillar "nginx:servers" | uniq | join "," | quote }};
+keepalive {{ pillar "nginx:keepalive" 65 }};
+{{- range $i := until 2 }}
+slot{{ $i }}{{ end }}
+{{ dict "a" 1 | toJson }} {{ "abc" | sha256sum | trunc }}`
+
+	_, err := Render("nginx.conf", text, ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, `render nginx.conf line 8: function "trunc" not defined`, err.Error())
+	}
+
+	text = text[:len(text)-len(` | trunc }}`)] + ` | len }}`
+	out, err := Render("nginx.conf", text, ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `# /etc/nginx/nginx.conf on ubuntu
+worker_processes 4;
+listen 10.0.0.5:8081;
+upstream "a,b";
+keepalive 65;
+slot0
+slot1
+{"a":1} 64`, out)
+}
+
+func TestRenderError(t *testing.T) {
+	ctx := &Context{Pillar: map[string]any{"db": map[string]any{}}}
+
+	_, err := Render("/srv/salt/db.conf", "host={{ .Pillar.db.host }}", ctx)
+	if assert.Error(t, err) {
+		assert.Equal(t, `render /srv/salt/db.conf line 1: at <.Pillar.db.host>: map has no entry for key "host"`, err.Error())
+	}
+
+	_, err = Render("db.conf", "a\nb\n{{ pillar \"db:password\" }}", ctx)
+	if assert.Error(t, err) {
+		rErr, ok := err.(*Error)
+		if assert.True(t, ok) {
+			assert.Equal(t, "db.conf", rErr.File)
+			assert.Equal(t, 3, rErr.Line)
+		}
+	}
+
+	_, err = Render("db.conf", "{{ if }}", ctx)
+	assert.Error(t, err)
+
+	_, err = Render("db.conf", `{{ required "password is required" .Pillar.db.password }}`, &Context{
+		Pillar: map[string]any{"db": map[string]any{"password": ""}},
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "password is required")
+	}
+}
+
+func TestFuncs(t *testing.T) {
+	cases := []struct {
+		text string
+		want string
+	}{
+		{`{{ "" | default "x" }}`, "x"},
+		{`{{ "y" | default "x" }}`, "y"},
+		{`{{ coalesce "" 0 "z" }}`, "z"},
+		{`{{ ternary "on" "off" true }}`, "on"},
+		{`{{ "hello world" | title }}`, "Hello World"},
+		{`{{ "a-b-c" | replace "-" "_" }}`, "a_b_c"},
+		{`{{ "line1\nline2" | indent 2 }}`, "  line1\n  line2"},
+		{`{{ "a,b" | split "," | last }}`, "b"},
+		{`{{ regexReplaceAll "[0-9]+" "v12" "N" }}`, "vN"},
+		{`{{ div 7 2 }} {{ mod 7 2 }} {{ max 1 3 }}`, "3 1 3"},
+		{`{{ "aGk=" | b64dec }}`, "hi"},
+		{`{{ list "b" "a" | sortAlpha | join "" }}`, "ab"},
+		{`{{ dict "a" 1 "b" 2 | keys | join "," }}`, "a,b"},
+		{`{{ has "a" (list "a") }}`, "true"},
+		{`{{ dict "a" (list 1 2) | toYaml }}`, "a:\n    - 1\n    - 2"},
+		{`{{ "/etc/a.conf" | base }} {{ "/etc/a.conf" | ext }}`, "a.conf .conf"},
+	}
+	for _, c := range cases {
+		out, err := Render("case", c.text, nil)
+		if assert.NoError(t, err, c.text) {
+			assert.Equal(t, c.want, out, c.text)
+		}
+	}
+}
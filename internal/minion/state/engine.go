@@ -0,0 +1,304 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/minion/module"
+)
+
+// Ret is the return of state function
+type Ret struct {
+	Result  bool
+	Comment string
+	// Changes the structured diff of the state, empty means nothing changed
+	Changes map[string]any
+}
+
+// Fail returns the failed Ret
+func Fail(format string, args ...any) *Ret {
+	return &Ret{Comment: fmt.Sprintf(format, args...)}
+}
+
+// Env is the environment of state run
+type Env struct {
+	// Registry the execution functions which are used by the state functions
+	Registry *module.Registry
+	// Request the request of state run, its pillar and grains are passed to the execution functions
+	Request *module.Request
+}
+
+// Exec calls the execution function, it only predicts the changes in test mode
+func (e *Env) Exec(ctx context.Context, function string, args map[string]any, varargs ...string) (*module.Result, error) {
+	return e.Registry.Exec(ctx, e.Request, function, args, varargs...)
+}
+
+// Probe calls the execution function even in test mode, it is used by the checks which
+// do not modify the minion, e.g. unless and onlyif of cmd.run
+func (e *Env) Probe(ctx context.Context, function string, args map[string]any, varargs ...string) (*module.Result, error) {
+	req := *e.Request
+	req.Test = false
+	return e.Registry.Exec(ctx, &req, function, args, varargs...)
+}
+
+// Test reports whether the states run in test mode
+func (e *Env) Test() bool {
+	return e.Request != nil && e.Request.Test
+}
+
+// Updated returns the comment of changed state, e.g. "File /etc/motd updated" or
+// "File /etc/motd would be updated" in test mode
+func (e *Env) Updated(format string, args ...any) string {
+	text := fmt.Sprintf(format, args...)
+	if e.Test() {
+		return text + " would be updated"
+	}
+	return text + " updated"
+}
+
+// Apply applies the state with the parsed arguments
+type Apply func(ctx context.Context, env *Env, st *State, args module.Args) *Ret
+
+// Func describes a state function
+type Func struct {
+	// Name the name of state function, e.g. file.managed
+	Name string
+	Doc  string
+	// Args the argument schema, the name argument is always passed
+	Args []*module.Arg
+
+	Apply Apply
+	// Watch reacts to the changes of watched states after the state is applied successfully,
+	// the state without Watch treats watch as require
+	Watch Apply
+}
+
+// Engine applies the states
+type Engine struct {
+	registry *module.Registry
+
+	mu    sync.RWMutex
+	funcs map[string]*Func
+}
+
+// NewEngine creates Engine with the builtin state functions
+func NewEngine(r *module.Registry) *Engine {
+	e := &Engine{registry: r, funcs: map[string]*Func{}}
+	for _, fn := range builtinFuncs() {
+		e.Register(fn)
+	}
+	return e
+}
+
+// Register adds or replaces the state function
+func (e *Engine) Register(fn *Func) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.funcs[fn.Name] = fn
+}
+
+// Get returns the state function by name
+func (e *Engine) Get(name string) (*Func, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	fn, ok := e.funcs[name]
+	return fn, ok
+}
+
+// Funcs returns the names of all state functions
+func (e *Engine) Funcs() []string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	names := make([]string, 0, len(e.funcs))
+	for name := range e.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Order sorts the states by the order of declaration, the requisites are moved before the
+// states which refer to them.
+func Order(states []*State) ([]*State, error) {
+	out := make([]*State, 0, len(states))
+	// 0: not visited, 1: visiting, 2: visited
+	marks := make(map[*State]int, len(states))
+	var visit func(st *State, path []string) error
+	visit = func(st *State, path []string) error {
+		switch marks[st] {
+		case 1:
+			return fmt.Errorf("recursive requisite found: %s", strings.Join(append(path, st.String()), " -> "))
+		case 2:
+			return nil
+		}
+		marks[st] = 1
+		for _, req := range st.Requisites() {
+			for _, target := range states {
+				if target != st && target.Match(req) {
+					if err := visit(target, append(path, st.String())); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		marks[st] = 2
+		out = append(out, st)
+		return nil
+	}
+
+	for _, st := range states {
+		if err := visit(st, nil); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Run applies the states in order, it returns error if the states can not be ordered.
+func (e *Engine) Run(ctx context.Context, req *module.Request, states []*State) ([]*types.StateResult, error) {
+	ordered, err := Order(states)
+	if err != nil {
+		return nil, err
+	}
+
+	env := &Env{Registry: e.registry, Request: req}
+	done := make(map[*State]*Ret, len(ordered))
+	results := make([]*types.StateResult, 0, len(ordered))
+	for i, st := range ordered {
+		start := time.Now()
+		var ret *Ret
+		if ctx.Err() != nil {
+			ret = Fail("State was not run: %v", ctx.Err())
+		} else {
+			ret = e.apply(ctx, env, st, states, done)
+		}
+		done[st] = ret
+
+		result := &types.StateResult{
+			Id:       st.ID,
+			Function: st.Function,
+			Name:     st.Name,
+			Sls:      st.SLS,
+			Result:   ret.Result,
+			Comment:  ret.Comment,
+			Duration: time.Since(start).Milliseconds(),
+			Order:    int32(i + 1),
+		}
+		if len(ret.Changes) > 0 {
+			result.Changes, _ = json.Marshal(ret.Changes)
+			result.Pending = req.Test && ret.Result
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// apply checks the requisites of state and applies it
+func (e *Engine) apply(ctx context.Context, env *Env, st *State, states []*State, done map[*State]*Ret) *Ret {
+	fn, ok := e.Get(st.Function)
+	if !ok {
+		return Fail("State function %s is not available", st.Function)
+	}
+
+	// the matched states of each requisite, they are applied already
+	lookup := func(reqs []Requisite) ([]*Ret, *Ret) {
+		rets := make([]*Ret, 0)
+		failed := make([]string, 0)
+		for _, req := range reqs {
+			found := false
+			for _, target := range states {
+				if target == st || !target.Match(req) {
+					continue
+				}
+				found = true
+				ret := done[target]
+				if !ret.Result {
+					failed = append(failed, req.String())
+				}
+				rets = append(rets, ret)
+			}
+			if !found {
+				return nil, Fail("Requisite %s of %s is not found", req, st)
+			}
+		}
+		if len(failed) > 0 {
+			return nil, Fail("One or more requisite failed: %s", strings.Join(failed, ", "))
+		}
+		return rets, nil
+	}
+
+	if _, ret := lookup(st.Require); ret != nil {
+		return ret
+	}
+	watched, ret := lookup(st.Watch)
+	if ret != nil {
+		return ret
+	}
+	onchanges, ret := lookup(st.Onchanges)
+	if ret != nil {
+		return ret
+	}
+	if len(st.Onchanges) > 0 && !anyChanged(onchanges) {
+		return &Ret{Result: true, Comment: "State was not run because none of the onchanges reqs changed"}
+	}
+
+	values := make(map[string]any, len(st.Args)+1)
+	for key, value := range st.Args {
+		values[key] = value
+	}
+	values["name"] = st.Name
+	args, err := module.ParseArgsMap(&module.Function{Name: st.Function, Args: fn.Args}, values)
+	if err != nil {
+		return Fail("%v", err)
+	}
+
+	ret = fn.Apply(ctx, env, st, args)
+	if ret.Result && fn.Watch != nil && anyChanged(watched) {
+		wret := fn.Watch(ctx, env, st, args)
+		if ret.Changes == nil {
+			ret.Changes = map[string]any{}
+		}
+		for key, value := range wret.Changes {
+			ret.Changes[key] = value
+		}
+		ret.Result = wret.Result
+		ret.Comment = strings.TrimSpace(ret.Comment + "\n" + wret.Comment)
+	}
+	return ret
+}
+
+func anyChanged(rets []*Ret) bool {
+	for _, ret := range rets {
+		if len(ret.Changes) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/minion/module"
+)
+
+// Summary is the return of a state in state run
+type Summary struct {
+	ID       string `json:"id"`
+	Function string `json:"function"`
+	Name     string `json:"name"`
+	SLS      string `json:"sls"`
+	// Result is null when the state would change the minion in test mode
+	Result   *bool           `json:"result"`
+	Comment  string          `json:"comment"`
+	Duration int64           `json:"duration"`
+	Changes  json.RawMessage `json:"changes,omitempty"`
+	Order    int32           `json:"order"`
+}
+
+// Load parses the state files sent by maco-master, the same function of a state id
+// can not be declared twice.
+func Load(sources []*types.StateSource) ([]*State, error) {
+	out := make([]*State, 0)
+	declared := map[string]*State{}
+	for _, source := range sources {
+		states, err := Parse(source.Name, source.Data)
+		if err != nil {
+			return nil, err
+		}
+		for _, st := range states {
+			key := st.ID + "|" + st.Function
+			if exists, ok := declared[key]; ok {
+				return nil, fmt.Errorf("state %s is declared in both %s and %s", st, exists.SLS, st.SLS)
+			}
+			declared[key] = st
+			out = append(out, st)
+		}
+	}
+	return out, nil
+}
+
+// Functions returns the functions of state module
+func Functions(r *module.Registry) []*module.Function {
+	e := NewEngine(r)
+	return []*module.Function{
+		{
+			Name:    "state.sls",
+			Doc:     "Apply the state files, e.g. state.sls nginx,users. The state files are compiled by maco-master.",
+			Varargs: "names",
+			Returns: "the list of state results by the order of execution",
+			Handler: e.sls,
+		},
+		{
+			Name:    "state.highstate",
+			Doc:     "Apply the state files which are matched by the top file of maco-master.",
+			Returns: "the list of state results by the order of execution",
+			Handler: e.sls,
+		},
+		{
+			Name:    "state.apply",
+			Doc:     "Apply the given state files, or the highstate if no state file is given.",
+			Varargs: "names",
+			Returns: "the list of state results by the order of execution",
+			Handler: e.sls,
+		},
+		{
+			Name:    "state.show_highstate",
+			Doc:     "Return the parsed states of the highstate without applying them.",
+			Returns: "the list of states by the order of execution",
+			Handler: e.showSls,
+		},
+		{
+			Name:    "state.show_sls",
+			Doc:     "Return the parsed states of the state files without applying them.",
+			Varargs: "names",
+			Returns: "the list of states by the order of execution",
+			Handler: e.showSls,
+		},
+	}
+}
+
+// load returns the states of request
+func (e *Engine) load(req *module.Request) ([]*State, error) {
+	if req.Call == nil || len(req.Call.States) == 0 {
+		return nil, errors.New("no state files are found")
+	}
+	return Load(req.Call.States)
+}
+
+func (e *Engine) sls(ctx context.Context, req *module.Request) (*module.Result, error) {
+	states, err := e.load(req)
+	if err != nil {
+		return nil, err
+	}
+	return e.run(ctx, req, states)
+}
+
+// run applies the states and converts the results to module.Result, the error reports the failed states
+func (e *Engine) run(ctx context.Context, req *module.Request, states []*State) (*module.Result, error) {
+	results, err := e.Run(ctx, req, states)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]*Summary, 0, len(results))
+	result := &module.Result{States: results}
+	failed := 0
+	for _, item := range results {
+		var ok *bool
+		if !item.Pending {
+			ok = &item.Result
+		}
+		summaries = append(summaries, &Summary{
+			ID:       item.Id,
+			Function: item.Function,
+			Name:     item.Name,
+			SLS:      item.Sls,
+			Result:   ok,
+			Comment:  item.Comment,
+			Duration: item.Duration,
+			Changes:  item.Changes,
+			Order:    item.Order,
+		})
+		if len(item.Changes) > 0 {
+			result.Changed = true
+		}
+		if !item.Result {
+			failed += 1
+		}
+	}
+	result.Return = summaries
+
+	if failed > 0 {
+		result.RetCode = 2
+		return result, fmt.Errorf("%d of %d states failed", failed, len(results))
+	}
+	return result, nil
+}
+
+func (e *Engine) showSls(ctx context.Context, req *module.Request) (*module.Result, error) {
+	states, err := e.load(req)
+	if err != nil {
+		return nil, err
+	}
+	ordered, err := Order(states)
+	if err != nil {
+		return nil, err
+	}
+	return module.Return(ordered), nil
+}
@@ -0,0 +1,265 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package state implements the state engine of maco-minion.
+//
+// A state file is a yaml mapping of state id to the state functions and their arguments,
+// the arguments are either a list of single key mappings or a mapping:
+//
+//	nginx:
+//	  pkg.installed: []
+//	  service.running:
+//	    - enable: true
+//	    - watch:
+//	      - file: /etc/nginx/nginx.conf
+//
+//	/etc/nginx/nginx.conf:
+//	  file.managed:
+//	    - source: /srv/nginx.conf
+//	    - require:
+//	      - pkg: nginx
+//
+// The `name` argument defaults to the state id. The states are applied by the order of
+// declaration, except that the requisites are applied before the states which refer to them:
+//
+//   - require: the state is applied only if the required states succeed
+//   - watch: the same as require, the state reacts to the changes of watched states, e.g. restarts the service
+//   - onchanges: the state is applied only if any of the states made changes
+//
+// A requisite is `module: id-or-name`, e.g. `pkg: nginx`, or the bare state id.
+package state
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Requisite types
+const (
+	Require   = "require"
+	Watch     = "watch"
+	Onchanges = "onchanges"
+)
+
+// Requisite refers to other states
+type Requisite struct {
+	// Module the module of state, e.g. pkg. Empty means any module
+	Module string `json:"module,omitempty"`
+	// Target the id or name of state
+	Target string `json:"target"`
+}
+
+func (r Requisite) String() string {
+	if r.Module == "" {
+		return r.Target
+	}
+	return r.Module + ": " + r.Target
+}
+
+// State is a state declared in the state file
+type State struct {
+	ID string `json:"id"`
+	// SLS the name of state file
+	SLS string `json:"sls"`
+	// Function the state function, e.g. file.managed
+	Function string `json:"function"`
+	// Name the name argument, it defaults to ID
+	Name string `json:"name"`
+	// Args the arguments of state function except name and requisites
+	Args map[string]any `json:"args"`
+
+	Require   []Requisite `json:"require,omitempty"`
+	Watch     []Requisite `json:"watch,omitempty"`
+	Onchanges []Requisite `json:"onchanges,omitempty"`
+
+	// Line the line of state in the state file
+	Line int `json:"line"`
+}
+
+// Module returns the module of state function
+func (s *State) Module() string {
+	module, _, _ := strings.Cut(s.Function, ".")
+	return module
+}
+
+// String returns the readable identity of state
+func (s *State) String() string {
+	return fmt.Sprintf("%s (%s)", s.ID, s.Function)
+}
+
+// Requisites returns all of the requisites
+func (s *State) Requisites() []Requisite {
+	out := make([]Requisite, 0, len(s.Require)+len(s.Watch)+len(s.Onchanges))
+	out = append(out, s.Require...)
+	out = append(out, s.Watch...)
+	out = append(out, s.Onchanges...)
+	return out
+}
+
+// Match checks whether the requisite refers to the state
+func (s *State) Match(req Requisite) bool {
+	if req.Module == "" {
+		return s.ID == req.Target
+	}
+	return s.Module() == req.Module && (s.ID == req.Target || s.Name == req.Target)
+}
+
+// Parse parses the content of state file
+func Parse(sls string, data []byte) ([]*State, error) {
+	states := make([]*State, 0)
+	if len(bytes.TrimSpace(data)) == 0 {
+		return states, nil
+	}
+
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("sls %s: %w", sls, err)
+	}
+	if len(root.Content) == 0 {
+		return states, nil
+	}
+	doc := root.Content[0]
+	if doc.Kind != yamlv3.MappingNode {
+		return nil, fmt.Errorf("sls %s line %d: state file must be a mapping of state ids", sls, doc.Line)
+	}
+
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		id, body := doc.Content[i], doc.Content[i+1]
+		// the included files are resolved by maco-master
+		if id.Value == "include" {
+			continue
+		}
+		if body.Kind != yamlv3.MappingNode {
+			return nil, fmt.Errorf("sls %s line %d: state '%s' must be a mapping of functions", sls, body.Line, id.Value)
+		}
+
+		for j := 0; j+1 < len(body.Content); j += 2 {
+			fn, args := body.Content[j], body.Content[j+1]
+			st, err := parseState(sls, id.Value, fn, args)
+			if err != nil {
+				return nil, err
+			}
+			states = append(states, st)
+		}
+	}
+
+	return states, nil
+}
+
+func parseState(sls, id string, fn, args *yamlv3.Node) (*State, error) {
+	module, function, ok := strings.Cut(fn.Value, ".")
+	if !ok || module == "" || function == "" {
+		return nil, fmt.Errorf("sls %s line %d: invalid state function '%s', must be module.function", sls, fn.Line, fn.Value)
+	}
+	st := &State{
+		ID:       id,
+		SLS:      sls,
+		Function: fn.Value,
+		Name:     id,
+		Args:     map[string]any{},
+		Line:     fn.Line,
+	}
+
+	// key and value pairs of arguments
+	pairs := make([]*yamlv3.Node, 0)
+	switch args.Kind {
+	case yamlv3.MappingNode:
+		pairs = args.Content
+	case yamlv3.SequenceNode:
+		for _, item := range args.Content {
+			if item.Kind != yamlv3.MappingNode || len(item.Content) != 2 {
+				return nil, fmt.Errorf("sls %s line %d: argument of %s must be a single key mapping", sls, item.Line, st)
+			}
+			pairs = append(pairs, item.Content...)
+		}
+	case yamlv3.ScalarNode:
+		if args.Tag != "!!null" {
+			return nil, fmt.Errorf("sls %s line %d: arguments of %s must be a list or mapping", sls, args.Line, st)
+		}
+	default:
+		return nil, fmt.Errorf("sls %s line %d: arguments of %s must be a list or mapping", sls, args.Line, st)
+	}
+
+	for k := 0; k+1 < len(pairs); k += 2 {
+		key, value := pairs[k], pairs[k+1]
+		switch key.Value {
+		case Require, Watch, Onchanges:
+			reqs, err := parseRequisites(value)
+			if err != nil {
+				return nil, fmt.Errorf("sls %s line %d: %s of %s: %w", sls, value.Line, key.Value, st, err)
+			}
+			switch key.Value {
+			case Require:
+				st.Require = append(st.Require, reqs...)
+			case Watch:
+				st.Watch = append(st.Watch, reqs...)
+			default:
+				st.Onchanges = append(st.Onchanges, reqs...)
+			}
+		default:
+			var v any
+			if err := value.Decode(&v); err != nil {
+				return nil, fmt.Errorf("sls %s line %d: argument %s of %s: %w", sls, value.Line, key.Value, st, err)
+			}
+			if key.Value == "name" {
+				name, ok := v.(string)
+				if !ok || name == "" {
+					return nil, fmt.Errorf("sls %s line %d: name of %s must be a string", sls, value.Line, st)
+				}
+				st.Name = name
+				continue
+			}
+			st.Args[key.Value] = v
+		}
+	}
+
+	return st, nil
+}
+
+// parseRequisites parses the list of requisites, e.g. [{pkg: nginx}, my-state]
+func parseRequisites(node *yamlv3.Node) ([]Requisite, error) {
+	items := []*yamlv3.Node{node}
+	if node.Kind == yamlv3.SequenceNode {
+		items = node.Content
+	}
+
+	out := make([]Requisite, 0, len(items))
+	for _, item := range items {
+		switch item.Kind {
+		case yamlv3.ScalarNode:
+			out = append(out, Requisite{Target: item.Value})
+		case yamlv3.MappingNode:
+			for i := 0; i+1 < len(item.Content); i += 2 {
+				target := item.Content[i+1]
+				if target.Kind != yamlv3.ScalarNode {
+					return nil, fmt.Errorf("line %d: requisite target must be a string", target.Line)
+				}
+				out = append(out, Requisite{Module: item.Content[i].Value, Target: target.Value})
+			}
+		default:
+			return nil, fmt.Errorf("line %d: requisite must be 'module: id' or id", item.Line)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,379 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/minion/module"
+)
+
+func TestParse(t *testing.T) {
+	data := `
+include:
+  - common
+
+nginx:
+  pkg.installed: []
+  service.running:
+    - enable: true
+    - watch:
+      - file: nginx-conf
+      - other
+
+nginx-conf:
+  file.managed:
+    name: /etc/nginx/nginx.conf
+    mode: "0644"
+    require:
+      - pkg: nginx
+`
+	states, err := Parse("web", []byte(data))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, states, 3) {
+		return
+	}
+
+	assert.Equal(t, &State{ID: "nginx", SLS: "web", Function: "pkg.installed", Name: "nginx", Args: map[string]any{}, Line: 6}, states[0])
+	assert.Equal(t, &State{
+		ID:       "nginx",
+		SLS:      "web",
+		Function: "service.running",
+		Name:     "nginx",
+		Args:     map[string]any{"enable": true},
+		Watch:    []Requisite{{Module: "file", Target: "nginx-conf"}, {Target: "other"}},
+		Line:     7,
+	}, states[1])
+	assert.Equal(t, "/etc/nginx/nginx.conf", states[2].Name)
+	assert.Equal(t, map[string]any{"mode": "0644"}, states[2].Args)
+	assert.Equal(t, []Requisite{{Module: "pkg", Target: "nginx"}}, states[2].Require)
+
+	assert.True(t, states[2].Match(Requisite{Module: "file", Target: "/etc/nginx/nginx.conf"}))
+	assert.True(t, states[2].Match(Requisite{Target: "nginx-conf"}))
+	assert.False(t, states[2].Match(Requisite{Module: "pkg", Target: "nginx-conf"}))
+
+	_, err = Parse("bad", []byte("nginx:\n  installed: []\n"))
+	assert.EqualError(t, err, "sls bad line 2: invalid state function 'installed', must be module.function")
+	_, err = Parse("bad", []byte("nginx:\n  pkg.installed:\n    - a\n"))
+	assert.EqualError(t, err, "sls bad line 3: argument of nginx (pkg.installed) must be a single key mapping")
+}
+
+func TestOrder(t *testing.T) {
+	states, err := Parse("order", []byte(`
+a:
+  cmd.run:
+    - require:
+      - cmd: b
+b:
+  cmd.run:
+    - onchanges:
+      - c
+c:
+  cmd.run: []
+d:
+  cmd.run: []
+`))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ordered, err := Order(states)
+	if !assert.NoError(t, err) {
+		return
+	}
+	ids := make([]string, 0)
+	for _, st := range ordered {
+		ids = append(ids, st.ID)
+	}
+	assert.Equal(t, []string{"c", "b", "a", "d"}, ids)
+
+	states, _ = Parse("cycle", []byte("a:\n  cmd.run:\n    - require: [b]\nb:\n  cmd.run:\n    - require: [a]\n"))
+	_, err = Order(states)
+	assert.EqualError(t, err, "recursive requisite found: a (cmd.run) -> b (cmd.run) -> a (cmd.run)")
+}
+
+func TestEngine(t *testing.T) {
+	bin, err := filepath.Abs("../module/testdata/fakesvc")
+	if !assert.NoError(t, err) {
+		return
+	}
+	dir := t.TempDir()
+	db := filepath.Join(dir, "services")
+	_ = os.WriteFile(db, []byte("nginx.service inactive disabled\n"), 0644)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_SVC_DB", db)
+
+	data := strings.ReplaceAll(`
+nginx:
+  service.running:
+    - enable: true
+    - provider: systemd
+    - watch:
+      - file: {dir}/conf/app.conf
+
+{dir}/conf/app.conf:
+  file.managed:
+    - contents: "listen 80"
+    - makedirs: true
+
+marker:
+  cmd.run:
+    - name: echo changed >> {dir}/marker
+    - onchanges:
+      - file: {dir}/conf/app.conf
+
+skipped:
+  cmd.run:
+    - name: "false"
+    - unless: "true"
+
+broken:
+  cmd.run:
+    - name: exit 3
+
+after-broken:
+  cmd.run:
+    - name: echo never
+    - require:
+      - cmd: broken
+`, "{dir}", dir)
+
+	r := module.NewRegistry()
+	module.RegisterBuiltin(r)
+	r.MustRegister(Functions(r)...)
+	in := &types.CallRequest{
+		Function: "state.sls",
+		Args:     []string{"web"},
+		States:   []*types.StateSource{{Name: "web", Data: []byte(data)}},
+	}
+
+	rsp := r.Call(context.TODO(), in)
+	assert.Equal(t, types.ResultType_ResultError, rsp.Type)
+	assert.Equal(t, "2 of 6 states failed", rsp.Error)
+	assert.Equal(t, int32(2), rsp.RetCode)
+	if !assert.NotNil(t, rsp.Changes) || !assert.Len(t, rsp.Changes.States, 6) {
+		return
+	}
+	assert.True(t, rsp.Changes.Changed)
+
+	results := map[string]*types.StateResult{}
+	order := make([]string, 0)
+	for _, item := range rsp.Changes.States {
+		results[item.Id] = item
+		order = append(order, item.Id)
+	}
+	assert.Equal(t, []string{dir + "/conf/app.conf", "nginx", "marker", "skipped", "broken", "after-broken"}, order)
+
+	changes := map[string]any{}
+	_ = json.Unmarshal(results["nginx"].Changes, &changes)
+	assert.Equal(t, map[string]any{
+		"running":   map[string]any{"old": false, "new": true},
+		"enabled":   map[string]any{"old": false, "new": true},
+		"restarted": true,
+	}, changes)
+	assert.True(t, results["marker"].Result)
+	assert.Equal(t, "unless condition is true", results["skipped"].Comment)
+	assert.Empty(t, results["skipped"].Changes)
+	assert.False(t, results["broken"].Result)
+	assert.Equal(t, "One or more requisite failed: cmd: broken", results["after-broken"].Comment)
+
+	summaries := make([]*Summary, 0)
+	_ = json.Unmarshal(rsp.Result, &summaries)
+	assert.Len(t, summaries, 6)
+
+	// the second run changes nothing except the commands without conditions
+	rsp = r.Call(context.TODO(), in)
+	results = map[string]*types.StateResult{}
+	for _, item := range rsp.Changes.States {
+		results[item.Id] = item
+	}
+	assert.Empty(t, results[dir+"/conf/app.conf"].Changes)
+	assert.Empty(t, results["nginx"].Changes)
+	assert.Equal(t, "State was not run because none of the onchanges reqs changed", results["marker"].Comment)
+	marker, _ := os.ReadFile(filepath.Join(dir, "marker"))
+	assert.Equal(t, "changed\n", string(marker))
+}
+
+func TestEngineTestMode(t *testing.T) {
+	bin, err := filepath.Abs("../module/testdata/fakesvc")
+	if !assert.NoError(t, err) {
+		return
+	}
+	dir := t.TempDir()
+	db := filepath.Join(dir, "services")
+	_ = os.WriteFile(db, []byte("nginx.service inactive disabled\n"), 0644)
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_SVC_DB", db)
+
+	data := strings.ReplaceAll(`
+nginx:
+  service.running:
+    - enable: true
+    - provider: systemd
+    - watch:
+      - file: {dir}/conf/app.conf
+
+{dir}/conf/app.conf:
+  file.managed:
+    - contents: "listen 80"
+    - makedirs: true
+
+marker:
+  cmd.run:
+    - name: echo changed >> {dir}/marker
+    - onchanges:
+      - file: {dir}/conf/app.conf
+
+skipped:
+  cmd.run:
+    - name: echo never >> {dir}/marker
+    - unless: "true"
+`, "{dir}", dir)
+
+	r := module.NewRegistry()
+	module.RegisterBuiltin(r)
+	r.MustRegister(Functions(r)...)
+	in := &types.CallRequest{
+		Function: "state.sls",
+		Args:     []string{"web"},
+		States:   []*types.StateSource{{Name: "web", Data: []byte(data)}},
+		Test:     true,
+	}
+
+	rsp := r.Call(context.TODO(), in)
+	if !assert.Equal(t, types.ResultType_ResultOk, rsp.Type, rsp.Error) || !assert.NotNil(t, rsp.Changes) {
+		return
+	}
+	assert.True(t, rsp.Changes.Changed)
+	assert.True(t, rsp.Changes.Test)
+
+	results := map[string]*types.StateResult{}
+	for _, item := range rsp.Changes.States {
+		results[item.Id] = item
+	}
+	assert.True(t, results[dir+"/conf/app.conf"].Pending)
+	assert.Equal(t, "File "+dir+"/conf/app.conf would be updated", results[dir+"/conf/app.conf"].Comment)
+	assert.True(t, results["nginx"].Pending)
+	assert.Equal(t, "Service nginx would be updated\nService nginx would be restarted", results["nginx"].Comment)
+	assert.Equal(t, "Command echo changed >> "+dir+"/marker would have been executed", results["marker"].Comment)
+	assert.False(t, results["skipped"].Pending)
+	assert.Equal(t, "unless condition is true", results["skipped"].Comment)
+
+	summaries := make([]*Summary, 0)
+	_ = json.Unmarshal(rsp.Result, &summaries)
+	for _, item := range summaries {
+		if item.ID == "skipped" {
+			assert.Equal(t, true, *item.Result)
+		} else {
+			assert.Nil(t, item.Result, item.ID)
+		}
+	}
+
+	// nothing is applied
+	_, err = os.Stat(filepath.Join(dir, "conf"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "marker"))
+	assert.True(t, os.IsNotExist(err))
+	services, _ := os.ReadFile(db)
+	assert.Equal(t, "nginx.service inactive disabled\n", string(services))
+}
+
+func TestFileManagedTemplate(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "motd.tmpl")
+	_ = os.WriteFile(source, []byte("welcome to {{ .Grains.host }}\nport {{ .Args.context.port }}\n"), 0644)
+	broken := filepath.Join(dir, "broken.tmpl")
+	_ = os.WriteFile(broken, []byte("line1\n{{ .Grains.missing }}\n"), 0644)
+
+	data := strings.ReplaceAll(`
+{dir}/motd:
+  file.managed:
+    - source: {dir}/motd.tmpl
+    - template: go
+    - context:
+        port: 22
+
+{dir}/broken:
+  file.managed:
+    - source: {dir}/broken.tmpl
+    - template: go
+`, "{dir}", dir)
+
+	r := module.NewRegistry()
+	module.RegisterBuiltin(r)
+	r.MustRegister(Functions(r)...)
+	r.SetGrainsFunc(func() map[string]any {
+		return map[string]any{"host": "web1"}
+	})
+	rsp := r.Call(context.TODO(), &types.CallRequest{
+		Function: "state.sls",
+		Args:     []string{"motd"},
+		States:   []*types.StateSource{{Name: "motd", Data: []byte(data)}},
+	})
+	if !assert.NotNil(t, rsp.Changes) || !assert.Len(t, rsp.Changes.States, 2) {
+		return
+	}
+
+	motd, _ := os.ReadFile(filepath.Join(dir, "motd"))
+	assert.Equal(t, "welcome to web1\nport 22\n", string(motd))
+	failed := rsp.Changes.States[1]
+	assert.False(t, failed.Result)
+	assert.Equal(t, "render "+broken+` line 2: at <.Grains.missing>: map has no entry for key "missing"`, failed.Comment)
+}
+
+func TestUserPresentExisting(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no /etc/passwd")
+	}
+	data := `
+root:
+  user.present:
+    - uid: 4242
+`
+	r := module.NewRegistry()
+	module.RegisterBuiltin(r)
+	r.MustRegister(Functions(r)...)
+	in := &types.CallRequest{
+		Function: "state.sls",
+		Args:     []string{"users"},
+		States:   []*types.StateSource{{Name: "users", Data: []byte(data)}},
+		Test:     true,
+	}
+
+	rsp := r.Call(context.TODO(), in)
+	if !assert.NotNil(t, rsp.Changes) || !assert.Len(t, rsp.Changes.States, 1) {
+		return
+	}
+	result := rsp.Changes.States[0]
+	assert.False(t, result.Result)
+	assert.Equal(t, "Cannot change uid of existing user root from 0 to 4242", result.Comment)
+}
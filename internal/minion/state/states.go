@@ -0,0 +1,438 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package state
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/internal/minion/module"
+	"github.com/vine-io/maco/internal/minion/render"
+)
+
+func nameArg(doc string) *module.Arg {
+	return &module.Arg{Name: "name", Type: module.String, Required: true, Doc: doc}
+}
+
+// builtinFuncs returns the builtin state functions
+func builtinFuncs() []*Func {
+	return []*Func{
+		{
+			Name: "file.managed",
+			Doc:  "Manage the content, permission and owner of file.",
+			Args: []*module.Arg{
+				nameArg("the absolute path of file"),
+				{Name: "contents", Type: module.String, Doc: "the content of file"},
+				{Name: "source", Type: module.String, Doc: "the absolute path of source file on the minion, or maco://path?env=<env> on maco-master"},
+				{Name: "mode", Type: module.String, Doc: "the permission of file, e.g. 0644"},
+				{Name: "user", Type: module.String, Doc: "the owner of file"},
+				{Name: "group", Type: module.String, Doc: "the group of file"},
+				{Name: "makedirs", Type: module.Boolean, Doc: "create the parent directories if they are missing"},
+				{Name: "template", Type: module.String, Doc: "render the source or contents by the renderer, only go is supported"},
+				{Name: "context", Type: module.Map, Doc: "the extra values of template, e.g. {{ .Args.context.port }}"},
+			},
+			Apply: fileManaged,
+		},
+		{
+			Name: "pkg.installed",
+			Doc:  "Make sure the packages are installed.",
+			Args: []*module.Arg{
+				nameArg("the name of package"),
+				{Name: "pkgs", Type: module.List, Doc: "the packages to install instead of name"},
+				{Name: "refresh", Type: module.Boolean, Doc: "refresh the package database before install"},
+				{Name: "provider", Type: module.String, Doc: "the package backend"},
+			},
+			Apply: pkgInstalled,
+		},
+		{
+			Name: "service.running",
+			Doc:  "Make sure the service is running, the service is restarted when the watched states changed.",
+			Args: []*module.Arg{
+				nameArg("the name of service"),
+				{Name: "enable", Type: module.Boolean, Doc: "enable or disable the service on boot, unchanged by default"},
+				{Name: "reload", Type: module.Boolean, Doc: "reload instead of restart the service for watch"},
+				{Name: "provider", Type: module.String, Doc: "the service backend"},
+			},
+			Apply: serviceRunning,
+			Watch: serviceWatch,
+		},
+		{
+			Name: "user.present",
+			Doc:  "Make sure the user exists with the given shell and groups. The uid, gid and home of an existing user are not changed, the state fails if they differ.",
+			Args: []*module.Arg{
+				nameArg("the name of user"),
+				{Name: "uid", Type: module.Integer, Doc: "the uid of new user"},
+				{Name: "gid", Type: module.String, Doc: "the primary group of new user"},
+				{Name: "groups", Type: module.List, Doc: "the supplementary groups"},
+				{Name: "home", Type: module.String, Doc: "the home directory of new user"},
+				{Name: "shell", Type: module.String, Doc: "the login shell"},
+				{Name: "gecos", Type: module.String, Doc: "the full name or comment of new user"},
+				{Name: "createhome", Type: module.Boolean, Default: true, Doc: "create the home directory"},
+				{Name: "system", Type: module.Boolean, Doc: "create a system account"},
+			},
+			Apply: userPresent,
+		},
+		{
+			Name: "cmd.run",
+			Doc:  "Run the command, unless and onlyif make it idempotent.",
+			Args: []*module.Arg{
+				nameArg("the command to run"),
+				{Name: "unless", Type: module.String, Doc: "the command is not run if unless exits with 0"},
+				{Name: "onlyif", Type: module.String, Doc: "the command is run only if onlyif exits with 0"},
+				{Name: "creates", Type: module.String, Doc: "the command is not run if the path exists"},
+				{Name: "cwd", Type: module.String, Doc: "the working directory"},
+				{Name: "env", Type: module.List, Doc: "the extra environment variables, e.g. K=V"},
+				{Name: "runas", Type: module.String, Doc: "run the command as the user"},
+				{Name: "shell", Type: module.String, Doc: "the shell to run the command"},
+			},
+			Apply: cmdRun,
+		},
+	}
+}
+
+// pick returns the arguments which are set
+func pick(args module.Args, names ...string) map[string]any {
+	out := map[string]any{}
+	for _, name := range names {
+		if args.Has(name) {
+			out[name] = args[name]
+		}
+	}
+	return out
+}
+
+// merge copies the changes of execution result into changes
+func merge(changes map[string]any, result *module.Result) {
+	if result == nil || !result.Changed {
+		return
+	}
+	if m, ok := result.Changes.(map[string]any); ok {
+		for key, value := range m {
+			changes[key] = value
+		}
+	}
+}
+
+func fileManaged(ctx context.Context, env *Env, st *State, args module.Args) *Ret {
+	path := args.String("name")
+	var content string
+	switch {
+	case args.Has("contents"):
+		content = args.String("contents")
+	case types.IsFileURL(args.String("source")):
+		// fetched from the file server of maco-master, even in test mode
+		result, err := env.Probe(ctx, "cp.get_file_str", map[string]any{"url": args.String("source")})
+		if err != nil {
+			return Fail("Fetch source of %s: %v", path, err)
+		}
+		text, _ := result.Return.(string)
+		content = text
+	case args.String("source") != "":
+		data, err := os.ReadFile(strings.TrimPrefix(args.String("source"), "file://"))
+		if err != nil {
+			return Fail("Read source of %s: %v", path, err)
+		}
+		content = string(data)
+	default:
+		return Fail("contents or source is required")
+	}
+
+	if renderer := args.String("template"); renderer != "" {
+		if !render.Supported(renderer) {
+			return Fail("Template renderer %s is not supported", renderer)
+		}
+		name := args.String("source")
+		if name == "" {
+			name = st.String()
+		}
+		data := &render.Context{
+			ID:     st.ID,
+			SLS:    st.SLS,
+			Grains: env.Request.Grains,
+			Pillar: env.Request.Pillar,
+			Args:   args,
+		}
+		rendered, err := render.Render(name, content, data)
+		if err != nil {
+			return Fail("%v", err)
+		}
+		content = rendered
+	}
+
+	changes := map[string]any{}
+	values := pick(args, "mode", "makedirs")
+	values["path"] = path
+	values["content"] = content
+	result, err := env.Exec(ctx, "file.write", values)
+	if err != nil {
+		return Fail("Write %s: %v", path, err)
+	}
+	merge(changes, result)
+
+	_, statErr := os.Stat(path)
+	if env.Test() && statErr != nil && (args.String("user") != "" || args.String("group") != "") {
+		// the file is not created in test mode, the owner would be set after creation
+		for _, key := range []string{"user", "group"} {
+			if value := args.String(key); value != "" {
+				changes[key] = map[string]string{"old": "", "new": value}
+			}
+		}
+	} else if args.String("user") != "" || args.String("group") != "" {
+		values = pick(args, "user", "group")
+		values["path"] = path
+		result, err = env.Exec(ctx, "file.chown", values)
+		if err != nil {
+			return Fail("Change owner of %s: %v", path, err)
+		}
+		merge(changes, result)
+	}
+
+	if len(changes) == 0 {
+		return &Ret{Result: true, Comment: fmt.Sprintf("File %s is in the correct state", path)}
+	}
+	return &Ret{Result: true, Comment: env.Updated("File %s", path), Changes: changes}
+}
+
+func pkgInstalled(ctx context.Context, env *Env, st *State, args module.Args) *Ret {
+	names := args.List("pkgs")
+	if len(names) == 0 {
+		names = []string{args.String("name")}
+	}
+
+	result, err := env.Exec(ctx, "pkg.install", pick(args, "refresh", "provider"), names...)
+	if err != nil {
+		return Fail("Install %s: %v", strings.Join(names, ", "), err)
+	}
+	changes := map[string]any{}
+	if pkgs, ok := result.Changes.(map[string]*module.PkgChange); ok && result.Changed {
+		for name, change := range pkgs {
+			changes[name] = change
+		}
+	}
+	if len(changes) == 0 {
+		return &Ret{Result: true, Comment: "All specified packages are already installed"}
+	}
+	comment := fmt.Sprintf("Installed packages: %s", strings.Join(names, ", "))
+	if env.Test() {
+		comment = fmt.Sprintf("Packages would be installed: %s", strings.Join(names, ", "))
+	}
+	return &Ret{Result: true, Comment: comment, Changes: changes}
+}
+
+// serviceChanges records the changes of service action
+func serviceChanges(changes map[string]any, key string, result *module.Result) {
+	out, ok := result.Return.(map[string]any)
+	if !ok || out["changed"] != true {
+		return
+	}
+	before, _ := out["before"].(*module.ServiceState)
+	after, _ := out["after"].(*module.ServiceState)
+	if before == nil || after == nil {
+		changes[key] = true
+		return
+	}
+	switch key {
+	case "running":
+		changes[key] = map[string]bool{"old": before.Active, "new": after.Active}
+	case "enabled":
+		changes[key] = map[string]bool{"old": before.Enabled, "new": after.Enabled}
+	default:
+		changes[key] = true
+	}
+}
+
+func serviceRunning(ctx context.Context, env *Env, st *State, args module.Args) *Ret {
+	name := args.String("name")
+	values := pick(args, "provider")
+	values["name"] = name
+
+	changes := map[string]any{}
+	result, err := env.Exec(ctx, "service.start", values)
+	if err != nil {
+		return Fail("Start service %s: %v", name, err)
+	}
+	serviceChanges(changes, "running", result)
+
+	if args.Has("enable") {
+		action := "service.disable"
+		if args.Bool("enable") {
+			action = "service.enable"
+		}
+		result, err = env.Exec(ctx, action, values)
+		if err != nil {
+			return Fail("Enable service %s: %v", name, err)
+		}
+		serviceChanges(changes, "enabled", result)
+	}
+
+	if len(changes) == 0 {
+		return &Ret{Result: true, Comment: fmt.Sprintf("Service %s is in the correct state", name)}
+	}
+	return &Ret{Result: true, Comment: env.Updated("Service %s", name), Changes: changes}
+}
+
+func serviceWatch(ctx context.Context, env *Env, st *State, args module.Args) *Ret {
+	name := args.String("name")
+	values := pick(args, "provider")
+	values["name"] = name
+
+	action, key := "service.restart", "restarted"
+	if args.Bool("reload") {
+		action, key = "service.reload", "reloaded"
+	}
+	result, err := env.Exec(ctx, action, values)
+	if err != nil {
+		return Fail("%s %s: %v", action, name, err)
+	}
+	changes := map[string]any{}
+	serviceChanges(changes, key, result)
+	comment := fmt.Sprintf("Service %s %s", name, key)
+	if env.Test() {
+		comment = fmt.Sprintf("Service %s would be %s", name, key)
+	}
+	return &Ret{Result: true, Comment: comment, Changes: changes}
+}
+
+func userPresent(ctx context.Context, env *Env, st *State, args module.Args) *Ret {
+	name := args.String("name")
+	changes := map[string]any{}
+
+	values := pick(args, "uid", "gid", "groups", "home", "shell", "gecos", "createhome", "system")
+	values["name"] = name
+	result, err := env.Exec(ctx, "user.add", values)
+	if err != nil {
+		return Fail("Add user %s: %v", name, err)
+	}
+	if result.Changed {
+		changes["user"] = "new"
+		merge(changes, result)
+	} else {
+		// the uid, primary group and home of an existing user are not changed,
+		// the files owned by the user would be left behind
+		if u, ok := result.Return.(map[string]any)["user"].(*module.UserInfo); ok {
+			if args.Has("uid") && args.Int("uid") != int64(u.Uid) {
+				return Fail("Cannot change uid of existing user %s from %d to %d", name, u.Uid, args.Int("uid"))
+			}
+			if gid := args.String("gid"); gid != "" && gid != u.Group && gid != strconv.Itoa(u.Gid) {
+				return Fail("Cannot change primary group of existing user %s from %s to %s", name, u.Group, gid)
+			}
+			if home := args.String("home"); home != "" && filepath.Clean(home) != filepath.Clean(u.Home) {
+				return Fail("Cannot change home of existing user %s from %s to %s", name, u.Home, home)
+			}
+		}
+
+		// make sure the shell and groups
+		if args.String("shell") != "" {
+			result, err = env.Exec(ctx, "user.chshell", map[string]any{"name": name, "shell": args.String("shell")})
+			if err != nil {
+				return Fail("Change shell of %s: %v", name, err)
+			}
+			if result.Changed {
+				changes["shell"] = result.Changes
+			}
+		}
+		if args.Has("groups") {
+			result, err = env.Exec(ctx, "user.chgroups", map[string]any{"name": name, "groups": args.List("groups")})
+			if err != nil {
+				return Fail("Change groups of %s: %v", name, err)
+			}
+			if result.Changed {
+				changes["groups"] = result.Changes
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		return &Ret{Result: true, Comment: fmt.Sprintf("User %s is present and up to date", name)}
+	}
+	return &Ret{Result: true, Comment: env.Updated("User %s", name), Changes: changes}
+}
+
+// condition runs the condition command of cmd.run, returns its exit code. The condition
+// is run in test mode too.
+func condition(ctx context.Context, env *Env, cmd string, args module.Args) (int32, error) {
+	values := pick(args, "cwd", "env", "runas", "shell")
+	values["cmd"] = cmd
+	result, err := env.Probe(ctx, "cmd.run_all", values)
+	if err != nil {
+		return 0, err
+	}
+	return result.RetCode, nil
+}
+
+func cmdRun(ctx context.Context, env *Env, st *State, args module.Args) *Ret {
+	name := args.String("name")
+
+	if path := args.String("creates"); path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return &Ret{Result: true, Comment: fmt.Sprintf("%s exists", path)}
+		}
+	}
+	if cmd := args.String("onlyif"); cmd != "" {
+		code, err := condition(ctx, env, cmd, args)
+		if err != nil {
+			return Fail("Run onlyif: %v", err)
+		}
+		if code != 0 {
+			return &Ret{Result: true, Comment: "onlyif condition is false"}
+		}
+	}
+	if cmd := args.String("unless"); cmd != "" {
+		code, err := condition(ctx, env, cmd, args)
+		if err != nil {
+			return Fail("Run unless: %v", err)
+		}
+		if code == 0 {
+			return &Ret{Result: true, Comment: "unless condition is true"}
+		}
+	}
+
+	if env.Test() {
+		return &Ret{
+			Result:  true,
+			Comment: fmt.Sprintf("Command %s would have been executed", name),
+			Changes: map[string]any{"cmd": name},
+		}
+	}
+
+	values := pick(args, "cwd", "env", "runas", "shell")
+	values["cmd"] = name
+	result, err := env.Exec(ctx, "cmd.run_all", values)
+	if err != nil {
+		return Fail("Run %s: %v", name, err)
+	}
+	changes := map[string]any{
+		"pid":     result.Pid,
+		"retcode": result.RetCode,
+		"stdout":  result.Stdout,
+		"stderr":  result.Stderr,
+	}
+	if result.RetCode != 0 {
+		return &Ret{Comment: fmt.Sprintf("Command %s exited with %d", name, result.RetCode), Changes: changes}
+	}
+	return &Ret{Result: true, Comment: fmt.Sprintf("Command %s run", name), Changes: changes}
+}
@@ -0,0 +1,240 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package cp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/client"
+	"github.com/vine-io/maco/internal/tools/utils"
+	version "github.com/vine-io/maco/pkg/version"
+)
+
+var defaultUsageTemplate = `Usage:{{if .Runnable}}
+  {{.UseLine}} '<target>' <source> <dest>{{end}}{{if .HasExample}}
+
+Examples:
+{{.Example}}{{end}}{{if .HasAvailableLocalFlags}}
+
+Flags:
+{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}
+`
+
+var copyExample = `  # copy the file to the directory of minions
+  maco-cp 'web*' ./nginx.conf /etc/nginx/
+
+  # copy the directory with the permission and owner
+  maco-cp 'G@os:linux' ./app /opt/app --mode 0640 --user app --group app --makedirs
+
+  # show which minions would be changed without copying
+  maco-cp '*' ./motd /etc/motd --test`
+
+// copyFileResult 单个文件的复制结果
+type copyFileResult struct {
+	Path    string `json:"path" yaml:"path"`
+	Hash    string `json:"hash" yaml:"hash"`
+	Bytes   int64  `json:"bytes" yaml:"bytes"`
+	Changed bool   `json:"changed" yaml:"changed"`
+}
+
+// copyResult minion 的复制结果，复制目录时包含每个文件的结果
+type copyResult struct {
+	Minion  string            `json:"minion" yaml:"minion"`
+	Result  bool              `json:"result" yaml:"result"`
+	Error   string            `json:"error,omitempty" yaml:"error,omitempty"`
+	Path    string            `json:"path,omitempty" yaml:"path,omitempty"`
+	Bytes   int64             `json:"bytes" yaml:"bytes"`
+	Changed bool              `json:"changed" yaml:"changed"`
+	Files   []*copyFileResult `json:"files,omitempty" yaml:"files,omitempty"`
+}
+
+func NewCopyCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
+	app := &cobra.Command{
+		Use:     "maco-cp",
+		Short:   "copy local file or directory to the targeted minions",
+		Version: version.ReleaseVersion(),
+		Example: copyExample,
+		Args:    cobra.ArbitraryArgs,
+		RunE:    runCopyCmd,
+	}
+
+	app.SetIn(stdin)
+	app.SetOut(stdout)
+	app.SetErr(stderr)
+	app.SetVersionTemplate(version.GetVersionTemplate())
+	app.SetUsageTemplate(defaultUsageTemplate)
+
+	app.ResetFlags()
+
+	var configPath string
+	homeDir, _ := os.UserHomeDir()
+	if homeDir != "" {
+		configPath = filepath.Join(homeDir, ".maco", "maco.toml")
+	}
+
+	flagSet := app.Flags()
+	flagSet.StringP("config", "C", configPath, "Set path to the configuration file.")
+	flagSet.StringP("format", "F", "", "Set the format of output, etc text, json, yaml.")
+	flagSet.StringP("output", "O", "", "Write the output to the specified file.")
+	flagSet.BoolP("output-append", "", false, "Append the output to the specified file.")
+	flagSet.BoolP("no-color", "", false, "Disable all colored output.")
+	flagSet.StringP("mode", "m", "", "Set the permission of files, e.g. 0644.")
+	flagSet.StringP("user", "u", "", "Set the owner of files.")
+	flagSet.StringP("group", "g", "", "Set the group of files.")
+	flagSet.BoolP("makedirs", "p", false, "Create the parent directories of dest if they are missing.")
+	flagSet.Int64P("timeout", "t", 0, "Set the timeout in seconds, 60 by default.")
+	flagSet.Int("chunk-size", client.DefaultCopyChunkSize, "Set the size of chunk to upload.")
+	flagSet.Bool("test", false, "Compute the changes which would be made without copying.")
+
+	return app
+}
+
+func runCopyCmd(cmd *cobra.Command, args []string) error {
+	if len(args) != 3 {
+		return cmd.Usage()
+	}
+	ctx := cmd.Context()
+	flagSet := cmd.Flags()
+
+	noColor, _ := flagSet.GetBool("no-color")
+	format, _ := flagSet.GetString("format")
+	outputFile, _ := flagSet.GetString("output")
+	outputAppend, _ := flagSet.GetBool("output-append")
+
+	options := &client.CopyOptions{Dest: args[2]}
+	options.Mode, _ = flagSet.GetString("mode")
+	options.User, _ = flagSet.GetString("user")
+	options.Group, _ = flagSet.GetString("group")
+	options.Makedirs, _ = flagSet.GetBool("makedirs")
+	options.Timeout, _ = flagSet.GetInt64("timeout")
+	options.ChunkSize, _ = flagSet.GetInt("chunk-size")
+	options.Test, _ = flagSet.GetBool("test")
+
+	mc, err := utils.ClientFromFlags(flagSet)
+	if err != nil {
+		return err
+	}
+
+	targets := strings.Trim(strings.Trim(args[0], `'`), `"`)
+	selector := &types.Selector{Expression: targets}
+	report, err := mc.CopyFile(ctx, selector, args[1], options)
+	if err != nil {
+		return fmt.Errorf("%v", apiErr.Parse(err).Detail)
+	}
+
+	results := make([]*copyResult, 0, len(report.Items))
+	for _, item := range report.Items {
+		result := &copyResult{Minion: item.Minion, Result: item.Result, Error: item.Error}
+		if item.Result {
+			_ = json.Unmarshal(item.Data, result)
+		}
+		results = append(results, result)
+	}
+
+	output := cmd.OutOrStdout()
+	if len(outputFile) != 0 {
+		mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if outputAppend {
+			mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		fd, fdErr := os.OpenFile(outputFile, mode, 0755)
+		if fdErr != nil {
+			return fmt.Errorf("open output file: %w", fdErr)
+		}
+		defer fd.Close()
+		output = fd
+	}
+
+	var data []byte
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(results, " ", "   ")
+		if err != nil {
+			return fmt.Errorf("json marshal: %w", err)
+		}
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(results)
+		if err != nil {
+			return fmt.Errorf("yaml marshal: %w", err)
+		}
+	default:
+		if noColor || !utils.AllowColor() {
+			color.NoColor = true
+		}
+		data = formatText(results, options.Test)
+	}
+
+	fmt.Fprintf(output, "%s", string(data))
+	return nil
+}
+
+// formatText 按 minion 输出复制结果，并在最后输出汇总
+func formatText(results []*copyResult, test bool) []byte {
+	written, would := "written", "changed"
+	if test {
+		written, would = "to write", "would be changed"
+	}
+
+	buf := bytes.NewBufferString("")
+	changed, total := 0, int64(0)
+	for _, result := range results {
+		fmt.Fprintf(buf, "%s:\n", result.Minion)
+		if !result.Result {
+			color.New(color.FgRed).Fprintf(buf, "    Error: %s\n", result.Error)
+			continue
+		}
+		if result.Changed {
+			changed += 1
+		}
+		total += result.Bytes
+
+		files := result.Files
+		if files == nil {
+			files = []*copyFileResult{{Path: result.Path, Bytes: result.Bytes, Changed: result.Changed}}
+		}
+		for _, file := range files {
+			switch {
+			case file.Bytes > 0:
+				color.New(color.FgGreen).Fprintf(buf, "    %s: %d bytes %s\n", file.Path, file.Bytes, written)
+			case file.Changed:
+				color.New(color.FgGreen).Fprintf(buf, "    %s: mode or owner %s\n", file.Path, would)
+			default:
+				fmt.Fprintf(buf, "    %s: unchanged\n", file.Path)
+			}
+		}
+	}
+	fmt.Fprintf(buf, "\n%d of %d minions %s, %d bytes %s\n", changed, len(results), would, total, written)
+	return buf.Bytes()
+}
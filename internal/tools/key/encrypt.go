@@ -0,0 +1,140 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package key
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"github.com/vine-io/maco/internal/master/pillar"
+)
+
+func newEncryptCmd(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
+	app := &cobra.Command{
+		Use:     "encrypt",
+		Aliases: []string{"E", "enc"},
+		Short:   "encrypt secret value for pillar by maco-master public key",
+		Example: `  maco-key encrypt 'p@ssw0rd'
+  echo -n 'p@ssw0rd' | maco-key encrypt --pub /etc/maco/master.pub`,
+		RunE: runEncryptCmd,
+	}
+
+	app.SetIn(stdin)
+	app.SetOut(stdout)
+	app.SetErr(stderr)
+
+	app.SetUsageTemplate(fmt.Sprintf(defaultUsageTemplate, " [text] "))
+	app.UsageFunc()
+
+	app.ResetFlags()
+
+	var pubPath string
+	homeDir, _ := os.UserHomeDir()
+	if homeDir != "" {
+		pubPath = filepath.Join(homeDir, ".maco", "master.pub")
+	}
+
+	flagSet := app.Flags()
+	flagSet.StringP("pub", "", pubPath, "Set path to the public key of maco-master.")
+
+	return app
+}
+
+func runEncryptCmd(cmd *cobra.Command, args []string) error {
+	flagSet := cmd.Flags()
+	globalSet := cmd.Parent().PersistentFlags()
+
+	format, _ := globalSet.GetString("format")
+	outputFile, _ := globalSet.GetString("output")
+	outputAppend, _ := globalSet.GetBool("output-append")
+
+	pubPath, _ := flagSet.GetString("pub")
+	pubKey, err := os.ReadFile(pubPath)
+	if err != nil {
+		return fmt.Errorf("read master public key: %w", err)
+	}
+
+	// 未指定参数时从标准输入读取
+	var plaintext []byte
+	if len(args) > 0 && args[0] != "-" {
+		plaintext = []byte(args[0])
+	} else {
+		plaintext, err = io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+		plaintext = bytes.TrimSuffix(plaintext, []byte("\n"))
+	}
+	if len(plaintext) == 0 {
+		return fmt.Errorf("no text specified")
+	}
+
+	value, err := pillar.Encrypt(plaintext, pubKey)
+	if err != nil {
+		return fmt.Errorf("encrypt: %w", err)
+	}
+
+	output := cmd.OutOrStdout()
+	if len(outputFile) != 0 {
+		mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if outputAppend {
+			mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		fd, fdErr := os.OpenFile(outputFile, mode, 0755)
+		if fdErr != nil {
+			return fmt.Errorf("open output file: %w", fdErr)
+		}
+		defer fd.Close()
+		output = fd
+	}
+
+	mapping := map[string]string{
+		"encrypted": value,
+	}
+
+	var data []byte
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(mapping, " ", "   ")
+		if err != nil {
+			return fmt.Errorf("json marshal: %w", err)
+		}
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(mapping)
+		if err != nil {
+			return fmt.Errorf("yaml marshal: %w", err)
+		}
+	default:
+		data = []byte(value + "\n")
+	}
+
+	fmt.Fprintf(output, "%s", string(data))
+	return nil
+}
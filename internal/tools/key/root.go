@@ -84,6 +84,8 @@ func NewKeyCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
 	app.AddCommand(newListKeysCmd(stdin, stdout, stderr))
 	app.AddCommand(newPrintKeysCmd(stdin, stdout, stderr))
 
+	app.AddCommand(newEncryptCmd(stdin, stdout, stderr))
+
 	app.ResetFlags()
 
 	var configPath string
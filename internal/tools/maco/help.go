@@ -0,0 +1,202 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package maco
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/vine-io/maco/api/types"
+)
+
+// remoteTimeout is the timeout of the calls which render help and completion
+const remoteTimeout = 10
+
+// callFirst calls the function on target minions and decodes the result of
+// the first minion which succeeds into out. The call is not saved to the job
+// cache.
+func callFirst(target, function string, out any, args ...string) error {
+	mc, err := newClient()
+	if err != nil {
+		return err
+	}
+	defer mc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), (remoteTimeout+5)*time.Second)
+	defer cancel()
+	in := &types.CallRequest{
+		Selector: &types.Selector{Expression: target},
+		Function: function,
+		Args:     args,
+		Timeout:  remoteTimeout,
+	}
+	report, err := mc.CallNoJob(ctx, in)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, item := range report.Items {
+		if !item.Result {
+			lastErr = fmt.Errorf("%s: %s", item.Minion, item.Error)
+			continue
+		}
+		return json.Unmarshal(item.Data, out)
+	}
+	if lastErr != nil {
+		return lastErr
+	}
+	return fmt.Errorf("no minion matches '%s'", target)
+}
+
+// showFunctionHelp renders the documentation of remote function
+func showFunctionHelp(cmd *cobra.Command, target, function string) error {
+	docs := map[string]*types.FunctionDoc{}
+	if err := callFirst(target, "sys.doc", &docs, function); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(docs))
+	for name := range docs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if i > 0 {
+			cmd.Println()
+		}
+		renderFunctionDoc(cmd.OutOrStdout(), docs[name])
+	}
+	return nil
+}
+
+// renderFunctionDoc writes the documentation of function in the layout of cobra help:
+//
+//	cmd.run - Run a command and return the combined output.
+//
+//	Usage:
+//	  maco '<target>' cmd.run <cmd> [cwd=<string>]
+//
+//	Arguments:
+//	  cmd    string   required   the command line
+func renderFunctionDoc(w io.Writer, doc *types.FunctionDoc) {
+	fmt.Fprintf(w, "%s - %s\n\n", doc.Name, doc.Doc)
+
+	usage := []string{"maco", "'<target>'", doc.Name}
+	for _, arg := range doc.Args {
+		switch {
+		case arg.Keyword:
+			usage = append(usage, fmt.Sprintf("[%s=<%s>]", arg.Name, arg.Type))
+		case arg.Required:
+			usage = append(usage, fmt.Sprintf("<%s>", arg.Name))
+		default:
+			usage = append(usage, fmt.Sprintf("[%s]", arg.Name))
+		}
+	}
+	if doc.Varargs != "" {
+		usage = append(usage, fmt.Sprintf("[%s...]", doc.Varargs))
+	}
+	fmt.Fprintf(w, "Usage:\n  %s\n", strings.Join(usage, " "))
+
+	if len(doc.Args) > 0 {
+		fmt.Fprintf(w, "\nArguments:\n")
+		tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+		for _, arg := range doc.Args {
+			flags := make([]string, 0)
+			if arg.Required {
+				flags = append(flags, "required")
+			}
+			if arg.Keyword {
+				flags = append(flags, "keyword")
+			}
+			text := arg.Doc
+			if arg.Default != nil {
+				text += fmt.Sprintf(" (default %v)", arg.Default)
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", arg.Name, arg.Type, strings.Join(flags, ","), text)
+		}
+		_ = tw.Flush()
+	}
+
+	if doc.Returns != "" {
+		fmt.Fprintf(w, "\nReturns:\n  %s\n", doc.Returns)
+	}
+}
+
+// completeMaco completes the minion names, function names and keyword arguments
+func completeMaco(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		mc, err := newClient()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		defer mc.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout*time.Second)
+		defer cancel()
+		minions, err := mc.ListMinions(ctx, types.Accepted, types.AutoSign)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		names := append(minions[types.Accepted], minions[types.AutoSign]...)
+		return filterPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+	case 1:
+		var names []string
+		if err := callFirst(args[0], "sys.list_functions", &names); err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return filterPrefix(names, toComplete), cobra.ShellCompDirectiveNoFileComp
+	default:
+		specs := map[string]*types.Argspec{}
+		if err := callFirst(args[0], "sys.argspec", &specs, args[1]); err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		spec, ok := specs[args[1]]
+		if !ok {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names := make([]string, 0, len(spec.Args))
+		for _, arg := range spec.Args {
+			names = append(names, arg.Name+"=")
+		}
+		return filterPrefix(names, toComplete), cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+func filterPrefix(items []string, prefix string) []string {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		if strings.HasPrefix(item, prefix) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -67,12 +67,48 @@ Additional help topics:{{range .Commands}}{{if .IsAdditionalHelpTopicCommand}}
 Use "{{.CommandPath}} [command] --help" for more information about a command.{{end}}
 `
 
+var macoExample = `  # check whether the minions are responding
+  maco '*' test.ping
+
+  # glob on the minion name
+  maco 'web-*' cmd.run uptime
+
+  # compound target expression
+  maco 'G@os:linux and web-* and not S@10.1.0.0/16' cmd.run uptime
+
+  # explicit list, regexp, tag and subnet matchers
+  maco 'L@web1,web2 or E@^db[0-9]+$ or T@role:cache or S@10.0.0.0/8' cmd.run uptime
+
+  # apply the state files under the states directory of maco-master
+  maco 'web*' state.sls nginx,users
+
+  # apply the state files matched by the top file of maco-master
+  maco '*' state.highstate
+
+  # show the changes which would be made by states without applying them
+  maco 'web*' state.sls nginx --test
+
+  # run the job in background and collect the results later
+  jid=$(maco 'web*' cmd.run 'sleep 60; uptime' --async --timeout 120)
+  maco-run jobs.lookup $jid
+
+  # show the documentation of remote function
+  maco 'web1' cmd.run --help
+  maco 'web1' sys.doc 'file.*'
+
+  # enable the completion of minions and functions in bash
+  source <(maco completion bash)`
+
 func NewMacoCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
 	app := &cobra.Command{
 		Use:     "maco",
 		Short:   "the client of maco system",
 		Version: version.ReleaseVersion(),
+		Example: macoExample,
+		Args:    cobra.ArbitraryArgs,
 		RunE:    runMacoCmd,
+
+		ValidArgsFunction: completeMaco,
 	}
 
 	app.SetIn(stdin)
@@ -80,9 +116,23 @@ func NewMacoCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
 	app.SetErr(stderr)
 	app.SetVersionTemplate(version.GetVersionTemplate())
 	app.SetUsageTemplate(defaultUsageTemplate)
+	defaultHelp := app.HelpFunc()
+	app.SetHelpFunc(func(cmd *cobra.Command, args []string) {
+		// maco '<target>' <function> --help
+		if cmd == app && len(cmd.Flags().Args()) >= 2 {
+			if err := showFunctionHelp(cmd, cmd.Flags().Args()[0], cmd.Flags().Args()[1]); err != nil {
+				cmd.PrintErrln("Error:", err)
+			}
+			return
+		}
+		defaultHelp(cmd, args)
+	})
 
 	app.ResetFlags()
-	//flags := root.PersistentFlags()
+	flags := app.Flags()
+	flags.Bool("test", false, "compute the changes which would be made without applying them")
+	flags.Bool("async", false, "print the job id and return without waiting for the minions")
+	flags.Int64P("timeout", "t", 0, "the timeout in seconds to wait for the minions, 10 by default")
 
 	return app
 }
@@ -110,22 +160,31 @@ func runMacoCmd(cmd *cobra.Command, args []string) error {
 		argments = args[2:]
 	}
 
-	target := "127.0.0.1:4550"
-
 	lg, _ := zap.NewProduction()
-	cfg := client.NewConfig(target)
-	mc, err := client.NewClient(cfg)
+	mc, err := newClient()
 	if err != nil {
 		return err
 	}
 
 	ctx := context.Background()
 	in := &types.CallRequest{
-		Selector: &types.Selector{},
+		Selector: &types.Selector{
+			Expression: targets,
+		},
 	}
-	in.Selector.Minions = strings.Split(targets, ",")
 	in.Function = function
 	in.Args = argments
+	in.Test, _ = cmd.Flags().GetBool("test")
+	in.Timeout, _ = cmd.Flags().GetInt64("timeout")
+
+	if async, _ := cmd.Flags().GetBool("async"); async {
+		jid, _, err := mc.CallAsync(ctx, in)
+		if err != nil {
+			lg.Fatal("call error", zap.Error(err))
+		}
+		fmt.Println(jid)
+		return nil
+	}
 
 	out, err := mc.Call(ctx, in)
 	if err != nil {
@@ -140,6 +199,15 @@ func runMacoCmd(cmd *cobra.Command, args []string) error {
 			fmt.Printf("    Error: %s\n", string(item.Error))
 		}
 	}
+	if in.Test && out.Summary != nil {
+		fmt.Printf("\n%d of %d minions would be changed\n", out.Summary.Changes, out.Summary.Total)
+	}
 
 	return nil
 }
+
+func newClient() (*client.Client, error) {
+	target := "127.0.0.1:4550"
+	cfg := client.NewConfig(target)
+	return client.NewClient(cfg)
+}
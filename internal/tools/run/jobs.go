@@ -0,0 +1,436 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+
+	apiErr "github.com/vine-io/maco/api/errors"
+	pb "github.com/vine-io/maco/api/rpc"
+	"github.com/vine-io/maco/api/types"
+	"github.com/vine-io/maco/client"
+)
+
+// jobResult minion 的执行结果
+type jobResult struct {
+	Minion  string          `json:"minion"`
+	Result  bool            `json:"result"`
+	Error   string          `json:"error,omitempty"`
+	RetCode int32           `json:"retcode"`
+	Changed bool            `json:"changed"`
+	Killed  bool            `json:"killed,omitempty"`
+	Return  json.RawMessage `json:"return,omitempty"`
+}
+
+// jobLookup 任务的执行结果
+type jobLookup struct {
+	Jid     string               `json:"jid"`
+	State   string               `json:"state"`
+	Minions []*jobResult         `json:"minions"`
+	Missing []string             `json:"missing,omitempty"`
+	Summary *types.ReportSummary `json:"summary,omitempty"`
+}
+
+func newJobResult(item *types.ReportItem) *jobResult {
+	result := &jobResult{
+		Minion:  item.Minion,
+		Result:  item.Result,
+		Error:   item.Error,
+		RetCode: item.RetCode,
+		Changed: item.Changes != nil && item.Changes.Changed,
+		Killed:  item.Killed,
+	}
+	if len(item.Data) != 0 {
+		if json.Valid(item.Data) {
+			result.Return = item.Data
+		} else {
+			result.Return, _ = json.Marshal(string(item.Data))
+		}
+	}
+	return result
+}
+
+func jobsLookupRunner() *runner {
+	return &runner{
+		name:  "jobs.lookup",
+		usage: "<jid>",
+		short: "show the results of the job, including the minions which have not returned",
+		run:   runJobsLookup,
+		text:  formatJobLookup,
+	}
+}
+
+func runJobsLookup(ctx context.Context, mc *client.Client, args *runArgs) (any, error) {
+	if err := args.check(1, "jid"); err != nil {
+		return nil, err
+	}
+	jid := args.get(0, "jid")
+	if jid == "" {
+		return nil, fmt.Errorf("missing jid, usage: jobs.lookup <jid>")
+	}
+
+	rsp, err := mc.LookupJob(ctx, jid)
+	if err != nil {
+		return nil, fmt.Errorf("%v", apiErr.Parse(err).Detail)
+	}
+
+	out := &jobLookup{
+		Jid:     jid,
+		State:   rsp.State,
+		Minions: []*jobResult{},
+		Missing: rsp.Missing,
+	}
+	if report := rsp.Report; report != nil {
+		for _, item := range report.Items {
+			out.Minions = append(out.Minions, newJobResult(item))
+		}
+		out.Summary = report.Summary
+	}
+	return out, nil
+}
+
+// formatJobLookup 按 minion 输出任务结果，未返回结果的 minion 输出在最后
+func formatJobLookup(v any) []byte {
+	out := v.(*jobLookup)
+
+	buf := bytes.NewBufferString("")
+	for _, result := range out.Minions {
+		fmt.Fprintf(buf, "%s:\n", result.Minion)
+		if result.Killed {
+			color.New(color.FgRed).Fprintf(buf, "    Killed: %s\n", result.Error)
+			continue
+		}
+		if !result.Result {
+			color.New(color.FgRed).Fprintf(buf, "    Error: %s\n", result.Error)
+			continue
+		}
+		var text string
+		if err := json.Unmarshal(result.Return, &text); err != nil {
+			text = string(result.Return)
+		}
+		fmt.Fprintf(buf, "    %s\n", text)
+	}
+
+	missing := "Minion did not return"
+	if out.State == types.JobRunning.String() {
+		missing = "Minion has not returned yet"
+	}
+	for _, name := range out.Missing {
+		fmt.Fprintf(buf, "%s:\n", name)
+		color.New(color.FgYellow).Fprintf(buf, "    %s\n", missing)
+	}
+
+	var success, failed int64
+	if out.Summary != nil {
+		success, failed = out.Summary.Success, out.Summary.Failed
+	}
+	fmt.Fprintf(buf, "\nJob %s is %s, %d succeeded, %d failed, %d missing\n", out.Jid, out.State, success, failed, len(out.Missing))
+	return buf.Bytes()
+}
+
+// timeLayout 输出任务时间的格式
+const timeLayout = "2006-01-02 15:04:05"
+
+// jobInfo 任务列表中的任务信息
+type jobInfo struct {
+	Jid      string               `json:"jid"`
+	Function string               `json:"function"`
+	Args     []string             `json:"args,omitempty"`
+	User     string               `json:"user,omitempty"`
+	Targets  []string             `json:"targets"`
+	Start    string               `json:"start"`
+	End      string               `json:"end,omitempty"`
+	State    string               `json:"state"`
+	Result   string               `json:"result,omitempty"`
+	Summary  *types.ReportSummary `json:"summary,omitempty"`
+	// 指定 minion 的执行结果，只在 jobs.list_minion 中返回
+	Minion *jobResult `json:"minion,omitempty"`
+}
+
+// jobList 任务列表
+type jobList struct {
+	Total  int64      `json:"total"`
+	Offset int64      `json:"offset"`
+	Jobs   []*jobInfo `json:"jobs"`
+	// 只输出该 minion 的执行结果
+	minion string
+}
+
+func newJobInfo(job *types.Job, minion string) *jobInfo {
+	info := &jobInfo{
+		Jid:     job.Jid,
+		User:    job.User,
+		Targets: job.Targets,
+		State:   job.State,
+		Result:  job.Result(minion).String(),
+		Summary: job.Summary,
+	}
+	if job.Request != nil {
+		info.Function = job.Request.Function
+		info.Args = job.Request.Args
+	}
+	if job.StartTimestamp > 0 {
+		info.Start = time.Unix(job.StartTimestamp, 0).Format(timeLayout)
+	}
+	if job.EndTimestamp > 0 {
+		info.End = time.Unix(job.EndTimestamp, 0).Format(timeLayout)
+	}
+	if minion != "" {
+		for _, item := range job.Items {
+			if item.Minion == minion {
+				info.Minion = newJobResult(item)
+			}
+		}
+	}
+	return info
+}
+
+// jobFilterKeys 任务列表支持的过滤参数
+var jobFilterKeys = []string{"start", "end", "function", "user", "result", "offset", "limit"}
+
+const jobFilterUsage = "[start=<time>] [end=<time>] [function=<glob>] [user=<user>] [result=success|failed] [offset=<n>] [limit=<n>]"
+
+// parseJobTime 解析任务列表的时间参数，支持 unix 时间戳、日期时间和相对于当前的时长，如: 24h
+func parseJobTime(value string, now time.Time) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return n, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d).Unix(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Unix(), nil
+	}
+	for _, layout := range []string{timeLayout, "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.Unix(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid time '%s', e.g. 2025-01-01, '2025-01-01 12:00:00' or 24h", value)
+}
+
+// parseJobFilter 解析任务列表的过滤参数
+func parseJobFilter(args *runArgs, now time.Time) (*pb.ListJobsRequest, error) {
+	var err error
+	req := &pb.ListJobsRequest{
+		Function: args.get(-1, "function"),
+		Minion:   args.get(-1, "minion"),
+		User:     args.get(-1, "user"),
+		Result:   args.get(-1, "result"),
+	}
+	if req.Start, err = parseJobTime(args.get(-1, "start"), now); err != nil {
+		return nil, fmt.Errorf("start: %w", err)
+	}
+	if req.End, err = parseJobTime(args.get(-1, "end"), now); err != nil {
+		return nil, fmt.Errorf("end: %w", err)
+	}
+	if value := args.get(-1, "offset"); value != "" {
+		if req.Offset, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid offset '%s'", value)
+		}
+	}
+	if value := args.get(-1, "limit"); value != "" {
+		if req.Limit, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid limit '%s'", value)
+		}
+	}
+	return req, nil
+}
+
+func listJobs(ctx context.Context, mc *client.Client, req *pb.ListJobsRequest) (*jobList, error) {
+	jobs, total, err := mc.ListJobs(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%v", apiErr.Parse(err).Detail)
+	}
+
+	out := &jobList{
+		Total:  total,
+		Offset: req.Offset,
+		Jobs:   make([]*jobInfo, 0, len(jobs)),
+		minion: req.Minion,
+	}
+	for _, job := range jobs {
+		out.Jobs = append(out.Jobs, newJobInfo(job, req.Minion))
+	}
+	return out, nil
+}
+
+func jobsListRunner() *runner {
+	return &runner{
+		name:  "jobs.list",
+		usage: "[minion=<minion>] " + jobFilterUsage,
+		short: "list the jobs in the job cache, the latest first",
+		run:   runJobsList,
+		text:  formatJobList,
+	}
+}
+
+func runJobsList(ctx context.Context, mc *client.Client, args *runArgs) (any, error) {
+	if err := args.check(0, append(jobFilterKeys, "minion")...); err != nil {
+		return nil, err
+	}
+	req, err := parseJobFilter(args, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return listJobs(ctx, mc, req)
+}
+
+func jobsListMinionRunner() *runner {
+	return &runner{
+		name:  "jobs.list_minion",
+		usage: "<minion> " + jobFilterUsage,
+		short: "list the jobs which targeted the minion, with the results of the minion",
+		run:   runJobsListMinion,
+		text:  formatJobList,
+	}
+}
+
+func runJobsListMinion(ctx context.Context, mc *client.Client, args *runArgs) (any, error) {
+	if err := args.check(1, append(jobFilterKeys, "minion")...); err != nil {
+		return nil, err
+	}
+	req, err := parseJobFilter(args, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	req.Minion = args.get(0, "minion")
+	if req.Minion == "" {
+		return nil, fmt.Errorf("missing minion, usage: jobs.list_minion <minion>")
+	}
+	return listJobs(ctx, mc, req)
+}
+
+// formatJobList 输出任务列表，jobs.list_minion 时输出 minion 的执行结果
+func formatJobList(v any) []byte {
+	out := v.(*jobList)
+
+	buf := bytes.NewBufferString("")
+	for _, job := range out.Jobs {
+		fmt.Fprintf(buf, "%s:\n", job.Jid)
+		fmt.Fprintf(buf, "    Function: %s\n", strings.TrimSpace(job.Function+" "+strings.Join(job.Args, " ")))
+		fmt.Fprintf(buf, "    User:     %s\n", job.User)
+		fmt.Fprintf(buf, "    Start:    %s\n", job.Start)
+		if out.minion == "" {
+			fmt.Fprintf(buf, "    Targets:  %s\n", formatTargets(job.Targets))
+		}
+
+		result := job.Result
+		if result == "" || job.State == types.JobKilled.String() {
+			result = job.State
+		}
+		c := color.New(color.FgYellow)
+		switch types.JobResult(job.Result) {
+		case types.JobSuccess:
+			c = color.New(color.FgGreen)
+		case types.JobFailed:
+			c = color.New(color.FgRed)
+		}
+		if out.minion == "" && job.Summary != nil {
+			result = fmt.Sprintf("%s, %d succeeded, %d failed", result, job.Summary.Success, job.Summary.Failed)
+		}
+		c.Fprintf(buf, "    Result:   %s\n", result)
+
+		if item := job.Minion; item != nil {
+			if !item.Result {
+				color.New(color.FgRed).Fprintf(buf, "    Error:    %s\n", item.Error)
+			} else {
+				var text string
+				if err := json.Unmarshal(item.Return, &text); err != nil {
+					text = string(item.Return)
+				}
+				fmt.Fprintf(buf, "    Return:   %s\n", text)
+			}
+		}
+	}
+
+	if len(out.Jobs) == 0 {
+		fmt.Fprintf(buf, "No jobs found, %d in total\n", out.Total)
+	} else {
+		fmt.Fprintf(buf, "\nShowing %d-%d of %d jobs\n", out.Offset+1, out.Offset+int64(len(out.Jobs)), out.Total)
+	}
+	return buf.Bytes()
+}
+
+// formatTargets 输出目标 minion，数量较多时只输出前几个
+func formatTargets(targets []string) string {
+	const max = 5
+	if len(targets) <= max {
+		return strings.Join(targets, ", ")
+	}
+	return fmt.Sprintf("%s, ... (%d minions)", strings.Join(targets[:max], ", "), len(targets))
+}
+
+// jobKill 终止任务的结果
+type jobKill struct {
+	Jid string `json:"jid"`
+	// 发送终止请求的 minion
+	Minions []string `json:"minions"`
+}
+
+func jobsKillRunner() *runner {
+	return &runner{
+		name:  "jobs.kill",
+		usage: "<jid>",
+		short: "kill the running job, the minions kill the processes of the job",
+		run:   runJobsKill,
+		text:  formatJobKill,
+	}
+}
+
+func runJobsKill(ctx context.Context, mc *client.Client, args *runArgs) (any, error) {
+	if err := args.check(1, "jid"); err != nil {
+		return nil, err
+	}
+	jid := args.get(0, "jid")
+	if jid == "" {
+		return nil, fmt.Errorf("missing jid, usage: jobs.kill <jid>")
+	}
+
+	minions, err := mc.KillJob(ctx, jid)
+	if err != nil {
+		return nil, fmt.Errorf("%v", apiErr.Parse(err).Detail)
+	}
+	return &jobKill{Jid: jid, Minions: minions}, nil
+}
+
+func formatJobKill(v any) []byte {
+	out := v.(*jobKill)
+
+	buf := bytes.NewBufferString("")
+	for _, name := range out.Minions {
+		color.New(color.FgRed).Fprintf(buf, "%s: killing\n", name)
+	}
+	fmt.Fprintf(buf, "\nJob %s is killed, %d minions signaled\n", out.Jid, len(out.Minions))
+	return buf.Bytes()
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/vine-io/maco/client"
+	"github.com/vine-io/maco/internal/tools/utils"
+	version "github.com/vine-io/maco/pkg/version"
+)
+
+var defaultUsageTemplate = `Usage:{{if .Runnable}}
+  {{.UseLine}} <function> [arguments]{{end}}{{if .HasExample}}
+
+Examples:
+{{.Example}}{{end}}
+
+Functions:
+%s{{if .HasAvailableLocalFlags}}
+
+Flags:
+{{.LocalFlags.FlagUsages | trimTrailingWhitespaces}}{{end}}
+`
+
+var runExample = `  # run the job in background and lookup the results later
+  jid=$(maco 'web*' cmd.run 'sleep 60; uptime' --async)
+  maco-run jobs.lookup $jid
+
+  # output the results as json
+  maco-run jobs.lookup jid=$jid -F json
+
+  # list the jobs submitted by alice, the user is reported by the client and not verified by the master
+  maco-run jobs.list user=alice
+
+  # list the failed jobs of cmd.* since yesterday
+  maco-run jobs.list start=24h function='cmd.*' result=failed
+
+  # kill the running job on all minions
+  maco-run jobs.kill $jid
+
+  # list what ran on db-07 yesterday
+  maco-run jobs.list_minion db-07 start=2025-01-01 end=2025-01-02 -F yaml`
+
+// runner 在 maco-master 上执行的方法
+type runner struct {
+	// 方法名称，如: jobs.lookup
+	name string
+	// 参数说明
+	usage string
+	short string
+	run   func(ctx context.Context, mc *client.Client, args *runArgs) (any, error)
+	// text 将 run 的结果转换成 text 格式
+	text func(out any) []byte
+}
+
+// runners 返回所有支持的方法
+func runners() []*runner {
+	return []*runner{
+		jobsLookupRunner(),
+		jobsListRunner(),
+		jobsListMinionRunner(),
+		jobsKillRunner(),
+	}
+}
+
+func lookupRunner(name string) (*runner, bool) {
+	for _, r := range runners() {
+		if r.name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// runnerUsage 输出方法列表
+func runnerUsage() string {
+	items := runners()
+	lines := make([]string, 0, len(items))
+	for _, r := range items {
+		lines = append(lines, fmt.Sprintf("  %s %s\n      %s", r.name, r.usage, r.short))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// runArgs 方法的参数，支持位置参数和 key=value 格式的参数
+type runArgs struct {
+	args   []string
+	kwargs map[string]string
+}
+
+func parseRunArgs(args []string) *runArgs {
+	out := &runArgs{args: []string{}, kwargs: map[string]string{}}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if ok && key != "" && !strings.ContainsAny(key, " \t") {
+			out.kwargs[key] = value
+			continue
+		}
+		out.args = append(out.args, arg)
+	}
+	return out
+}
+
+// get 返回指定的参数，key=value 格式的参数优先
+func (a *runArgs) get(index int, key string) string {
+	if value, ok := a.kwargs[key]; ok {
+		return value
+	}
+	if index >= 0 && index < len(a.args) {
+		return a.args[index]
+	}
+	return ""
+}
+
+// check 检查是否存在不支持的参数
+func (a *runArgs) check(positional int, keys ...string) error {
+	if len(a.args) > positional {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(a.args[positional:], " "))
+	}
+	unknown := make([]string, 0)
+	for key := range a.kwargs {
+		found := false
+		for _, item := range keys {
+			if item == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown arguments: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+func NewRunCommand(stdin io.Reader, stdout, stderr io.Writer) *cobra.Command {
+	app := &cobra.Command{
+		Use:     "maco-run",
+		Short:   "execute the functions on maco-master, such as jobs lookup",
+		Version: version.ReleaseVersion(),
+		Example: runExample,
+		Args:    cobra.ArbitraryArgs,
+		RunE:    runRunCmd,
+	}
+
+	app.SetIn(stdin)
+	app.SetOut(stdout)
+	app.SetErr(stderr)
+	app.SetVersionTemplate(version.GetVersionTemplate())
+	app.SetUsageTemplate(fmt.Sprintf(defaultUsageTemplate, runnerUsage()))
+
+	app.ResetFlags()
+
+	var configPath string
+	homeDir, _ := os.UserHomeDir()
+	if homeDir != "" {
+		configPath = filepath.Join(homeDir, ".maco", "maco.toml")
+	}
+
+	flagSet := app.Flags()
+	flagSet.StringP("config", "C", configPath, "Set path to the configuration file.")
+	flagSet.StringP("format", "F", "", "Set the format of output, etc text, json, yaml.")
+	flagSet.StringP("output", "O", "", "Write the output to the specified file.")
+	flagSet.BoolP("output-append", "", false, "Append the output to the specified file.")
+	flagSet.BoolP("no-color", "", false, "Disable all colored output.")
+
+	return app
+}
+
+func runRunCmd(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return cmd.Usage()
+	}
+	ctx := cmd.Context()
+	flagSet := cmd.Flags()
+
+	r, ok := lookupRunner(args[0])
+	if !ok {
+		return fmt.Errorf("unknown function '%s'", args[0])
+	}
+
+	noColor, _ := flagSet.GetBool("no-color")
+	format, _ := flagSet.GetString("format")
+	outputFile, _ := flagSet.GetString("output")
+	outputAppend, _ := flagSet.GetBool("output-append")
+
+	mc, err := utils.ClientFromFlags(flagSet)
+	if err != nil {
+		return err
+	}
+	defer mc.Close()
+
+	out, err := r.run(ctx, mc, parseRunArgs(args[1:]))
+	if err != nil {
+		return err
+	}
+
+	output := cmd.OutOrStdout()
+	if len(outputFile) != 0 {
+		mode := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if outputAppend {
+			mode = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		fd, fdErr := os.OpenFile(outputFile, mode, 0755)
+		if fdErr != nil {
+			return fmt.Errorf("open output file: %w", fdErr)
+		}
+		defer fd.Close()
+		output = fd
+	}
+
+	var data []byte
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(out, " ", "   ")
+		if err != nil {
+			return fmt.Errorf("json marshal: %w", err)
+		}
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(out)
+		if err != nil {
+			return fmt.Errorf("yaml marshal: %w", err)
+		}
+	default:
+		if noColor || !utils.AllowColor() {
+			color.NoColor = true
+		}
+		data = r.text(out)
+	}
+
+	fmt.Fprintf(output, "%s", string(data))
+	return nil
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package dsutil
+
+// MergeMap deep merges src into dst and returns dst, the values in src take precedence.
+// The nested maps are merged recursively, other values are replaced.
+func MergeMap(dst, src map[string]any) map[string]any {
+	for key, value := range src {
+		sm, ok1 := value.(map[string]any)
+		dm, ok2 := dst[key].(map[string]any)
+		if ok1 && ok2 {
+			dst[key] = MergeMap(dm, sm)
+			continue
+		}
+		dst[key] = value
+	}
+	return dst
+}
@@ -22,8 +22,10 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 package pemutil
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
@@ -78,18 +80,74 @@ func GenerateRSA(bits int, logo string) (*RsaPair, error) {
 
 // EncodeByRSA 使用RSA公钥加密数据，支持长文本分段加密
 func EncodeByRSA(plaintext, publicKey []byte) ([]byte, error) {
-	// 解析PEM格式公钥
+	pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return encryptChunks(pub, plaintext)
+}
+
+// DecodeByRSA 使用RSA私钥解密数据
+func DecodeByRSA(ciphertext, privateKey []byte) ([]byte, error) {
+	priv, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// 计算最大解密块大小
+	chunkSize := priv.Size()
+	var plaintext []byte
+
+	for offset := 0; offset < len(ciphertext); offset += chunkSize {
+		end := offset + chunkSize
+		if end > len(ciphertext) {
+			end = len(ciphertext)
+		}
+
+		chunk, err := rsa.DecryptPKCS1v15(rand.Reader, priv, ciphertext[offset:end])
+		if err != nil {
+			return nil, fmt.Errorf("decryption failed at offset %d: %w", offset, err)
+		}
+		plaintext = append(plaintext, chunk...)
+	}
+	return plaintext, nil
+}
+
+// SignByRSA 使用RSA私钥对数据的 sha256 值签名
+func SignByRSA(data, privateKey []byte) ([]byte, error) {
+	priv, err := parsePrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+}
+
+// VerifyByRSA 使用RSA公钥校验 SignByRSA 生成的签名
+func VerifyByRSA(data, signature, publicKey []byte) error {
+	pub, err := parsePublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+	digest := sha256.Sum256(data)
+	if err = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature); err != nil {
+		return fmt.Errorf("verify signature: %w", err)
+	}
+	return nil
+}
+
+// parsePublicKey 解析PEM格式公钥，兼容PKIX和PKCS1格式
+func parsePublicKey(publicKey []byte) (*rsa.PublicKey, error) {
 	block, _ := pem.Decode(publicKey)
 	if block == nil || block.Type != "PUBLIC KEY" {
 		return nil, errors.New("invalid PEM format or key type")
 	}
 
-	// 兼容解析PKIX和PKCS1格式公钥
 	pubInterface, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
 		// 尝试PKCS1格式解析
 		if pub, err2 := x509.ParsePKCS1PublicKey(block.Bytes); err2 == nil {
-			return encryptChunks(pub, plaintext)
+			return pub, nil
 		}
 		return nil, fmt.Errorf("failed to parse public key: %w", err)
 	}
@@ -98,47 +156,29 @@ func EncodeByRSA(plaintext, publicKey []byte) ([]byte, error) {
 	if !ok {
 		return nil, errors.New("not an RSA public key")
 	}
-	return encryptChunks(pub, plaintext)
+	return pub, nil
 }
 
-// DecodeByRSA 使用RSA私钥解密数据
-func DecodeByRSA(ciphertext, privateKey []byte) ([]byte, error) {
+// parsePrivateKey 解析PEM格式私钥，支持PKCS1和PKCS8格式
+func parsePrivateKey(privateKey []byte) (*rsa.PrivateKey, error) {
 	block, _ := pem.Decode(privateKey)
 	if block == nil {
 		return nil, errors.New("invalid PEM data")
 	}
 
-	// 支持PKCS1和PKCS8格式私钥
-	var priv *rsa.PrivateKey
-	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
-		priv = key
-	} else if key2, err2 := x509.ParsePKCS8PrivateKey(block.Bytes); err2 == nil {
-		rsaKey, ok := key2.(*rsa.PrivateKey)
-		if !ok {
-			return nil, errors.New("not an RSA private key")
-		}
-		priv = rsaKey
-	} else {
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err == nil {
+		return key, nil
+	}
+	key2, err2 := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err2 != nil {
 		return nil, fmt.Errorf("unsupported private key format: %w", err)
 	}
-
-	// 计算最大解密块大小
-	chunkSize := priv.Size()
-	var plaintext []byte
-
-	for offset := 0; offset < len(ciphertext); offset += chunkSize {
-		end := offset + chunkSize
-		if end > len(ciphertext) {
-			end = len(ciphertext)
-		}
-
-		chunk, err := rsa.DecryptPKCS1v15(rand.Reader, priv, ciphertext[offset:end])
-		if err != nil {
-			return nil, fmt.Errorf("decryption failed at offset %d: %w", offset, err)
-		}
-		plaintext = append(plaintext, chunk...)
+	rsaKey, ok := key2.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
 	}
-	return plaintext, nil
+	return rsaKey, nil
 }
 
 // encryptChunks 分段加密处理（解决RSA加密长度限制）
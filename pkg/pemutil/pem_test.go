@@ -63,3 +63,26 @@ func TestRSA(t *testing.T) {
 
 	assert.Equal(t, source, string(target))
 }
+
+func TestSign(t *testing.T) {
+	pair, err := GenerateRSA(2048, "MACO")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateRSA(2048, "MACO")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("minion1:1700000000")
+	signature, err := SignByRSA(data, pair.Private)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, VerifyByRSA(data, signature, pair.Public))
+	assert.Error(t, VerifyByRSA([]byte("minion2:1700000000"), signature, pair.Public))
+	assert.Error(t, VerifyByRSA(data, signature, other.Public))
+
+	_, err = SignByRSA(data, []byte("invalid"))
+	assert.Error(t, err)
+}
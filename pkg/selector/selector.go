@@ -0,0 +1,519 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+// Package selector implements the compound target expressions used to choose
+// minions. An expression combines matchers with `and`, `or`, `not` and
+// parentheses, for example:
+//
+//	G@os:linux and web-* and not S@10.1.0.0/16
+//
+// Supported matchers:
+//
+//	web-*            glob on the minion name (the default matcher)
+//	web1,db-*        comma separated globs on the minion name, matches any of them
+//	E@web[0-9]+      regular expression on the minion name
+//	L@web1,web2      explicit list of minion names
+//	G@os:linux       glob on a grain value, nested keys are split by ':'
+//	                 and the value may contain ':' (e.g. G@ipv6:fe80::*)
+//	P@os:lin.*       regular expression on a grain value
+//	T@role:web       glob on a minion tag
+//	S@10.0.0.0/8     minion ip address or subnet
+//
+// The operating system and cpu architecture of every minion are always
+// available as the `os` and `arch` grains.
+package selector
+
+import (
+	"fmt"
+	"net"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DefaultDelimiter separates nested keys in grain and tag matchers
+	DefaultDelimiter = ":"
+)
+
+// Target is the view of a minion evaluated by the matchers
+type Target struct {
+	Name   string
+	IPs    []string
+	Tags   map[string]string
+	Grains map[string]any
+}
+
+// Expr is a parsed target expression
+type Expr interface {
+	// Match reports whether the given target satisfies the expression
+	Match(t *Target) bool
+	String() string
+}
+
+// Parse parses the compound target expression
+func Parse(text string) (Expr, error) {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty target expression")
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok, ok := p.peek(); ok {
+		return nil, fmt.Errorf("unexpected token %q at position %d", tok, p.pos)
+	}
+	return expr, nil
+}
+
+// Match parses the expression and evaluates it against the given target
+func Match(text string, t *Target) (bool, error) {
+	expr, err := Parse(text)
+	if err != nil {
+		return false, err
+	}
+	return expr.Match(t), nil
+}
+
+// Filter returns the targets which satisfy the expression
+func Filter(expr Expr, targets []*Target) []*Target {
+	out := make([]*Target, 0)
+	for _, t := range targets {
+		if expr.Match(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// tokenize splits the expression by whitespace. Parentheses glued to a word
+// are split off, unless they belong to the matcher itself (e.g. E@web(1|2)).
+func tokenize(text string) []string {
+	tokens := make([]string, 0)
+	for _, word := range strings.Fields(text) {
+		for strings.HasPrefix(word, "(") {
+			tokens = append(tokens, "(")
+			word = word[1:]
+		}
+
+		closes := 0
+		for strings.HasSuffix(word, ")") &&
+			strings.Count(word, ")") > strings.Count(word, "(") {
+			word = word[:len(word)-1]
+			closes += 1
+		}
+		if word != "" {
+			tokens = append(tokens, word)
+		}
+		for i := 0; i < closes; i++ {
+			tokens = append(tokens, ")")
+		}
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *parser) peek() (string, bool) {
+	if p.pos >= len(p.tokens) {
+		return "", false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() (string, bool) {
+	tok, ok := p.peek()
+	if ok {
+		p.pos += 1
+	}
+	return tok, ok
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok != "or" {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok, ok := p.peek()
+		if !ok || tok != "and" {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	tok, ok := p.next()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of target expression")
+	}
+
+	switch tok {
+	case "not":
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{inner: inner}, nil
+	case "(":
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok, ok = p.next(); !ok || tok != ")" {
+			return nil, fmt.Errorf("missing ')' in target expression")
+		}
+		return inner, nil
+	case ")", "and", "or":
+		return nil, fmt.Errorf("unexpected token %q at position %d", tok, p.pos-1)
+	default:
+		return parseMatcher(tok)
+	}
+}
+
+func parseMatcher(word string) (Expr, error) {
+	kind, value := "", word
+	if len(word) > 2 && word[1] == '@' {
+		kind, value = word[:1], word[2:]
+	}
+	if value == "" {
+		return nil, fmt.Errorf("empty matcher %q", word)
+	}
+
+	switch kind {
+	case "":
+		patterns := make([]string, 0)
+		for _, pattern := range strings.Split(value, ",") {
+			if pattern == "" {
+				continue
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+			}
+			patterns = append(patterns, pattern)
+		}
+		if len(patterns) == 0 {
+			return nil, fmt.Errorf("empty matcher %q", word)
+		}
+		return &globMatcher{patterns: patterns}, nil
+	case "E":
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp %q: %w", value, err)
+		}
+		return &regexpMatcher{re: re}, nil
+	case "L":
+		names := make(map[string]struct{})
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names[name] = struct{}{}
+			}
+		}
+		return &listMatcher{raw: value, names: names}, nil
+	case "G", "P", "T":
+		parts := strings.Split(value, DefaultDelimiter)
+		if len(parts) < 2 || parts[0] == "" {
+			return nil, fmt.Errorf("matcher %q requires the form %s@key:value", word, kind)
+		}
+		return newFieldMatcher(kind, value, parts)
+	case "S":
+		m := &subnetMatcher{raw: value}
+		if strings.Contains(value, "/") {
+			_, ipNet, err := net.ParseCIDR(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid subnet %q: %w", value, err)
+			}
+			m.ipNet = ipNet
+		} else {
+			m.ip = net.ParseIP(value)
+			if m.ip == nil {
+				return nil, fmt.Errorf("invalid ip address %q", value)
+			}
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unknown matcher %q", kind+"@")
+	}
+}
+
+type andExpr struct {
+	left, right Expr
+}
+
+func (e *andExpr) Match(t *Target) bool {
+	return e.left.Match(t) && e.right.Match(t)
+}
+
+func (e *andExpr) String() string {
+	return "(" + e.left.String() + " and " + e.right.String() + ")"
+}
+
+type orExpr struct {
+	left, right Expr
+}
+
+func (e *orExpr) Match(t *Target) bool {
+	return e.left.Match(t) || e.right.Match(t)
+}
+
+func (e *orExpr) String() string {
+	return "(" + e.left.String() + " or " + e.right.String() + ")"
+}
+
+type notExpr struct {
+	inner Expr
+}
+
+func (e *notExpr) Match(t *Target) bool {
+	return !e.inner.Match(t)
+}
+
+func (e *notExpr) String() string {
+	return "not " + e.inner.String()
+}
+
+// globMatcher matches the minion name against any of the patterns
+type globMatcher struct {
+	patterns []string
+}
+
+func (m *globMatcher) Match(t *Target) bool {
+	for _, pattern := range m.patterns {
+		if ok, _ := path.Match(pattern, t.Name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *globMatcher) String() string { return strings.Join(m.patterns, ",") }
+
+type regexpMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m *regexpMatcher) Match(t *Target) bool {
+	return m.re.MatchString(t.Name)
+}
+
+func (m *regexpMatcher) String() string { return "E@" + m.re.String() }
+
+type listMatcher struct {
+	raw   string
+	names map[string]struct{}
+}
+
+func (m *listMatcher) Match(t *Target) bool {
+	_, ok := m.names[t.Name]
+	return ok
+}
+
+func (m *listMatcher) String() string { return "L@" + m.raw }
+
+// fieldMatcher matches a grain or tag value. The key path is not known until
+// the grains are walked: the key ends at the first value which is not a map and
+// the rest of the expression is the pattern, so both `G@disks:sda:ssd` and
+// `G@ipv6:fe80::*` work.
+type fieldMatcher struct {
+	kind  string
+	raw   string
+	parts []string
+	// patterns[i] is the pattern when the key consists of the first i parts,
+	// it is nil when that pattern is invalid
+	patterns []*fieldPattern
+}
+
+type fieldPattern struct {
+	glob string
+	re   *regexp.Regexp
+}
+
+func newFieldMatcher(kind, raw string, parts []string) (*fieldMatcher, error) {
+	m := &fieldMatcher{kind: kind, raw: raw, parts: parts}
+	m.patterns = make([]*fieldPattern, len(parts))
+	var firstErr error
+	valid := false
+	for i := 1; i < len(parts); i++ {
+		text := strings.Join(parts[i:], DefaultDelimiter)
+		p := &fieldPattern{glob: text}
+		var err error
+		if kind == "P" {
+			if p.re, err = regexp.Compile(text); err != nil {
+				err = fmt.Errorf("invalid regexp %q: %w", text, err)
+			}
+		} else if _, err = path.Match(text, ""); err != nil {
+			err = fmt.Errorf("invalid glob %q: %w", text, err)
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		m.patterns[i] = p
+		valid = true
+	}
+	if !valid {
+		return nil, firstErr
+	}
+	return m, nil
+}
+
+func (m *fieldMatcher) Match(t *Target) bool {
+	var value any
+	depth := 1
+	if m.kind == "T" {
+		tag, ok := t.Tags[m.parts[0]]
+		if !ok {
+			return false
+		}
+		value = tag
+	} else {
+		// descend into the nested grains while the value is a map
+		var current any = t.Grains
+		depth = 0
+		for depth < len(m.parts)-1 {
+			node, ok := current.(map[string]any)
+			if !ok {
+				break
+			}
+			if current, ok = node[m.parts[depth]]; !ok {
+				return false
+			}
+			depth += 1
+		}
+		if _, ok := current.(map[string]any); ok || depth == 0 {
+			return false
+		}
+		value = current
+	}
+
+	p := m.patterns[depth]
+	if p == nil {
+		return false
+	}
+	for _, item := range flatten(value) {
+		if p.re != nil {
+			if p.re.MatchString(item) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(p.glob, item); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *fieldMatcher) String() string {
+	return m.kind + "@" + m.raw
+}
+
+type subnetMatcher struct {
+	raw   string
+	ip    net.IP
+	ipNet *net.IPNet
+}
+
+func (m *subnetMatcher) Match(t *Target) bool {
+	for _, value := range t.IPs {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			continue
+		}
+		if m.ipNet != nil && m.ipNet.Contains(ip) {
+			return true
+		}
+		if m.ip != nil && m.ip.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *subnetMatcher) String() string { return "S@" + m.raw }
+
+// Lookup returns the value of nested key (e.g. `os:family`) in the data
+func Lookup(data map[string]any, key, delimiter string) (any, bool) {
+	var current any = data
+	for _, part := range strings.Split(key, delimiter) {
+		node, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		current, ok = node[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// flatten converts the grain value to the list of strings to be matched
+func flatten(value any) []string {
+	switch tv := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return []string{tv}
+	case []string:
+		return tv
+	case []any:
+		out := make([]string, 0, len(tv))
+		for _, item := range tv {
+			out = append(out, flatten(item)...)
+		}
+		return out
+	default:
+		return []string{fmt.Sprint(tv)}
+	}
+}
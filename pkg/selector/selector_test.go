@@ -0,0 +1,126 @@
+/*
+Copyright 2025 The maco Authors
+
+This program is offered under a commercial and under the AGPL license.
+For AGPL licensing, see below.
+
+AGPL licensing:
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package selector
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTargets() []*Target {
+	return []*Target{
+		{
+			Name:   "web-1",
+			IPs:    []string{"10.0.0.11"},
+			Tags:   map[string]string{"role": "frontend"},
+			Grains: map[string]any{"os": "linux", "arch": "amd64"},
+		},
+		{
+			Name:   "web-2",
+			IPs:    []string{"10.1.0.12"},
+			Tags:   map[string]string{"role": "frontend"},
+			Grains: map[string]any{"os": "linux", "arch": "arm64"},
+		},
+		{
+			Name:   "db-1",
+			IPs:    []string{"10.0.0.21"},
+			Tags:   map[string]string{"role": "database"},
+			Grains: map[string]any{"os": "linux", "arch": "amd64", "disks": map[string]any{"sda": "ssd"}, "osrelease": "10:2", "ipv6": []any{"fe80::1"}},
+		},
+		{
+			Name:   "win-1",
+			IPs:    []string{"192.168.1.5"},
+			Grains: map[string]any{"os": "windows", "arch": "amd64", "roles": []any{"ad", "dns"}},
+		},
+	}
+}
+
+func names(targets []*Target) []string {
+	out := make([]string, 0, len(targets))
+	for _, t := range targets {
+		out = append(out, t.Name)
+	}
+	return out
+}
+
+func TestParseAndMatch(t *testing.T) {
+	cases := []struct {
+		expr  string
+		match []string
+	}{
+		{"*", []string{"web-1", "web-2", "db-1", "win-1"}},
+		{"web-*", []string{"web-1", "web-2"}},
+		{"web-1,db-1", []string{"web-1", "db-1"}},
+		{"win-*,db-1,", []string{"db-1", "win-1"}},
+		{"E@^(web|db)-1$", []string{"web-1", "db-1"}},
+		{"L@db-1,win-1", []string{"db-1", "win-1"}},
+		{"G@os:windows", []string{"win-1"}},
+		{"G@arch:arm*", []string{"web-2"}},
+		{"G@disks:sda:ssd", []string{"db-1"}},
+		{"G@roles:dns", []string{"win-1"}},
+		{"G@osrelease:10:2", []string{"db-1"}},
+		{"G@ipv6:fe80::*", []string{"db-1"}},
+		{"P@ipv6:^fe80::1$", []string{"db-1"}},
+		{"G@disks:sda", []string{}},
+		{"P@os:^lin.*", []string{"web-1", "web-2", "db-1"}},
+		{"T@role:front*", []string{"web-1", "web-2"}},
+		{"S@10.0.0.0/16", []string{"web-1", "db-1"}},
+		{"S@192.168.1.5", []string{"win-1"}},
+		{"G@os:linux and web-* and not S@10.1.0.0/16", []string{"web-1"}},
+		{"web-1 or db-* and G@arch:amd64", []string{"web-1", "db-1"}},
+		{"(web-* or db-*) and not G@arch:arm64", []string{"web-1", "db-1"}},
+		{"not (web-* or db-*)", []string{"win-1"}},
+		{"E@web-(1|2) and T@role:frontend", []string{"web-1", "web-2"}},
+	}
+
+	for _, c := range cases {
+		expr, err := Parse(c.expr)
+		if !assert.NoError(t, err, c.expr) {
+			continue
+		}
+		assert.Equal(t, c.match, names(Filter(expr, newTargets())), c.expr)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	cases := []string{
+		"",
+		"web-* and",
+		"(web-*",
+		"web-* db-*",
+		"or web-*",
+		"X@foo",
+		"G@os",
+		"G@:linux",
+		"P@os:lin[",
+		"S@10.0.0.0/33",
+		"E@web[",
+		",",
+		"web-1,db[",
+	}
+
+	for _, c := range cases {
+		_, err := Parse(c)
+		assert.Error(t, err, c)
+	}
+}